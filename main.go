@@ -1,60 +1,101 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	box "github.com/Delta456/box-cli-maker/v2"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/koblas/swerver/pkg/handler"
+	"github.com/koblas/swerver/pkg/version"
 	_ "gopkg.in/go-playground/validator.v9"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
-func loadConfig(path *string) handler.Configuration {
+func configName(path *string) string {
 	if path != nil {
-		config, _ := handler.LoadServeConfiguration(*path)
-		return config
+		return *path
 	}
-	config, _ := handler.LoadServeConfiguration("swerver.json")
-	return config
+	return handler.FindConfigurationFile()
 }
 
-func main() {
-	var opts struct {
-		// Help          bool      `short:"h" long:"help" description:"Shows this help message"`
-		Version       bool      `short:"v" long:"version" description:"Display the current version of serve"`
-		Listen        []*string `short:"l" long:"listen" description:"Specify a URI endpoint on which to listen (see below) more than one may be specified to listen in multiple places" default:"5000"`
-		Port          *string   `short:"p" long:"port" description:"Port (depreicated, use listen)" hidden:"true"`
-		Debug         *bool     `short:"d" long:"debug" description:"Shows debugging information"`
-		Single        *bool     `short:"s" long:"single" description:"Rewrite all not-found requests to 'index.html'"`
-		NoClipboard   *bool     `short:"n" long:"no-clipboard" description:"Do not copy the local address to the clipboard"`
-		NoCompression *bool     `short:"u" long:"no-compression" description:"Disable compression for files served"`
-		Symlinks      *bool     `short:"S" long:"symlinks" description:"Resolve symlinks instead of showing 404 errors"`
-		Config        *string   `short:"c" long:"config" description:"Specify custom path to 'serve.json'"`
+func newRouter(config handler.Configuration, accessLog func(http.Handler) http.Handler) (http.Handler, error) {
+	h, err := handler.NewHandler(config)
+	if err != nil {
+		return nil, err
 	}
 
-	args, err := flags.Parse(&opts)
+	router := chi.NewRouter()
+	router.Use(accessLog)
+
+	h.AttachRoutes(router)
+
+	return router, nil
+}
+
+func openLogFile(path string) *handler.LogFile {
+	logFile, err := handler.OpenLogFile(path)
 	if err != nil {
-		if !flags.WroteHelp(err) {
-			panic(err)
-		}
-		os.Exit(0)
+		log.Fatal(err)
 	}
+	return logFile
+}
 
-	if opts.Version {
-		fmt.Printf("0.1.0\n")
-		os.Exit(0)
-	}
+// reloadOnHangup reopens the log files and rebuilds the handler whenever the
+// process receives a SIGHUP, reloader is nil when the configuration can't be
+// read again.
+func reloadOnHangup(reloader *handler.Reloader, logFiles []*handler.LogFile) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
 
-	config := loadConfig(opts.Config)
+	go func() {
+		for range hangup {
+			for _, logFile := range logFiles {
+				if err := logFile.Reopen(); err != nil {
+					log.Printf("Unable to reopen log file: %s", err)
+				}
+			}
+			if reloader == nil {
+				continue
+			}
+			if err := reloader.Reload(); err != nil {
+				log.Printf("Unable to reload configuration, keeping the current one: %s", err)
+			} else {
+				log.Printf("Configuration reloaded")
+			}
+		}
+	}()
+}
+
+// options are the command line flags
+type options struct {
+	// Help          bool      `short:"h" long:"help" description:"Shows this help message"`
+	Version       bool      `short:"v" long:"version" description:"Display the current version of serve"`
+	Listen        []*string `short:"l" long:"listen" description:"Specify a URI endpoint on which to listen (see below) more than one may be specified to listen in multiple places" default:"5000"`
+	Port          *string   `short:"p" long:"port" description:"Port (depreicated, use listen)" hidden:"true"`
+	Debug         *bool     `short:"d" long:"debug" description:"Shows debugging information"`
+	Single        *bool     `short:"s" long:"single" description:"Rewrite all not-found requests to 'index.html'"`
+	NoClipboard   *bool     `short:"n" long:"no-clipboard" description:"Do not copy the local address to the clipboard"`
+	NoCompression *bool     `short:"u" long:"no-compression" description:"Disable compression for files served"`
+	Symlinks      *bool     `short:"S" long:"symlinks" description:"Resolve symlinks instead of showing 404 errors"`
+	Config        *string   `short:"c" long:"config" description:"Specify custom path to 'swerver.json' (or .yaml), '-' reads it from stdin"`
+	NoKeepAlive   *bool     `long:"no-keep-alive" description:"Close connections after every response"`
+	TLS           bool      `long:"tls" description:"Serve HTTPS with a self-signed certificate when no certificate is configured"`
+}
 
+// applyOptions overrides the configuration with the command line flags and
+// the public directory given as an argument
+func applyOptions(config handler.Configuration, opts options, args []string) handler.Configuration {
 	if opts.Single != nil {
 		config.RenderSingle = *opts.Single
 		config.Rewrites = append(config.Rewrites, handler.ConfigRewrite{
@@ -71,6 +112,94 @@ func main() {
 	if opts.NoCompression != nil {
 		config.NoCompression = *opts.NoCompression
 	}
+	if opts.NoKeepAlive != nil {
+		config.NoKeepAlive = *opts.NoKeepAlive
+	}
+	if opts.Symlinks != nil {
+		config.Symlinks = *opts.Symlinks
+	}
+	if len(args) != 0 {
+		config.Public = args[0]
+	}
+
+	return config
+}
+
+func main() {
+	var opts options
+
+	args, err := flags.Parse(&opts)
+	if err != nil {
+		if !flags.WroteHelp(err) {
+			panic(err)
+		}
+		os.Exit(0)
+	}
+
+	if opts.Version {
+		fmt.Println(version.String())
+		os.Exit(0)
+	}
+
+	name := configName(opts.Config)
+	loadConfig := func() (handler.Configuration, error) {
+		config, err := handler.LoadServeConfiguration(name)
+		if err != nil {
+			return config, err
+		}
+
+		config = applyOptions(config, opts, args)
+		if config.Public == "" {
+			cwd, err := os.Getwd()
+			if err != nil {
+				panic(err)
+			}
+			config.Public = cwd
+		}
+
+		return config, nil
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	shutdownTimeout, err := handler.ShutdownTimeout(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	logFiles := []*handler.LogFile{}
+	accessLog := middleware.Logger
+	if config.AccessLogFile != "" {
+		logFile := openLogFile(config.AccessLogFile)
+		logFiles = append(logFiles, logFile)
+		accessLog = handler.AccessLogger(logFile)
+	}
+	if config.ErrorLogFile != "" {
+		logFile := openLogFile(config.ErrorLogFile)
+		logFiles = append(logFiles, logFile)
+		log.SetOutput(logFile)
+	}
+
+	router, err := newRouter(config, accessLog)
+	if err != nil {
+		log.Fatal(err)
+	}
+	reloader := handler.NewReloader(router, func() (http.Handler, error) {
+		config, err := loadConfig()
+		if err != nil {
+			return nil, err
+		}
+		return newRouter(config, accessLog)
+	})
+	// The configuration can't be read from stdin a second time
+	if name == "-" {
+		reloadOnHangup(nil, logFiles)
+	} else {
+		reloadOnHangup(reloader, logFiles)
+	}
+
 	if opts.Port != nil {
 		if len(opts.Listen) == 1 && *opts.Listen[0] == "5000" {
 			opts.Listen = []*string{opts.Port}
@@ -82,16 +211,6 @@ func main() {
 		port := "5000"
 		opts.Listen = []*string{&port}
 	}
-	if len(args) != 0 {
-		config.Public = args[0]
-	}
-	if config.Public == "" {
-		cwd, err := os.Getwd()
-		if err != nil {
-			panic(err)
-		}
-		config.Public = cwd
-	}
 
 	/*
 		fmt.Println("┌──────────────────────────────────────────────────┐")
@@ -111,44 +230,99 @@ func main() {
 	bx := box.New(box.Config{Px: 4, Py: 1})
 	lines := []string{}
 
-	for idx, item := range opts.Listen {
-		lines = append(lines, fmt.Sprintf("- Local:       http://%s:%s", "localhost", *item))
+	autoCert, err := handler.NewAutoCert(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	hasCertFiles := config.Ssl.KeyFile != "" && config.Ssl.CertFile != ""
+	selfSigned := opts.TLS && autoCert == nil && !hasCertFiles
+	scheme := "http"
+	if autoCert != nil || hasCertFiles || selfSigned {
+		scheme = "https"
+	}
+
+	servers := []*http.Server{}
+	for _, item := range opts.Listen {
+		addr := handler.ListenAddress(*item)
+		host, port, _ := net.SplitHostPort(addr)
+		if host == "" {
+			host = "localhost"
+		}
+		lines = append(lines, fmt.Sprintf("- Local:       %s://%s", scheme, net.JoinHostPort(host, port)))
 		// lines = append(lines, fmt.Sprintf("%s    %s",
 		// 	color.Magenta.Sprint("- Local"),
 		// 	color.Info.Sprintf("http://%s:%s", "localhost", *item)))
 
-		listener := func() {
-			// mux := http.NewServeMux()
-			// mux.Handle("/", handler.NewHandler(config))
+		// mux := http.NewServeMux()
+		// mux.Handle("/", handler.NewHandler(config))
 
-			h := handler.NewHandler(config)
+		server, err := handler.NewServer(config, addr, reloader)
+		if err != nil {
+			log.Fatal(err)
+		}
+		servers = append(servers, server)
+	}
 
-			router := chi.NewRouter()
-			router.Use(middleware.Logger)
-			if !config.NoCompression {
-				router.Use(middleware.Compress(5))
-			}
+	var challenge *http.Server
+	if autoCert != nil {
+		for _, server := range servers {
+			handler.UseAutoCert(server, autoCert)
+		}
+		challenge = handler.NewChallengeServer(config, autoCert)
+		servers = append(servers, challenge)
+		lines = append(lines, fmt.Sprintf("- Challenges:  http://%s", challenge.Addr))
+	}
+
+	if selfSigned {
+		cert, err := handler.SelfSignedCertificate(handler.ListenHosts(servers))
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, server := range servers {
+			handler.UseCertificate(server, cert)
+		}
+		lines = append(lines, "- Using a self-signed development certificate")
+	}
 
-			h.AttachRoutes(router)
+	// The challenge listener already sends its other requests to HTTPS
+	redirect := handler.NewRedirectServer(config)
+	if redirect != nil && scheme != "https" {
+		log.Printf("Ignoring ssl.redirectAddr, HTTPS isn't enabled")
+		redirect = nil
+	}
+	if redirect != nil && (challenge == nil || challenge.Addr != redirect.Addr) {
+		servers = append(servers, redirect)
+		lines = append(lines, fmt.Sprintf("- Redirect:    http://%s", redirect.Addr))
+	}
 
-			server := http.Server{
-				Addr:    fmt.Sprintf(":%s", *item),
-				Handler: router,
-			}
+	listeners, err := handler.ListenAll(servers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	bx.Println("Serving!", strings.Join(lines, "\n"))
 
-			if config.Ssl.KeyFile != "" && config.Ssl.CertFile != "" {
-				log.Fatal(server.ListenAndServeTLS(config.Ssl.CertFile, config.Ssl.KeyFile))
-			} else {
-				log.Fatal(server.ListenAndServe())
-			}
+	listener := func(server *http.Server) error {
+		if server == challenge || server == redirect {
+			return server.Serve(listeners[server])
+		}
+		if autoCert != nil || selfSigned {
+			return server.ServeTLS(listeners[server], "", "")
+		}
+		if hasCertFiles {
+			return server.ServeTLS(listeners[server], config.Ssl.CertFile, config.Ssl.KeyFile)
 		}
+		return server.Serve(listeners[server])
+	}
 
-		if idx == len(opts.Listen)-1 {
-			bx.Println("Serving!", strings.Join(lines, "\n"))
+	// Let downloads and proxied streams finish before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		// A second signal stops the process right away
+		<-ctx.Done()
+		stop()
+	}()
 
-			listener()
-		} else {
-			go listener()
-		}
+	if err := handler.RunServers(ctx, servers, listener, shutdownTimeout); err != nil {
+		log.Fatal(err)
 	}
 }
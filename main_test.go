@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jessevdk/go-flags"
+	"github.com/koblas/swerver/pkg/handler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSymlinksFlag(t *testing.T) {
+	public := t.TempDir()
+	target := filepath.Join(t.TempDir(), "target.txt")
+	assert.NoError(t, os.WriteFile(target, []byte("target"), 0o644))
+	assert.NoError(t, os.Symlink(target, filepath.Join(public, "link.txt")))
+
+	for _, item := range []struct {
+		args   []string
+		status int
+	}{
+		{[]string{public}, http.StatusNotFound},
+		{[]string{"--symlinks", public}, http.StatusOK},
+	} {
+		var opts options
+		args, err := flags.ParseArgs(&opts, item.args)
+		assert.NoError(t, err)
+
+		router, err := newRouter(applyOptions(handler.Configuration{}, opts, args), middleware.Logger)
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/link.txt", nil))
+		assert.Equal(t, item.status, w.Code, item.args)
+		if item.status == http.StatusOK {
+			assert.Equal(t, "target", w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Address the ACME HTTP-01 challenges are answered on, the certificate
+// authority always connects to port 80
+const defaultChallengeAddr = ":80"
+
+// NewAutoCert creates the manager getting certificates from Let's Encrypt,
+// nil unless ssl.autoCert is configured. Certificate files given in the
+// configuration take precedence.
+func NewAutoCert(config Configuration) (*autocert.Manager, error) {
+	settings := config.Ssl.AutoCert
+	if len(settings.Hosts) == 0 && settings.CacheDir == "" && settings.Email == "" {
+		return nil, nil
+	}
+	if config.Ssl.KeyFile != "" && config.Ssl.CertFile != "" {
+		return nil, nil
+	}
+	if len(settings.Hosts) == 0 {
+		// Without a host list anyone could have certificates issued
+		return nil, errors.New("invalid ssl.autoCert: the list of hosts is missing")
+	}
+
+	cacheDir := settings.CacheDir
+	if cacheDir == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		cacheDir = filepath.Join(dir, "swerver", "autocert")
+	}
+
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(settings.Hosts...),
+		Cache:      autocert.DirCache(cacheDir),
+		Email:      settings.Email,
+	}, nil
+}
+
+// UseAutoCert lets server take its certificates from manager, keeping the
+// client certificate settings in place
+func UseAutoCert(server *http.Server, manager *autocert.Manager) {
+	if server.TLSConfig == nil {
+		server.TLSConfig = &tls.Config{}
+	}
+	server.TLSConfig.GetCertificate = manager.GetCertificate
+	server.TLSConfig.NextProtos = append(server.TLSConfig.NextProtos, "h2", "http/1.1", acme.ALPNProto)
+}
+
+// NewChallengeServer answers the HTTP-01 challenges of manager on the
+// configured challenge address, other requests are redirected to HTTPS
+func NewChallengeServer(config Configuration, manager *autocert.Manager) *http.Server {
+	addr := config.Ssl.AutoCert.ChallengeAddr
+	if addr == "" {
+		addr = defaultChallengeAddr
+	}
+
+	return &http.Server{
+		Addr:    addr,
+		Handler: manager.HTTPHandler(HTTPSRedirect(config.Ssl.RedirectPort)),
+	}
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme"
+)
+
+func TestAutoCert(t *testing.T) {
+	manager, err := NewAutoCert(Configuration{})
+	assert.NoError(t, err)
+	assert.Nil(t, manager)
+
+	var config Configuration
+	config.Ssl.AutoCert.Hosts = []string{"example.com"}
+	config.Ssl.AutoCert.CacheDir = t.TempDir()
+
+	manager, err = NewAutoCert(config)
+	assert.NoError(t, err)
+	if assert.NotNil(t, manager) {
+		assert.NoError(t, manager.HostPolicy(context.Background(), "example.com"))
+		assert.Error(t, manager.HostPolicy(context.Background(), "other.com"))
+	}
+
+	// Certificate files win over automatic certificates
+	config.Ssl.CertFile, config.Ssl.KeyFile = "cert.pem", "key.pem"
+	manager, err = NewAutoCert(config)
+	assert.NoError(t, err)
+	assert.Nil(t, manager)
+
+	// Anyone could have certificates issued without a host list
+	config = Configuration{}
+	config.Ssl.AutoCert.Email = "admin@example.com"
+	_, err = NewAutoCert(config)
+	assert.Error(t, err)
+}
+
+func TestUseAutoCert(t *testing.T) {
+	var config Configuration
+	config.Ssl.AutoCert.Hosts = []string{"example.com"}
+	config.Ssl.AutoCert.CacheDir = t.TempDir()
+	manager, err := NewAutoCert(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &http.Server{TLSConfig: &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert}}
+	UseAutoCert(server, manager)
+	assert.NotNil(t, server.TLSConfig.GetCertificate)
+	assert.Contains(t, server.TLSConfig.NextProtos, acme.ALPNProto)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, server.TLSConfig.ClientAuth)
+
+	challenge := NewChallengeServer(config, manager)
+	assert.Equal(t, ":80", challenge.Addr)
+
+	// Anything but a challenge is sent to HTTPS
+	w := doRequest(challenge.Handler, "GET", "http://example.com/page", nil)
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "https://example.com/page", w.Header().Get("Location"))
+}
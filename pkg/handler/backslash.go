@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/koblas/swerver/pkg/trace"
+)
+
+// What happens to a request whose path has a backslash, which some
+// clients and file systems take for a separator. BackslashReject answers
+// with a 400, BackslashNormalize reads it as a slash.
+const (
+	BackslashReject    = "reject"
+	BackslashNormalize = "normalize"
+)
+
+// checkBackslashes applies the backslashes setting to r, reporting false
+// when the request was refused
+func (state HandlerState) checkBackslashes(w http.ResponseWriter, r *http.Request) bool {
+	if !strings.Contains(r.URL.Path, `\`) {
+		return true
+	}
+
+	if state.Backslashes != BackslashNormalize {
+		log.Printf("Rejected request for %q with a backslash", r.URL.Path)
+		trace.Add(r, "backslash rejected")
+		state.sendError(w, r, "/", http.StatusBadRequest)
+		return false
+	}
+
+	normalized := path.Clean("/" + strings.ReplaceAll(r.URL.Path, `\`, "/"))
+	if strings.HasSuffix(r.URL.Path, `\`) && normalized != "/" {
+		normalized += "/"
+	}
+	trace.Add(r, "backslash normalized %s", normalized)
+	r.URL.Path = normalized
+	r.URL.RawPath = ""
+
+	return true
+}
+
+// backslashMiddleware refuses or normalizes paths with a backslash before
+// anything looks at the path
+func (state HandlerState) backslashMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if state.checkBackslashes(w, r) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackslashes(t *testing.T) {
+	root := writeFiles(t, map[string]string{
+		"public/b.txt":     "b",
+		"public/a/c.txt":   "c",
+		"public/index.txt": "index",
+		"secret.txt":       "secret",
+	})
+	public := filepath.Join(root, "public")
+	escapes := []string{
+		`/..\secret.txt`,
+		`/a\..\..\secret.txt`,
+		`/%5C..%5Csecret.txt`,
+		`/a%5C..%5C..%5C..%5Csecret.txt`,
+	}
+
+	config := Configuration{Public: public}
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		for _, target := range append(escapes, `/a\..\b.txt`, `/a%5Cc.txt`) {
+			w := doRequest(handler, "GET", target, nil)
+			assert.Equal(t, http.StatusBadRequest, w.Code, target)
+			assert.NotEqual(t, "secret", w.Body.String())
+		}
+		w := doRequest(handler, "GET", "/a/c.txt", nil)
+		assert.Equal(t, "c", w.Body.String())
+	}
+
+	config.Backslashes = BackslashNormalize
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		for _, target := range escapes {
+			w := doRequest(handler, "GET", target, nil)
+			assert.NotEqual(t, http.StatusOK, w.Code, target)
+			assert.NotEqual(t, "secret", w.Body.String(), target)
+		}
+
+		w := doRequest(handler, "GET", `/a\..\b.txt`, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "b", w.Body.String())
+
+		w = doRequest(handler, "GET", `/a%5Cc.txt`, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "c", w.Body.String())
+	}
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/koblas/swerver/pkg/trace"
+)
+
+// Endpoint accepting a list of uploads and deletes when allowBatch is set
+const batchPath = "/__batch"
+
+// Most operations accepted in a single batch
+const maxBatchOperations = 100
+
+// batchOperation is a single upload (PUT) or delete (DELETE) of a batch
+type batchOperation struct {
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// batchResult is the outcome of a batchOperation, Status is the one the
+// same request on its own would have been answered with
+type batchResult struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// statusRecorder keeps the status of a response and drops its body
+type statusRecorder struct {
+	header http.Header
+	status int
+}
+
+func (rec *statusRecorder) Header() http.Header { return rec.header }
+
+func (rec *statusRecorder) Write(data []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return len(data), nil
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+// batchOperations runs every operation of a JSON list as if it had been
+// sent as its own PUT or DELETE request, carrying the headers of the batch.
+// The outcome of each is reported in a 207 Multi-Status response, one
+// failing operation doesn't stop the others.
+func (state HandlerState) batchOperations(w http.ResponseWriter, r *http.Request) {
+	if !state.writeAuthorized(r) {
+		trace.Add(r, "batch rejected %d", http.StatusUnauthorized)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		state.sendError(w, r, "/", http.StatusUnauthorized)
+		return
+	}
+
+	limit := state.MaxUploadSize
+	if limit <= 0 {
+		limit = defaultMaxUploadSize
+	}
+	operations := []batchOperation{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit)).Decode(&operations); err != nil {
+		trace.Add(r, "invalid batch")
+		state.sendError(w, r, "/", http.StatusBadRequest)
+		return
+	}
+	if len(operations) > maxBatchOperations {
+		state.sendError(w, r, "/", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	results := make([]batchResult, 0, len(operations))
+	for _, op := range operations {
+		results = append(results, state.batchOperation(r, op))
+	}
+	log.Printf("Batch of %d operations", len(operations))
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	json.NewEncoder(w).Encode(results)
+}
+
+// pathRules wraps handler in the middleware of AttachRoutes that depends on
+// the request path, so that an operation of a batch is held to the rules
+// of the path it writes to
+func (state HandlerState) pathRules(handler http.Handler) http.Handler {
+	if len(state.methodRules) != 0 {
+		handler = state.methodsMiddleware(handler)
+	}
+	if state.ipAccess != nil {
+		handler = state.ipAccessMiddleware(handler)
+	}
+
+	return handler
+}
+
+// batchOperation runs op through the upload or delete handler
+func (state HandlerState) batchOperation(r *http.Request, op batchOperation) batchResult {
+	result := batchResult{Method: strings.ToUpper(op.Method), Path: op.Path}
+
+	var handler http.HandlerFunc
+	switch result.Method {
+	case http.MethodPut:
+		handler = state.uploadFile
+	case http.MethodDelete:
+		handler = state.deleteFile
+	default:
+		result.Status = http.StatusMethodNotAllowed
+		result.Error = http.StatusText(result.Status)
+		return result
+	}
+	if !strings.HasPrefix(op.Path, "/") {
+		result.Status = http.StatusBadRequest
+		result.Error = http.StatusText(result.Status)
+		return result
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), result.Method, op.Path, strings.NewReader(op.Content))
+	if err != nil || req.URL.Path != op.Path || req.URL.RawQuery != "" {
+		result.Status = http.StatusBadRequest
+		result.Error = http.StatusText(result.Status)
+		return result
+	}
+	req.Header = r.Header.Clone()
+	req.Header.Del("Content-Length")
+	req.RemoteAddr = r.RemoteAddr
+
+	rec := &statusRecorder{header: http.Header{}}
+	state.pathRules(handler).ServeHTTP(rec, req)
+	result.Status = rec.status
+	if result.Status >= 400 {
+		result.Error = http.StatusText(result.Status)
+	}
+
+	return result
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func doBatch(handler http.Handler, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", batchPath, strings.NewReader(body))
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestBatch(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html": "index",
+		"old.txt":    "old",
+	})
+	router := newTestRouter(Configuration{
+		Public:       public,
+		AllowUploads: true,
+		AllowBatch:   true,
+		UploadToken:  "secret",
+	})
+	auth := map[string]string{"Authorization": "Bearer secret"}
+
+	w := doBatch(router, `[{"method":"PUT","path":"/new.txt","content":"new"}]`, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = doBatch(router, `{"method":"PUT"}`, auth)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doBatch(router, `[
+		{"method":"PUT","path":"/new.txt","content":"new"},
+		{"method":"DELETE","path":"/old.txt"},
+		{"method":"DELETE","path":"/missing.txt"},
+		{"method":"PUT","path":"/../escape.txt","content":"x"},
+		{"method":"GET","path":"/index.html"}
+	]`, auth)
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	results := []batchResult{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &results))
+	statuses := []int{}
+	for _, item := range results {
+		statuses = append(statuses, item.Status)
+	}
+	assert.Equal(t, []int{
+		http.StatusCreated,
+		http.StatusNoContent,
+		http.StatusNotFound,
+		http.StatusBadRequest,
+		http.StatusMethodNotAllowed,
+	}, statuses)
+	assert.Equal(t, "/old.txt", results[1].Path)
+	assert.Equal(t, "", results[0].Error)
+	assert.Equal(t, "Not Found", results[2].Error)
+
+	data, err := os.ReadFile(filepath.Join(public, "new.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "new", string(data))
+	_, err = os.Stat(filepath.Join(public, "old.txt"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(filepath.Dir(public), "escape.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestBatchDisabled(t *testing.T) {
+	public := writeFiles(t, map[string]string{"index.html": "index"})
+
+	w := doBatch(newTestRouter(Configuration{Public: public, AllowUploads: true}), `[]`, nil)
+	assert.NotEqual(t, http.StatusMultiStatus, w.Code)
+}
+
+func TestBatchPathRules(t *testing.T) {
+	public := writeFiles(t, map[string]string{"index.html": "index"})
+	router := newTestRouter(Configuration{
+		Public:       public,
+		AllowUploads: true,
+		AllowBatch:   true,
+		IPAccess:     ConfigIPAccess{Deny: []string{"192.0.2.1"}, Paths: []string{"/admin/**"}},
+		Methods:      []ConfigMethods{{Source: "/static/**", Methods: []string{"GET", "HEAD"}}},
+	})
+
+	req := httptest.NewRequest("PUT", "/admin/x.txt", strings.NewReader("x"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// The same writes in a batch are refused as well
+	w = doBatch(router, `[
+		{"method":"PUT","path":"/admin/x.txt","content":"x"},
+		{"method":"PUT","path":"/static/x.txt","content":"x"},
+		{"method":"PUT","path":"/x.txt","content":"x"}
+	]`, nil)
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+
+	results := []batchResult{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &results))
+	statuses := []int{}
+	for _, item := range results {
+		statuses = append(statuses, item.Status)
+	}
+	assert.Equal(t, []int{http.StatusForbidden, http.StatusMethodNotAllowed, http.StatusCreated}, statuses)
+	assert.NoFileExists(t, filepath.Join(public, "admin", "x.txt"))
+	assert.NoFileExists(t, filepath.Join(public, "static", "x.txt"))
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/koblas/swerver/pkg/trace"
+)
+
+type blockRule struct {
+	key       string
+	pattern   *regexp.Regexp
+	maxLength int
+}
+
+// compileBlockRules turns the blockHeaders and blockUserAgents configuration
+// into a list of rules, a user agent entry is a pattern on the User-Agent header.
+func compileBlockRules(config Configuration) ([]blockRule, error) {
+	rules := []blockRule{}
+
+	for _, item := range config.BlockHeaders {
+		rule := blockRule{
+			key:       http.CanonicalHeaderKey(item.Key),
+			maxLength: item.MaxLength,
+		}
+		if item.Pattern != "" {
+			pattern, err := regexp.Compile(item.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid blockHeaders pattern for %s: %v", item.Key, err)
+			}
+			rule.pattern = pattern
+		}
+		rules = append(rules, rule)
+	}
+	for _, agent := range config.BlockUserAgents {
+		pattern, err := regexp.Compile(agent)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blockUserAgents pattern: %v", err)
+		}
+		rules = append(rules, blockRule{
+			key:     "User-Agent",
+			pattern: pattern,
+		})
+	}
+
+	return rules, nil
+}
+
+func (rule blockRule) matches(r *http.Request) bool {
+	for _, value := range r.Header.Values(rule.key) {
+		if rule.maxLength > 0 && len(value) > rule.maxLength {
+			return true
+		}
+		if rule.pattern != nil && rule.pattern.MatchString(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// blockMiddleware rejects requests carrying a suspicious header before
+// any other processing happens
+func (state HandlerState) blockMiddleware(next http.Handler) http.Handler {
+	status := state.BlockStatus
+	if status == 0 {
+		status = http.StatusForbidden
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, rule := range state.blockRules {
+			if rule.matches(r) {
+				log.Printf("Blocked request for %s on header %s", r.URL.Path, rule.key)
+				trace.Add(r, "blocked on %s", rule.key)
+				state.sendError(w, r, "/", status)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockUserAgent(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html": "<h1>hello</h1>",
+	})
+
+	router := newTestRouter(Configuration{
+		Public:          public,
+		BlockUserAgents: []string{"(?i)badbot"},
+	})
+
+	w := doRequest(router, "GET", "/", map[string]string{"User-Agent": "Mozilla/5.0 BadBot/1.0"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Forbidden")
+	assert.Contains(t, w.Body.String(), "GET /")
+
+	w = doRequest(router, "GET", "/", map[string]string{"User-Agent": "Mozilla/5.0 Firefox/99"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "hello")
+}
+
+func TestBlockHeaders(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html": "<h1>hello</h1>",
+	})
+
+	router := newTestRouter(Configuration{
+		Public:       public,
+		BlockHeaders: []ConfigBlockHeader{{Key: "cookie", MaxLength: 16}},
+		BlockStatus:  http.StatusBadRequest,
+	})
+
+	w := doRequest(router, "GET", "/", map[string]string{"Cookie": strings.Repeat("a", 17)})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(router, "GET", "/", map[string]string{"Accept": "application/json", "Cookie": strings.Repeat("a", 17)})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"bad_request"`)
+
+	w = doRequest(router, "GET", "/", map[string]string{"Cookie": "a=b"})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/koblas/swerver/pkg/swhttp"
+	"github.com/koblas/swerver/pkg/trace"
+)
+
+// Characters making a part of a bundle input a glob
+const globChars = "*?[{(!+@"
+
+// bundleCache keeps the last concatenation of every bundle, it is valid as
+// long as the same inputs are found unchanged
+type bundleCache struct {
+	mu      sync.Mutex
+	entries map[string]bundle
+}
+
+type bundle struct {
+	inputs  []bundleInput
+	data    []byte
+	etag    string
+	modTime time.Time
+}
+
+type bundleInput struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+// newBundleCache checks the bundles configuration, nil when there are no
+// bundles
+func newBundleCache(bundles map[string][]string) (*bundleCache, error) {
+	if len(bundles) == 0 {
+		return nil, nil
+	}
+
+	for name, inputs := range bundles {
+		if !strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") || path.Clean(name) != name {
+			return nil, fmt.Errorf("invalid bundle path %q", name)
+		}
+		if len(inputs) == 0 {
+			return nil, fmt.Errorf("no inputs for bundle %s", name)
+		}
+	}
+
+	return &bundleCache{entries: map[string]bundle{}}, nil
+}
+
+// bundleInputs lists the files of the bundle in order, the files matching
+// an input glob are taken in lexical order and a file matching several
+// inputs is only taken once. Only regular files are bundled.
+func (state HandlerState) bundleInputs(name string) ([]bundleInput, error) {
+	inputs := []bundleInput{}
+	seen := map[string]bool{}
+
+	add := func(file string, info fs.FileInfo) {
+		if !seen[file] && info.Mode().IsRegular() {
+			seen[file] = true
+			inputs = append(inputs, bundleInput{file, info.Size(), info.ModTime()})
+		}
+	}
+
+	for _, glob := range state.Bundles[name] {
+		glob = slasher(glob)
+
+		// The files are looked for below the part without magic
+		parts := strings.Split(glob, "/")
+		static := 0
+		for static < len(parts) && !strings.ContainsAny(parts[static], globChars) {
+			static++
+		}
+
+		if static == len(parts) {
+			info, err := os.Lstat(filepath.Join(state.Public, filepath.FromSlash(glob)))
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			add(glob, info)
+			continue
+		}
+
+		base := path.Join("/", strings.Join(parts[:static], "/"))
+		root := filepath.Join(state.Public, filepath.FromSlash(base))
+		_, err := state.walkTree(root, func(relative string, d fs.DirEntry) error {
+			file := path.Join(base, relative)
+			if d.IsDir() || !matchesAny(file, []string{glob}) {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			add(file, info)
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	return inputs, nil
+}
+
+// sameInputs tells if the files of a bundle are unchanged
+func sameInputs(a, b []bundleInput) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].name != b[i].name || a[i].size != b[i].size || !a[i].modTime.Equal(b[i].modTime) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// loadBundle returns the concatenation of the inputs of the bundle, built
+// again when one of them changed
+func (state HandlerState) loadBundle(name string) (bundle, error) {
+	inputs, err := state.bundleInputs(name)
+	if err != nil {
+		return bundle{}, err
+	}
+
+	cache := state.bundles
+	cache.mu.Lock()
+	cached, found := cache.entries[name]
+	cache.mu.Unlock()
+	if found && sameInputs(cached.inputs, inputs) {
+		return cached, nil
+	}
+
+	result := bundle{inputs: inputs}
+	buf := bytes.Buffer{}
+	for _, input := range inputs {
+		data, err := os.ReadFile(filepath.Join(state.Public, filepath.FromSlash(input.name)))
+		if err != nil {
+			return bundle{}, err
+		}
+		buf.Write(data)
+		// Keep a last line without a newline from running into the
+		// first line of the next file
+		if len(data) != 0 && data[len(data)-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+		if input.modTime.After(result.modTime) {
+			result.modTime = input.modTime
+		}
+	}
+	result.data = buf.Bytes()
+	sum := sha256.Sum256(result.data)
+	result.etag = fmt.Sprintf(`"%x"`, sum[:16])
+
+	cache.mu.Lock()
+	cache.entries[name] = result
+	cache.mu.Unlock()
+
+	return result, nil
+}
+
+// serveBundle answers a bundle path with the concatenation of its inputs,
+// a bundle without any input found gets a 404
+func (state HandlerState) serveBundle(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Path
+
+	result, err := state.loadBundle(name)
+	if err != nil {
+		log.Printf("Unable to bundle %s: %v", name, err)
+		state.sendStatError(w, r, err)
+		return
+	}
+	if len(result.inputs) == 0 {
+		state.sendError(w, r, "/", http.StatusNotFound)
+		return
+	}
+
+	trace.Add(r, "bundle %s of %d files", name, len(result.inputs))
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	}
+	w.Header().Set("ETag", result.etag)
+	state.cacheControlHeader(w, name)
+	swhttp.ServeContent(w, r, name, result.modTime, bytes.NewReader(result.data))
+}
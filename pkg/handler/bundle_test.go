@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBundles(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"css/b.css":        "b {}\n",
+		"css/a.css":        "a {}\n",
+		"css/reset.css":    "* {}",
+		"css/vendor/x.css": "x {}\n",
+		"js/app.js":        "app()\n",
+	})
+	config := Configuration{
+		Public: public,
+		Bundles: map[string][]string{
+			"/bundle.css": {"/css/reset.css", "/css/*.css"},
+			"/bundle.js":  {"/js/**/*.js"},
+			"/empty.js":   {"/none/*.js"},
+		},
+	}
+
+	router := newTestRouter(config)
+	w := doRequest(router, "GET", "/bundle.css", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "* {}\na {}\nb {}\n", w.Body.String())
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/css")
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	w = doRequest(router, "GET", "/bundle.css", map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	w = doRequest(router, "GET", "/bundle.js", nil)
+	assert.Equal(t, "app()\n", w.Body.String())
+	assert.Contains(t, w.Header().Get("Content-Type"), "javascript")
+
+	w = doRequest(router, "GET", "/empty.js", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Changing, adding and removing inputs rebuilds the bundle
+	w = doRequest(router, "GET", "/bundle.css", nil)
+	etag = w.Header().Get("ETag")
+
+	file := filepath.Join(public, "css", "a.css")
+	assert.Nil(t, os.WriteFile(file, []byte("a { color: red }\n"), 0o644))
+	later := time.Now().Add(time.Minute)
+	assert.Nil(t, os.Chtimes(file, later, later))
+	w = doRequest(router, "GET", "/bundle.css", nil)
+	assert.Equal(t, "* {}\na { color: red }\nb {}\n", w.Body.String())
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+
+	assert.Nil(t, os.WriteFile(filepath.Join(public, "css", "c.css"), []byte("c {}\n"), 0o644))
+	assert.Nil(t, os.Remove(filepath.Join(public, "css", "b.css")))
+	w = doRequest(router, "GET", "/bundle.css", nil)
+	assert.Equal(t, "* {}\na { color: red }\nc {}\n", w.Body.String())
+}
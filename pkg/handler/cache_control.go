@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// compileExtensionCache normalizes the extensionCache keys to a lower case
+// extension with its leading dot
+func compileExtensionCache(ttls map[string]int) (map[string]int, error) {
+	result := map[string]int{}
+
+	for ext, ttl := range ttls {
+		if ttl < 0 {
+			return nil, fmt.Errorf("invalid extensionCache TTL %d for %s", ttl, ext)
+		}
+		result["."+strings.TrimPrefix(strings.ToLower(ext), ".")] = ttl
+	}
+
+	return result, nil
+}
+
+// cacheControlHeader sets the Cache-Control of the first cacheControl rule
+// matching the file name, or the max-age of its extension, unless the
+// response already carries one. Matching headers rules are applied later
+// and override it.
+func (state HandlerState) cacheControlHeader(w http.ResponseWriter, name string) {
+	if w.Header().Get("Cache-Control") != "" {
+		return
+	}
+
+	for _, rule := range state.CacheControl {
+		if ok, _, _ := sourceMatches(rule.Source, name, false); ok {
+			w.Header().Set("Cache-Control", rule.Value)
+			return
+		}
+	}
+
+	if ttl, found := state.extensionCache[strings.ToLower(path.Ext(name))]; found {
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", ttl))
+	}
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheControl(t *testing.T) {
+	config, err := ReadServeConfiguration(strings.NewReader(`{
+		"cacheControl": [
+			{"source": "**/*.*.js", "value": "max-age=31536000, immutable"},
+			{"source": "**/*.html", "value": "no-cache"}
+		],
+		"headers": [
+			{"source": "/legacy/**", "headers": [{"key": "Cache-Control", "value": "max-age=60"}]}
+		],
+		"noCachePaths": ["/status.*.js"]
+	}`))
+	assert.Nil(t, err)
+	config.Public = writeFiles(t, map[string]string{
+		"index.html":            "index",
+		"assets/main.abc123.js": "main",
+		"assets/app.js":         "app",
+		"legacy/old.abc123.js":  "old",
+		"status.abc123.js":      "status",
+	})
+	router := newTestRouter(config)
+
+	w := doRequest(router, "GET", "/assets/main.abc123.js", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "max-age=31536000, immutable", w.Header().Get("Cache-Control"))
+
+	// Also sent when the client has the file already
+	w = doRequest(router, "GET", "/assets/main.abc123.js", map[string]string{"If-None-Match": w.Header().Get("Etag")})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, "max-age=31536000, immutable", w.Header().Get("Cache-Control"))
+
+	w = doRequest(router, "GET", "/", nil)
+	assert.Equal(t, "index", w.Body.String())
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+
+	w = doRequest(router, "GET", "/assets/app.js", nil)
+	assert.Empty(t, w.Header().Get("Cache-Control"))
+
+	// headers rules and noCachePaths are not clobbered
+	w = doRequest(router, "GET", "/legacy/old.abc123.js", nil)
+	assert.Equal(t, "max-age=60", w.Header().Get("Cache-Control"))
+
+	w = doRequest(router, "GET", "/status.abc123.js", nil)
+	assert.Equal(t, "no-cache, no-store, must-revalidate", w.Header().Get("Cache-Control"))
+}
+
+func TestExtensionCache(t *testing.T) {
+	config, err := ReadServeConfiguration(strings.NewReader(`{
+		"extensionCache": {".html": 0, ".css": 3600, "js": 3600, ".PNG": 604800},
+		"cacheControl": [
+			{"source": "**/*.*.js", "value": "max-age=31536000, immutable"}
+		]
+	}`))
+	assert.Nil(t, err)
+	config.Public = writeFiles(t, map[string]string{
+		"index.html":    "index",
+		"site.css":      "css",
+		"app.js":        "app",
+		"app.abc123.js": "app",
+		"logo.png":      "png",
+		"photo.PNG":     "png",
+		"notes.txt":     "notes",
+		"LICENSE":       "license",
+	})
+	router := newTestRouter(config)
+
+	for target, expected := range map[string]string{
+		"/":              "max-age=0",
+		"/site.css":      "max-age=3600",
+		"/app.js":        "max-age=3600",
+		"/logo.png":      "max-age=604800",
+		"/photo.PNG":     "max-age=604800",
+		"/app.abc123.js": "max-age=31536000, immutable",
+		"/notes.txt":     "",
+		"/LICENSE":       "",
+	} {
+		w := doRequest(router, "GET", target, nil)
+		assert.Equal(t, http.StatusOK, w.Code, target)
+		assert.Equal(t, expected, w.Header().Get("Cache-Control"), target)
+	}
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"bytes"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/koblas/swerver/pkg/swhttp"
+	"github.com/koblas/swerver/pkg/trace"
+)
+
+// Compression level used for on the fly compression
+const compressionLevel = 5
+
+// varyMiddleware consolidates every header the response was negotiated on
+// into a single Vary header just before the headers are sent. It has to
+// wrap the compression middleware, which overwrites any prior Vary header.
+func (state HandlerState) varyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = swhttp.WithVary(r)
+
+		hook := &hookWriter{
+			ResponseWriter: w,
+			before: func(w http.ResponseWriter, status int) {
+				swhttp.FinalizeVary(w.Header(), r)
+			},
+		}
+
+		next.ServeHTTP(hook, r)
+	})
+}
+
+// compressMiddleware compresses responses unless the path is excluded by
+// noCompressPaths
+func (state HandlerState) compressMiddleware(next http.Handler) http.Handler {
+	compressed := middleware.Compress(compressionLevel)(next)
+
+	if len(state.NoCompressPaths) == 0 {
+		return compressed
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !matchesAny(r.URL.Path, state.NoCompressPaths) {
+			compressed.ServeHTTP(w, r)
+			return
+		}
+
+		// Dropping the header also keeps the compression cache and
+		// proxied upstreams from answering with an encoded body
+		trace.Add(r, "compression disabled by noCompressPaths")
+		r.Header.Del("Accept-Encoding")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// dictionaryWriter holds back JSON bodies so they can be sent compressed
+// against the shared dictionary once complete
+type dictionaryWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	dictionary  *swhttp.BrotliDictionary
+	accepted    bool
+	status      int
+	body        *bytes.Buffer
+	wroteHeader bool
+}
+
+func (w *dictionaryWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if mediaType == "application/json" && w.Header().Get("Content-Encoding") == "" {
+		swhttp.AddVary(w, w.r, "Accept-Encoding", "Available-Dictionary")
+
+		bodyless := status == http.StatusNoContent || status == http.StatusNotModified || w.r.Method == http.MethodHead
+		if w.accepted && !bodyless {
+			w.status = status
+			w.body = &bytes.Buffer{}
+			return
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *dictionaryWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.body != nil {
+		return w.body.Write(b)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *dictionaryWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.body != nil {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// finish sends the held back body
+func (w *dictionaryWriter) finish() {
+	if w.body == nil {
+		return
+	}
+
+	trace.Add(w.r, "compressed with the brotli dictionary")
+	w.Header().Set("Content-Encoding", "dcb")
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	if err := w.dictionary.Encode(w.ResponseWriter, w.body.Bytes()); err != nil {
+		log.Printf("Unable to send %s compressed with the brotli dictionary: %s", w.r.URL.Path, err)
+	}
+}
+
+// dictionaryMiddleware compresses JSON responses against brotliDictionary
+// for the clients holding it, it has to run inside the compression
+// middleware which leaves responses with a Content-Encoding alone.
+func (state HandlerState) dictionaryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dw := &dictionaryWriter{
+			ResponseWriter: w,
+			r:              r,
+			dictionary:     state.dictionary,
+			accepted:       state.dictionary.Accepted(r),
+		}
+
+		next.ServeHTTP(dw, r)
+		dw.finish()
+	})
+}
+
+// attachCompression registers the on the fly compression of responses
+func (state HandlerState) attachCompression(router chi.Router) {
+	router.Use(state.varyMiddleware)
+
+	if !state.NoCompression {
+		router.Use(state.compressMiddleware)
+	}
+	if state.dictionary != nil {
+		router.Use(state.dictionaryMiddleware)
+	}
+}
@@ -0,0 +1,330 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVaryConsolidated(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"about.html":    "<h1>about</h1>",
+		"about.fr.html": "<h1>à propos</h1>",
+	})
+	router := newTestRouter(Configuration{
+		Public:              public,
+		LanguageNegotiation: true,
+	})
+
+	w := doRequest(router, "GET", "/about", map[string]string{
+		"Accept-Encoding": "gzip",
+		"Accept-Language": "fr",
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, []string{"Accept-Encoding, Accept-Language"}, w.Header().Values("Vary"))
+
+	w = doRequest(router, "GET", "/about", map[string]string{"Accept-Language": "fr"})
+	assert.Equal(t, []string{"Accept-Language"}, w.Header().Values("Vary"))
+}
+
+func gunzip(t *testing.T, data []byte) string {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestCompressionCacheDir(t *testing.T) {
+	content := strings.Repeat("body { color: red; }\n", 100)
+	public := writeFiles(t, map[string]string{
+		"site.css":  content,
+		"image.png": "\x89PNG",
+	})
+	cacheDir := filepath.Join(t.TempDir(), "compressed")
+	router := newTestRouter(Configuration{Public: public, CompressionCacheDir: cacheDir})
+	gzipped := map[string]string{"Accept-Encoding": "gzip"}
+
+	w := doRequest(router, "GET", "/site.css", gzipped)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "MISS", w.Header().Get("X-Compression-Cache"))
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "text/css; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, content, gunzip(t, w.Body.Bytes()))
+
+	entries, _ := os.ReadDir(cacheDir)
+	assert.Equal(t, 1, len(entries))
+
+	w = doRequest(router, "GET", "/site.css", gzipped)
+	assert.Equal(t, "HIT", w.Header().Get("X-Compression-Cache"))
+	assert.Equal(t, content, gunzip(t, w.Body.Bytes()))
+	assert.Equal(t, []string{"Accept-Encoding"}, w.Header().Values("Vary"))
+
+	// The age of a hit is counted from when the copy was written
+	assert.Equal(t, "0", w.Header().Get("Age"))
+	earlier := time.Now().Add(-90 * time.Second)
+	if err := os.Chtimes(filepath.Join(cacheDir, entries[0].Name()), earlier, earlier); err != nil {
+		t.Fatal(err)
+	}
+	w = doRequest(router, "GET", "/site.css", gzipped)
+	assert.Equal(t, "HIT", w.Header().Get("X-Compression-Cache"))
+	assert.Equal(t, "90", w.Header().Get("Age"))
+	assert.NotEmpty(t, w.Header().Get("Date"))
+
+	// A changed file replaces the compressed copy
+	later := time.Now().Add(time.Minute)
+	if err := os.WriteFile(filepath.Join(public, "site.css"), []byte("p {}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(public, "site.css"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	w = doRequest(router, "GET", "/site.css", gzipped)
+	assert.Equal(t, "MISS", w.Header().Get("X-Compression-Cache"))
+	assert.Equal(t, "p {}", gunzip(t, w.Body.Bytes()))
+	entries, _ = os.ReadDir(cacheDir)
+	assert.Equal(t, 1, len(entries))
+
+	w = doRequest(router, "GET", "/site.css", nil)
+	assert.Empty(t, w.Header().Get("X-Compression-Cache"))
+	assert.Equal(t, "p {}", w.Body.String())
+
+	w = doRequest(router, "GET", "/image.png", gzipped)
+	assert.Empty(t, w.Header().Get("X-Compression-Cache"))
+	assert.Equal(t, "\x89PNG", w.Body.String())
+}
+
+func TestNoCompressPaths(t *testing.T) {
+	content := strings.Repeat("body { color: red; }\n", 100)
+	public := writeFiles(t, map[string]string{
+		"site.css":        content,
+		"legacy/site.css": content,
+	})
+	router := newTestRouter(Configuration{
+		Public:              public,
+		NoCompressPaths:     []string{"/legacy/**"},
+		CompressionCacheDir: filepath.Join(t.TempDir(), "compressed"),
+	})
+	gzipped := map[string]string{"Accept-Encoding": "gzip"}
+
+	w := doRequest(router, "GET", "/legacy/site.css", gzipped)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, content, w.Body.String())
+
+	w = doRequest(router, "GET", "/site.css", gzipped)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, content, gunzip(t, w.Body.Bytes()))
+}
+
+func TestDecompressGzip(t *testing.T) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte(`{"name":"data"}`))
+	writer.Close()
+
+	public := writeFiles(t, map[string]string{
+		"data.json.gz": compressed.String(),
+	})
+
+	w := doRequest(newTestRouter(Configuration{Public: public, DecompressGzip: true}), "GET", "/data.json", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"name":"data"}`, w.Body.String())
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+
+	// The archive itself is still served as is
+	w = doRequest(newTestRouter(Configuration{Public: public, DecompressGzip: true}), "GET", "/data.json.gz", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, compressed.String(), w.Body.String())
+
+	w = doRequest(newTestRouter(Configuration{Public: public}), "GET", "/data.json", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestPrecompressed(t *testing.T) {
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write([]byte("console.log('gzip')"))
+	gz.Close()
+
+	public := writeFiles(t, map[string]string{
+		"app.js":       "console.log('plain')",
+		"app.js.br":    "brotli bytes",
+		"app.js.gz":    gzipped.String(),
+		"lib.js":       "console.log('plain')",
+		"lib.js.gz":    gzipped.String(),
+		"stale.js":     "console.log('plain')",
+		"stale.js.br":  "brotli bytes",
+		"plain.txt.br": "brotli bytes",
+	})
+	modified := time.Now().Add(-time.Hour)
+	for _, name := range []string{"app.js", "app.js.br", "app.js.gz", "lib.js", "lib.js.gz", "stale.js"} {
+		if err := os.Chtimes(filepath.Join(public, name), modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chtimes(filepath.Join(public, "stale.js.br"), modified.Add(-time.Hour), modified.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	router := newTestRouter(Configuration{Public: public})
+
+	// Brotli is preferred when both are accepted
+	w := doRequest(router, "GET", "/app.js", map[string]string{"Accept-Encoding": "gzip, br"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "br", w.Header().Get("Content-Encoding"))
+	assert.Contains(t, w.Header().Get("Content-Type"), "javascript")
+	assert.Equal(t, "brotli bytes", w.Body.String())
+	assert.Contains(t, w.Header().Get("Vary"), "Accept-Encoding")
+	assert.Regexp(t, `-br"$`, w.Header().Get("Etag"))
+
+	w = doRequest(router, "GET", "/app.js", map[string]string{"Accept-Encoding": "gzip"})
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "console.log('gzip')", gunzip(t, w.Body.Bytes()))
+
+	w = doRequest(router, "GET", "/lib.js", map[string]string{"Accept-Encoding": "gzip, br"})
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "console.log('gzip')", gunzip(t, w.Body.Bytes()))
+
+	w = doRequest(router, "GET", "/app.js", nil)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "console.log('plain')", w.Body.String())
+	assert.Contains(t, w.Header().Get("Vary"), "Accept-Encoding")
+
+	w = doRequest(router, "GET", "/stale.js", map[string]string{"Accept-Encoding": "br"})
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "console.log('plain')", w.Body.String())
+
+	// Only the sibling of a file that exists is used
+	w = doRequest(router, "GET", "/plain.txt", map[string]string{"Accept-Encoding": "br"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	router = newTestRouter(Configuration{Public: public, NoCompression: true})
+	w = doRequest(router, "GET", "/app.js", map[string]string{"Accept-Encoding": "gzip, br"})
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "console.log('plain')", w.Body.String())
+}
+
+// undictionary turns a dcb body into a plain brotli stream decoding to the
+// dictionary followed by the body, by inserting the dictionary as an
+// uncompressed meta-block after the stream header. The meta-block is a
+// whole number of bytes long only counting the header, so what follows is
+// shifted by half a byte.
+func undictionary(t *testing.T, dict, body []byte) []byte {
+	assert.True(t, len(dict) > 0 && len(dict) <= 1<<16)
+	assert.True(t, len(body) > 0)
+
+	var out []byte
+	var acc uint64
+	var bits uint
+	put := func(value uint64, n uint) {
+		acc |= value << bits
+		for bits += n; bits >= 8; bits -= 8 {
+			out = append(out, byte(acc))
+			acc >>= 8
+		}
+	}
+
+	// Window bits from the original stream header, then a meta-block that
+	// is not the last one, with four length nibbles and stored uncompressed
+	put(uint64(body[0]&0xf), 4)
+	put(0, 1)
+	put(0, 2)
+	put(uint64(len(dict)-1), 16)
+	put(1, 1)
+	out = append(out, dict...)
+
+	put(uint64(body[0]>>4), 4)
+	for _, b := range body[1:] {
+		put(uint64(b), 8)
+	}
+	// The stream ends with the set ISLAST and ISEMPTY bits, what is left
+	// over past them is padding
+	if bits > 0 && acc != 0 {
+		out = append(out, byte(acc))
+	}
+
+	return out
+}
+
+func TestBrotliDictionary(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"docs/a.txt": "a",
+		"docs/b.txt": "b",
+	})
+	dict := []byte(`{"directory":"/docs/","breadcrumbs":[{"url":"/","name":""}],"files":[{"name":"","url":"/docs/","isDir":false}]}` +
+		`{"error":{"code":"not_found","message":"The requested path could not be found"}}`)
+	dictFile := filepath.Join(t.TempDir(), "json.dict")
+	assert.NoError(t, os.WriteFile(dictFile, dict, 0o644))
+
+	router := newTestRouter(Configuration{
+		Public:           public,
+		BrotliDictionary: dictFile,
+	})
+
+	hash := sha256.Sum256(dict)
+	headers := map[string]string{
+		"Accept":               "application/json",
+		"Accept-Encoding":      "gzip, br, dcb",
+		"Available-Dictionary": ":" + base64.StdEncoding.EncodeToString(hash[:]) + ":",
+	}
+
+	for _, tc := range []struct {
+		target string
+		status int
+	}{
+		{"/docs/", http.StatusOK},
+		{"/missing.txt", http.StatusNotFound},
+	} {
+		w := doRequest(router, "GET", tc.target, headers)
+		assert.Equal(t, tc.status, w.Code, tc.target)
+		assert.Equal(t, "dcb", w.Header().Get("Content-Encoding"), tc.target)
+		assert.Equal(t, []string{"Accept-Encoding, Available-Dictionary"}, w.Header().Values("Vary"), tc.target)
+
+		body := w.Body.Bytes()
+		if !assert.True(t, len(body) > 36, tc.target) {
+			continue
+		}
+		assert.Equal(t, []byte{0xff, 0x44, 0x43, 0x42}, body[:4], tc.target)
+		assert.Equal(t, hash[:], body[4:36], tc.target)
+
+		decoded, err := io.ReadAll(brotli.NewReader(bytes.NewReader(undictionary(t, dict, body[36:]))))
+		assert.NoError(t, err, tc.target)
+		assert.True(t, bytes.HasPrefix(decoded, dict), tc.target)
+		assert.True(t, json.Valid(decoded[len(dict):]), tc.target)
+	}
+
+	// Clients without the dictionary get the usual compression
+	w := doRequest(router, "GET", "/docs/", map[string]string{
+		"Accept":          "application/json",
+		"Accept-Encoding": "gzip, dcb",
+	})
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.True(t, json.Valid([]byte(gunzip(t, w.Body.Bytes()))))
+
+	// Responses other than JSON are left to the usual compression
+	w = doRequest(router, "GET", "/docs/a.txt", headers)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "a", gunzip(t, w.Body.Bytes()))
+
+	_, err := NewHandler(Configuration{Public: public, BrotliDictionary: filepath.Join(public, "missing.dict")})
+	assert.Error(t, err)
+}
@@ -3,6 +3,96 @@ package handler
 type ConfigRewrite = struct {
 	Source      string `json:"source" validate:"min=1"`
 	Destination string `json:"destination" validate:"min=1"`
+	// Match the source against "path?query"
+	MatchQuery bool `json:"matchQuery"`
+}
+
+type ConfigProxy = struct {
+	Source      string `json:"source" validate:"min=1"`
+	Destination string `json:"destination" validate:"min=1"`
+	// Proxy the source with and without a trailing slash, always adding
+	// (true) or removing (false) it on the destination
+	TrailingSlash *bool `json:"trailingSlash"`
+}
+
+type ConfigRedirect = struct {
+	Source      string `json:"source" validate:"min=1"`
+	Destination string `json:"destination" validate:"min=1"`
+	// Status of the redirect (301, 302, 303, 307 or 308), 307 by default
+	Type int `json:"type"`
+	// Match the source against "path?query"
+	MatchQuery bool `json:"matchQuery"`
+}
+
+type ConfigHeader = struct {
+	Key string `json:"key" validate:"min=1,max=128"`
+	// An empty (or null) value removes the header
+	Value string `json:"value" validate:"max=2048"`
+}
+
+type ConfigHeaders = struct {
+	Source  string         `json:"source" validate:"min=1,max=100"`
+	Headers []ConfigHeader `json:"headers"`
+}
+
+type ConfigMethods = struct {
+	Source string `json:"source" validate:"min=1,max=100"`
+	// Methods allowed on the matching paths, GET implies HEAD
+	Methods []string `json:"methods" validate:"min=1"`
+}
+
+type ConfigCacheControl = struct {
+	Source string `json:"source" validate:"min=1,max=100"`
+	// Cache-Control sent with the matching files
+	Value string `json:"value" validate:"min=1,max=2048"`
+}
+
+type ConfigBlockHeader = struct {
+	Key string `json:"key" validate:"min=1"`
+	// Regular expression matched against the header value
+	Pattern string `json:"pattern"`
+	// Reject values longer than this many bytes
+	MaxLength int `json:"maxLength"`
+}
+
+type ConfigPreload = struct {
+	Href string `json:"href" validate:"min=1"`
+	// Destination type of the resource, e.g. script, style, font
+	As string `json:"as"`
+}
+
+type ConfigIPAccess = struct {
+	// Client addresses or CIDR ranges let in, empty lets everyone in
+	Allow []string `json:"allow"`
+	// Client addresses or CIDR ranges refused, even when allowed
+	Deny []string `json:"deny"`
+	// Path globs the rules apply to, empty covers every path
+	Paths []string `json:"paths"`
+	// Proxies whose X-Forwarded-For header names the client
+	TrustedProxies []string `json:"trustedProxies"`
+}
+
+type ConfigAutoCert = struct {
+	// Host names certificates are requested for, required
+	Hosts []string `json:"hosts"`
+	// Directory keeping the account key and certificates
+	CacheDir string `json:"cacheDir"`
+	// Contact address for the certificate authority
+	Email string `json:"email"`
+	// Address answering the HTTP-01 challenges, ":80" by default
+	ChallengeAddr string `json:"challengeAddr"`
+}
+
+type ConfigHealth = struct {
+	// Path of the liveness endpoint, "/healthz" by default
+	Path string `json:"path"`
+	// Path of the readiness endpoint, which also checks the public
+	// directory can be read, empty disables it
+	ReadyPath string `json:"readyPath"`
+	// Leave the health paths to the public directory
+	Disabled bool `json:"disabled"`
+	// Answer the health paths even when a file exists there
+	Override bool `json:"override"`
 }
 
 type Configuration = struct {
@@ -12,35 +102,210 @@ type Configuration = struct {
 	NoCleanUrls bool
 	CleanUrls   []string `json:"cleanUrls"`
 
-	Rewrites []ConfigRewrite `json:"rewrites"`
-	Proxy    []struct {
-		Source      string `json:"source" validate:"min=1"`
-		Destination string `json:"destination" validate:"min=1"`
-	} `json:"proxy"`
-	Redirects []struct {
-		Source      string `json:"source" validate:"min=1"`
-		Destination string `json:"destination" validate:"min=1"`
-		Type        int    `json:"type"`
-	} `json:"redirects"`
-
-	Headers []struct {
-		Source  string `json:"source" validate:"min=1,max=100"`
-		Headers []struct {
-			Key   string `json:"key" validate:"min=1,max=128,"`
-			Value string `json:"value" validate:"min=1,max=2048,"`
-		}
-	} `json:"headers"`
+	Rewrites  []ConfigRewrite  `json:"rewrites"`
+	Proxy     []ConfigProxy    `json:"proxy"`
+	Redirects []ConfigRedirect `json:"redirects"`
+
+	Headers            []ConfigHeaders `json:"headers"`
 	NoDirectoryListing bool
 	DirectoryListing   []string `json:"directoryListing"`
 	Unlisted           []string `json:"unlisted"`
-	TrailingSlash      bool     `json:"trailingSlash"`
-	RenderSingle       bool     `json:"renderSingle"`
-	Symlinks           bool     `json:"symlinks"`
-	Ssl                struct {
+	NoTrailingSlash    bool
+	TrailingSlash      bool `json:"trailingSlash"`
+	RenderSingle       bool `json:"renderSingle"`
+	Symlinks           bool `json:"symlinks"`
+	// In-memory file cache limit in bytes, zero disables the cache
+	CacheSize int64 `json:"cacheSize"`
+	// Files to load into the in-memory cache at startup
+	Prewarm []string `json:"prewarm"`
+	// Reject requests with matching headers or user agents
+	BlockHeaders    []ConfigBlockHeader `json:"blockHeaders"`
+	BlockUserAgents []string            `json:"blockUserAgents"`
+	BlockStatus     int                 `json:"blockStatus"`
+	// Directory listing theme, "list" or "grid" or one of DirectoryThemes
+	DirectoryTheme string `json:"directoryTheme"`
+	// Custom directory listing templates, keyed by theme name
+	DirectoryThemes map[string]string `json:"directoryThemes"`
+	// Serve about.fr.html for /about based on Accept-Language
+	LanguageNegotiation bool `json:"languageNegotiation"`
+	Ssl                 struct {
 		KeyFile  string `json:"keyFile"`
 		CertFile string `json:"certFile"`
+		// CA bundle for verifying client certificates
+		ClientCaFile      string `json:"clientCaFile"`
+		RequireClientCert bool   `json:"requireClientCert"`
+		// Certificates from Let's Encrypt when no files are given
+		AutoCert ConfigAutoCert `json:"autoCert"`
+		// Address of a plain HTTP listener redirecting to HTTPS, empty
+		// disables it
+		RedirectAddr string `json:"redirectAddr"`
+		// HTTPS port the redirects point to, 443 by default
+		RedirectPort string `json:"redirectPort"`
 	} `json:"ssl"`
 
+	// Report routing decisions in an X-Swerver-Trace header, never enable
+	// this in production. With a secret only ?__trace=<secret> is traced.
+	Trace       bool   `json:"trace"`
+	TraceSecret string `json:"traceSecret"`
+	// Maximum directory depth visited by features that walk the tree
+	MaxWalkDepth int `json:"maxWalkDepth"`
+	// Serve the index ("indexFirst"), the listing ("listFirst") or pick
+	// by the Accept header ("negotiate") for directories that have an
+	// index document
+	DirectoryPrecedence string `json:"directoryPrecedence"`
+	// Link preload hints emitted for HTML documents, keyed by path glob
+	Preload map[string][]ConfigPreload `json:"preload"`
+	// Content-Type for files without an extension, by default it's sniffed
+	DefaultContentType string `json:"defaultContentType"`
+	// Return 404 when the request casing doesn't match the file on disk
+	StrictCase bool `json:"strictCase"`
+	// Leading path segments stripped as a language choice, /fr/about is
+	// served from /about
+	LanguagePrefixes []string `json:"languagePrefixes"`
+	DefaultLanguage  string   `json:"defaultLanguage"`
+	// Close connections after every response
+	NoKeepAlive bool `json:"noKeepAlive"`
+	// Send Content-Disposition: inline with the name of the file served
+	ContentDisposition bool `json:"contentDisposition"`
+	// Serve only static files from within public, proxies, symlinks and
+	// uploads are disabled whatever the rest of the configuration says
+	SafeMode bool `json:"safeMode"`
+	// Accept PUT and DELETE requests for files below public, limited to
+	// the matching paths when uploadPaths is given
+	AllowUploads  bool     `json:"allowUploads"`
+	UploadPaths   []string `json:"uploadPaths"`
+	MaxUploadSize int64    `json:"maxUploadSize"`
+	// Bearer token required for uploads
+	UploadToken string `json:"uploadToken"`
+	// Accept a list of uploads and deletes POSTed to /__batch
+	AllowBatch bool `json:"allowBatch"`
+	// Response headers removed from every response
+	RemoveHeaders []string `json:"removeHeaders"`
+	// Cache-Control for error responses keyed by status ("404") or class
+	// ("5xx"), an empty value sends none
+	ErrorCacheControl map[string]string `json:"errorCacheControl"`
+	// Timeouts for proxied upstreams as durations like "5s"
+	ProxyDialTimeout           string `json:"proxyDialTimeout"`
+	ProxyTLSTimeout            string `json:"proxyTLSTimeout"`
+	ProxyResponseHeaderTimeout string `json:"proxyResponseHeaderTimeout"`
+	// Time waited for the upstream's 100 Continue before a request with
+	// Expect: 100-continue sends its body anyway
+	ProxyExpectContinueTimeout string `json:"proxyExpectContinueTimeout"`
+	// Entries per page of a directory listing, zero lists everything
+	// unless the request asks for ?limit=
+	DirectoryPageSize int `json:"directoryPageSize"`
+	// Files for the access and error logs, reopened on SIGHUP
+	AccessLogFile string `json:"accessLogFile"`
+	ErrorLogFile  string `json:"errorLogFile"`
+	// Directory keeping gzip compressed copies of served files
+	CompressionCacheDir string `json:"compressionCacheDir"`
+	// Paths never compressed, on the fly or from the compression cache
+	NoCompressPaths []string `json:"noCompressPaths"`
+	// Dictionary JSON responses are compressed against for clients that
+	// announce it with Available-Dictionary
+	BrotliDictionary string `json:"brotliDictionary"`
+	// Count downloads, shown in listings and reported on /__hits, the
+	// counts are saved to hitCounterFile when given
+	HitCounter     bool   `json:"hitCounter"`
+	HitCounterFile string `json:"hitCounterFile"`
+	// Seconds sent in Retry-After when the public folder is temporarily
+	// unavailable
+	RetryAfter int `json:"retryAfter"`
+	// Most byte ranges served for a single request, zero allows any
+	MaxRanges int `json:"maxRanges"`
+	// Index document for directories whose name matches the pattern,
+	// index.html is still used when it is missing
+	DirectoryIndexRules map[string]string `json:"directoryIndexRules"`
+	// "mtime-size" (the default) or "sha256" for ETags that are the same
+	// on every replica
+	ETagAlgorithm string `json:"etagAlgorithm"`
+	// Host used for requests without a Host header, they are refused
+	// when it is empty
+	DefaultHost string `json:"defaultHost"`
+	// Paths always sent in full with Cache-Control: no-store
+	NoCachePaths []string `json:"noCachePaths"`
+	// IP allow and deny lists
+	IPAccess ConfigIPAccess `json:"ipAccess"`
+	// Let the upstream compress proxied responses ("upstream") or always
+	// compress them here ("local")
+	ProxyCompression string `json:"proxyCompression"`
+	// Shorten file names in directory listings beyond this many characters
+	MaxNameLength int `json:"maxNameLength"`
+	// Status for a HEAD request on a directory without an index when
+	// listings are disabled: 200, 403 or 404
+	DirectoryHeadStatus int `json:"directoryHeadStatus"`
+	// Directory listings rendered at once, zero renders them all
+	MaxConcurrentListings int `json:"maxConcurrentListings"`
+	// How long a listing waits for its turn before a 503, e.g. "2s", by
+	// default it waits as long as the client does
+	ListingWait string `json:"listingWait"`
+	// Answer range requests for empty files with a 200 instead of a 416
+	IgnoreEmptyRanges bool `json:"ignoreEmptyRanges"`
+	// Time requests in flight get to finish on SIGINT or SIGTERM, e.g.
+	// "30s" (the default)
+	ShutdownTimeout string `json:"shutdownTimeout"`
+	// Path the site is mounted under by a reverse proxy, e.g. "/app", the
+	// breadcrumbs of directory listings link below it
+	BasePath string `json:"basePath"`
+	// Restrict the request methods allowed on matching paths, the first
+	// matching entry applies
+	Methods []ConfigMethods `json:"methods"`
+	// Serve a missing file from its .gz sibling, decompressed on the fly
+	DecompressGzip bool `json:"decompressGzip"`
+	// Which of a redirect and a proxy source matching the same path
+	// applies, "redirects" (the default) or "proxy"
+	Precedence string `json:"precedence"`
+	// List the existing names close to a missing one on 404 pages
+	SuggestNotFound bool `json:"suggestNotFound"`
+	// Leave the query string out of redirects, by default it is carried
+	// over unless the target has its own
+	DropQuery bool `json:"dropQuery"`
+	// Let clients filter directory listings with a ?filter= glob
+	DirectoryFilter bool `json:"directoryFilter"`
+	// Requests a single client address may have in flight, zero for no
+	// limit
+	MaxRequestsPerIP int `json:"maxRequestsPerIP"`
+	// Keep the trailing dot of a fully qualified Host header instead of
+	// handling example.com. as example.com
+	KeepHostDot bool `json:"keepHostDot"`
+	// Cache-Control of the served files matching a source, the first
+	// matching rule applies and headers rules take precedence
+	CacheControl []ConfigCacheControl `json:"cacheControl"`
+	// Largest proxied response body sent to the client, a larger one is
+	// refused with a 502 or truncated when its size is not known up front.
+	// Zero sends bodies whole.
+	ProxyMaxResponseBytes int64 `json:"proxyMaxResponseBytes"`
+	// Serve the version, build and uptime as JSON on /__info
+	InfoEndpoint bool `json:"infoEndpoint"`
+	// Cache-Control max-age in seconds keyed by file extension (".css"),
+	// cacheControl rules take precedence
+	ExtensionCache map[string]int `json:"extensionCache"`
+	// Testing aid delaying every response by a duration like "500ms"
+	ArtificialDelay string `json:"artificialDelay"`
+	// Testing aid letting a request ask for a delay with ?__delay=<ms>
+	DelayQuery bool `json:"delayQuery"`
+	// "reject" (the default) answers a path with a backslash with a 400,
+	// "normalize" reads the backslash as a slash
+	Backslashes string `json:"backslashes"`
+	// File served with a 404 for a missing path, looked for in the directory
+	// of the path and then in each of its parents, such as "_fallback.html"
+	DirectoryFallback string `json:"directoryFallback"`
+	// Paths served in full whatever the Range header, without advertising
+	// range support
+	NoRangePaths []string `json:"noRangePaths"`
+	// Link a reduced copy of every image in listings, served below
+	// /__thumb with thumbnailSize (200 by default) as its longest edge
+	Thumbnails    bool `json:"thumbnails"`
+	ThumbnailSize int  `json:"thumbnailSize"`
+	// Status answering TRACE and CONNECT requests on every path, 405 (the
+	// default) or 501
+	TraceConnectStatus int `json:"traceConnectStatus"`
+	// Virtual paths served with the concatenation of the files matching
+	// their list of globs, in order
+	Bundles map[string][]string `json:"bundles"`
+	// Endpoints answering liveness and readiness probes
+	Health ConfigHealth `json:"health"`
+
 	// Not in the config spec
 	Debug         bool
 	Listen        string
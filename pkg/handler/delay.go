@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/koblas/swerver/pkg/trace"
+)
+
+// Query parameter asking for a delay when delayQuery is set
+const delayParam = "__delay"
+
+// Longest delay a request can ask for with ?__delay=
+const maxQueryDelay = time.Minute
+
+// delayEnabled tells if the delay middleware has anything to do, it is
+// never attached unless artificialDelay or delayQuery is configured
+func (state HandlerState) delayEnabled() bool {
+	return state.ArtificialDelay != "" || state.DelayQuery
+}
+
+// delayMiddleware holds every response back by artificialDelay plus the
+// milliseconds asked for with ?__delay= when delayQuery is set, so clients
+// can be tested against a slow server. The parameter is removed before the
+// request goes any further.
+func (state HandlerState) delayMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delay := state.delay
+
+		if state.DelayQuery {
+			query := r.URL.Query()
+			if value := query.Get(delayParam); value != "" {
+				if ms, err := strconv.Atoi(value); err == nil && ms > 0 {
+					requested := time.Duration(ms) * time.Millisecond
+					if requested > maxQueryDelay {
+						requested = maxQueryDelay
+					}
+					delay += requested
+				}
+				query.Del(delayParam)
+				r.URL.RawQuery = query.Encode()
+			}
+		}
+
+		if delay > 0 {
+			trace.Add(r, "delay %s", delay)
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
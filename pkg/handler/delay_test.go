@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDelayQuery(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html": "index",
+	})
+
+	timed := func(router http.Handler, target string) time.Duration {
+		start := time.Now()
+		w := doRequest(router, "GET", target, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "index", w.Body.String())
+		return time.Since(start)
+	}
+
+	router := newTestRouter(Configuration{Public: public, DelayQuery: true, Trace: true})
+	assert.True(t, timed(router, "/?__delay=150") >= 150*time.Millisecond)
+	w := doRequest(router, "GET", "/?__delay=10", nil)
+	assert.Contains(t, w.Header().Get(traceHeader), "delay 10ms")
+	assert.True(t, timed(router, "/?__delay=nope") < 100*time.Millisecond)
+
+	// Nothing is delayed unless enabled
+	router = newTestRouter(Configuration{Public: public})
+	assert.True(t, timed(router, "/?__delay=1000") < 500*time.Millisecond)
+
+	router = newTestRouter(Configuration{Public: public, ArtificialDelay: "100ms"})
+	assert.True(t, timed(router, "/") >= 100*time.Millisecond)
+	assert.True(t, timed(router, "/?__delay=1000") < 500*time.Millisecond)
+}
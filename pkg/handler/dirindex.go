@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"fmt"
+	"path"
+	"sort"
+)
+
+// compileDirectoryIndexRules checks the directory name patterns of
+// directoryIndexRules, returning them in the order they are tried
+func compileDirectoryIndexRules(rules map[string]string) ([]string, error) {
+	patterns := make([]string, 0, len(rules))
+	for pattern := range rules {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid directoryIndexRules pattern %q: %v", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	return patterns, nil
+}
+
+// directoryIndex names the index document for the directory dir from the
+// first rule matching its name, or nothing to use index.html
+func (state HandlerState) directoryIndex(dir string) string {
+	name := path.Base(path.Clean("/" + dir))
+
+	for _, pattern := range state.indexPatterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return state.DirectoryIndexRules[pattern]
+		}
+	}
+
+	return ""
+}
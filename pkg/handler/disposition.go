@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// contentDisposition formats an inline Content-Disposition for filename as
+// described in RFC 6266, a name outside of ASCII is sent in the filename*
+// form with an ASCII fallback for older clients.
+func contentDisposition(filename string) string {
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r >= 0x7f {
+			return '_'
+		}
+		return r
+	}, filename)
+
+	if fallback == filename {
+		return fmt.Sprintf(`inline; filename="%s"`, quote.Replace(filename))
+	}
+
+	return fmt.Sprintf(`inline; filename="%s"; filename*=UTF-8''%s`, quote.Replace(fallback), encodeAttrValue(filename))
+}
+
+// encodeAttrValue percent encodes everything but the attr-char set of RFC 5987
+func encodeAttrValue(value string) string {
+	var builder strings.Builder
+
+	for _, b := range []byte(value) {
+		if ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9') || strings.IndexByte("!#$&+-.^_`|~", b) >= 0 {
+			builder.WriteByte(b)
+		} else {
+			fmt.Fprintf(&builder, "%%%02X", b)
+		}
+	}
+
+	return builder.String()
+}
+
+func (state HandlerState) dispositionHeader(w http.ResponseWriter, filename string) {
+	if state.ContentDisposition {
+		w.Header().Set("Content-Disposition", contentDisposition(filename))
+	}
+}
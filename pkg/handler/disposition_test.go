@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentDisposition(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"about.html":     "about",
+		"report.pdf":     "report",
+		"résumé 1.pdf":   "resume",
+		`say "hi".txt`:   "hi",
+		"docs/notes.txt": "notes",
+	})
+
+	router := newTestRouter(Configuration{Public: public})
+	w := doRequest(router, "GET", "/report.pdf", nil)
+	assert.Empty(t, w.Header().Get("Content-Disposition"))
+
+	router = newTestRouter(Configuration{Public: public, ContentDisposition: true})
+	w = doRequest(router, "GET", "/report.pdf", nil)
+	assert.Equal(t, `inline; filename="report.pdf"`, w.Header().Get("Content-Disposition"))
+
+	w = doRequest(router, "GET", "/about", nil)
+	assert.Equal(t, `inline; filename="about.html"`, w.Header().Get("Content-Disposition"))
+
+	w = doRequest(router, "GET", "/say%20%22hi%22.txt", nil)
+	assert.Equal(t, `inline; filename="say \"hi\".txt"`, w.Header().Get("Content-Disposition"))
+
+	w = doRequest(router, "GET", "/r%C3%A9sum%C3%A9%201.pdf", nil)
+	assert.Equal(t, `inline; filename="r_sum_ 1.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9%201.pdf`, w.Header().Get("Content-Disposition"))
+
+	w = doRequest(router, "GET", "/docs/", nil)
+	assert.Empty(t, w.Header().Get("Content-Disposition"))
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/koblas/swerver/pkg/swhttp"
+)
+
+// Cache-Control sent with errors unless errorCacheControl says otherwise
+var defaultErrorCacheControl = map[string]string{
+	"404": "max-age=60",
+	"5xx": "no-store",
+}
+
+// errorCacheControl looks up the Cache-Control for an error response, by
+// exact status ("404") first and then by class ("5xx").
+func (state HandlerState) errorCacheControl(status int) string {
+	keys := []string{strconv.Itoa(status), fmt.Sprintf("%dxx", status/100)}
+
+	for _, table := range []map[string]string{state.ErrorCacheControl, defaultErrorCacheControl} {
+		for _, key := range keys {
+			if value, found := table[key]; found {
+				return value
+			}
+		}
+	}
+
+	return ""
+}
+
+// sendStatError answers a failure to look up a file, a filesystem that is
+// temporarily unavailable gets a 503 with Retry-After.
+func (state HandlerState) sendStatError(w http.ResponseWriter, r *http.Request, err error) {
+	if swhttp.IsTransient(err) {
+		log.Printf("Filesystem unavailable for %s: %v", r.URL.Path, err)
+		swhttp.SetRetryAfter(w, state.RetryAfter)
+		state.sendError(w, r, "/", http.StatusServiceUnavailable)
+		return
+	}
+
+	state.sendError(w, r, "/", http.StatusBadRequest)
+}
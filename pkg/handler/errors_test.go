@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/koblas/swerver/pkg/swhttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCacheControl(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html": "index",
+	})
+	config := Configuration{Public: public}
+
+	w := doRequest(newTestRouter(config), "GET", "/missing", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "max-age=60", w.Header().Get("Cache-Control"))
+
+	w = httptest.NewRecorder()
+	newTestHandler(config).sendError(w, httptest.NewRequest("GET", "/", nil), "/", http.StatusInternalServerError)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	w = doRequest(newTestRouter(config), "GET", "/", nil)
+	assert.Empty(t, w.Header().Get("Cache-Control"))
+
+	config.ErrorCacheControl = map[string]string{"4xx": "no-cache", "500": ""}
+	w = doRequest(newTestRouter(config), "GET", "/missing", nil)
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+
+	w = httptest.NewRecorder()
+	newTestHandler(config).sendError(w, httptest.NewRequest("GET", "/", nil), "/", http.StatusInternalServerError)
+	assert.Empty(t, w.Header().Get("Cache-Control"))
+
+	w = httptest.NewRecorder()
+	newTestHandler(config).sendError(w, httptest.NewRequest("GET", "/", nil), "/", http.StatusBadGateway)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+}
+
+// failingDir fails every open below a prefix with err
+type failingDir struct {
+	http.Dir
+	prefix string
+	err    error
+}
+
+func (d failingDir) Open(name string) (http.File, error) {
+	if strings.HasPrefix(name, d.prefix) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: d.err}
+	}
+	return d.Dir.Open(name)
+}
+
+func TestTransientFilesystemError(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html":     "index",
+		"mount/file.txt": "file",
+	})
+
+	handler := swhttp.FileServer(failingDir{http.Dir(public), "/mount", syscall.ESTALE}, swhttp.Options{RetryAfter: 7})
+	w := doRequest(handler, "GET", "/mount/file.txt", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "7", w.Header().Get("Retry-After"))
+	w = doRequest(handler, "GET", "/index.html", nil)
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+
+	// The single page fallback mustn't hide an unavailable filesystem
+	handler = swhttp.FileServer(failingDir{http.Dir(public), "/mount", syscall.EAGAIN}, swhttp.Options{SinglePage: true})
+	w = doRequest(handler, "GET", "/mount/file.txt", map[string]string{"Accept": "application/json"})
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "10", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), `"code":"service_unavailable"`)
+
+	// Other failures are still server errors
+	handler = swhttp.FileServer(failingDir{http.Dir(public), "/mount", syscall.EIO}, swhttp.Options{})
+	w = doRequest(handler, "GET", "/mount/file.txt", nil)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Empty(t, w.Header().Get("Retry-After"))
+}
+
+func TestAcceptJSON(t *testing.T) {
+	for accept, expected := range map[string]bool{
+		"":                                               false,
+		"*/*":                                            false,
+		"application/json":                               true,
+		"Application/JSON; charset=utf-8":                true,
+		"application/json-patch+json":                    false,
+		"text/html, application/json;q=0.1":              false,
+		"application/json, text/html;q=0.9":              true,
+		"text/html;q=0.5, application/json":              true,
+		"*/*, application/json":                          true,
+		"*/*, application/json;q=0.5":                    false,
+		"application/json;q=0, text/html":                false,
+		"application/json, text/javascript, */*; q=0.01": true,
+		"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8": false,
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		assert.Equal(t, expected, acceptJSON(req), accept)
+	}
+
+	// A JSON client gets the error as JSON, a browser as HTML
+	router := newTestRouter(Configuration{Public: t.TempDir()})
+	w := doRequest(router, "GET", "/missing", map[string]string{"Accept": "text/html, application/json;q=0.1"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NotContains(t, w.Body.String(), `"code":"not_found"`)
+	w = doRequest(router, "GET", "/missing", map[string]string{"Accept": "application/json"})
+	assert.Contains(t, w.Body.String(), `"code":"not_found"`)
+}
+
+func TestSuggestNotFound(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"docs/install.html": "install",
+		"docs/usage.html":   "usage",
+		"docs/.secret":      "hidden",
+	})
+	config := Configuration{Public: public, SuggestNotFound: true}
+	router := newTestRouter(config)
+
+	for _, handler := range []http.Handler{router, newTestHandler(config)} {
+		w := doRequest(handler, "GET", "/docs/instal", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), `Did you mean <a href="/docs/install.html">/docs/install.html</a>?`)
+	}
+
+	w := doRequest(router, "GET", "/docs/usgae.html", map[string]string{"Accept": "application/json"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), `"suggestions":["/docs/usage.html"]`)
+
+	w = doRequest(router, "GET", "/docs/zzzzzzzzqq.html", map[string]string{"Accept": "application/json"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NotContains(t, w.Body.String(), "suggestions")
+
+	w = doRequest(router, "GET", "/docs/.secrt", nil)
+	assert.NotContains(t, w.Body.String(), "Did you mean")
+
+	// Off by default
+	w = doRequest(newTestRouter(Configuration{Public: public}), "GET", "/docs/instal.html", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NotContains(t, w.Body.String(), "Did you mean")
+}
+
+func TestSuggestNotFoundEscaped(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		`docs/<img src=x onerror="alert(1)">.html`: "uploaded",
+	})
+	config := Configuration{Public: public, SuggestNotFound: true}
+
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w := doRequest(handler, "GET", "/docs/%3Cimg%20src=x%20onerror=%22alert(2)%22%3E", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.NotContains(t, w.Body.String(), "<img")
+		assert.Contains(t, w.Body.String(), `<a href="/docs/%3Cimg%20src=x%20onerror=%22alert%281%29%22%3E.html">/docs/&lt;img src=x onerror=&#34;alert(1)&#34;&gt;.html</a>`)
+	}
+}
+
+func TestSuggestNotFoundUnlisted(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"docs/install.html": "install",
+		"docs/secret.html":  "secret",
+		"private/plan.html": "plan",
+		"outside/plan.html": "plan",
+	})
+	if err := os.Symlink(filepath.Join(public, "outside"), filepath.Join(public, "linked")); err != nil {
+		t.Fatal(err)
+	}
+	config := Configuration{
+		Public:           public,
+		SuggestNotFound:  true,
+		Unlisted:         []string{"secret.html"},
+		DirectoryListing: []string{"/docs/", "/linked/"},
+	}
+	router := newTestRouter(config)
+
+	w := doRequest(router, "GET", "/docs/secrt", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NotContains(t, w.Body.String(), "Did you mean")
+	w = doRequest(router, "GET", "/docs/instal", nil)
+	assert.Contains(t, w.Body.String(), "/docs/install.html")
+
+	// Directories without listings aren't revealed either
+	w = doRequest(router, "GET", "/private/pla", nil)
+	assert.NotContains(t, w.Body.String(), "Did you mean")
+
+	// Nor what is behind a symlink
+	for _, handler := range []http.Handler{router, newTestHandler(config)} {
+		w = doRequest(handler, "GET", "/linked/pla", nil)
+		assert.NotContains(t, w.Body.String(), "Did you mean")
+	}
+}
+
+func TestDirectoryFallback(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html":               "index",
+		"_fallback.html":           "root fallback",
+		"docs/_fallback.html":      "docs fallback",
+		"docs/guide/intro.txt":     "intro",
+		"blog/2024/post.html":      "post",
+		"blog/2024/nested/a/b.txt": "b",
+	})
+	config := Configuration{Public: public, DirectoryFallback: "_fallback.html"}
+
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w := doRequest(handler, "GET", "/docs/guide/missing.txt", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "docs fallback", w.Body.String())
+
+		w = doRequest(handler, "GET", "/docs/missing/deeper", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "docs fallback", w.Body.String())
+
+		w = doRequest(handler, "GET", "/blog/2024/missing.txt", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "root fallback", w.Body.String())
+
+		w = doRequest(handler, "GET", "/missing", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "root fallback", w.Body.String())
+
+		w = doRequest(handler, "GET", "/docs/guide/intro.txt", nil)
+		assert.Equal(t, "intro", w.Body.String())
+	}
+
+	config.DirectoryFallback = ""
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w := doRequest(handler, "GET", "/docs/guide/missing.txt", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.NotContains(t, w.Body.String(), "fallback")
+	}
+}
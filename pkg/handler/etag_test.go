@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETagAlgorithm(t *testing.T) {
+	files := map[string]string{
+		"a/app.js": "console.log('hello')",
+		"b/app.js": "console.log('hello')",
+		"c/app.js": "console.log('other')",
+	}
+	public := writeFiles(t, files)
+	replica := writeFiles(t, files)
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(replica, "a", "app.js"), later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	etag := func(router http.Handler, target string) string {
+		w := doRequest(router, "GET", target, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		return w.Header().Get("Etag")
+	}
+
+	hashed := newTestRouter(Configuration{Public: public, ETagAlgorithm: "sha256"})
+	tag := etag(hashed, "/a/app.js")
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, tag)
+	assert.Equal(t, tag, etag(hashed, "/a/app.js"))
+	assert.Equal(t, tag, etag(hashed, "/b/app.js"))
+	assert.NotEqual(t, tag, etag(hashed, "/c/app.js"))
+
+	// Another instance with a different modification time agrees
+	other := newTestRouter(Configuration{Public: replica, ETagAlgorithm: "sha256"})
+	assert.Equal(t, tag, etag(other, "/a/app.js"))
+
+	w := doRequest(hashed, "GET", "/a/app.js", map[string]string{"If-None-Match": tag})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	// The default depends on the file on disk
+	cheap := newTestRouter(Configuration{Public: replica})
+	assert.Regexp(t, `^W/"[0-9a-f]+-14"$`, etag(cheap, "/a/app.js"))
+	assert.NotEqual(t, etag(cheap, "/a/app.js"), etag(cheap, "/b/app.js"))
+}
+
+func TestNoCachePaths(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"status.json": `{"ok":true}`,
+		"app.js":      "console.log('hello')",
+	})
+	router := newTestRouter(Configuration{Public: public, NoCachePaths: []string{"/status.json"}})
+
+	for _, target := range []string{"/status.json", "/app.js"} {
+		w := doRequest(router, "GET", target, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		conditional := map[string]string{
+			"If-None-Match":     w.Header().Get("Etag"),
+			"If-Modified-Since": w.Header().Get("Last-Modified"),
+		}
+		w = doRequest(router, "GET", target, conditional)
+		if target == "/status.json" {
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, `{"ok":true}`, w.Body.String())
+			assert.Equal(t, "no-cache, no-store, must-revalidate", w.Header().Get("Cache-Control"))
+		} else {
+			assert.Equal(t, http.StatusNotModified, w.Code)
+			assert.Empty(t, w.Header().Get("Cache-Control"))
+		}
+	}
+}
+
+func TestETagNotModified(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"app.js": "console.log('hello')",
+	})
+	config := Configuration{Public: public}
+
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w := doRequest(handler, "GET", "/app.js", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		tag := w.Header().Get("Etag")
+		assert.Regexp(t, `^W/"[0-9a-f]+-14"$`, tag)
+
+		for _, method := range []string{"GET", "HEAD"} {
+			w = doRequest(handler, method, "/app.js", map[string]string{"If-None-Match": tag})
+			assert.Equal(t, http.StatusNotModified, w.Code)
+			assert.Empty(t, w.Body.String())
+		}
+
+		w = doRequest(handler, "GET", "/app.js", map[string]string{"If-None-Match": `"other", ` + tag})
+		assert.Equal(t, http.StatusNotModified, w.Code)
+
+		w = doRequest(handler, "GET", "/app.js", map[string]string{"If-None-Match": `W/"0-0"`})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "console.log('hello')", w.Body.String())
+	}
+}
@@ -1,19 +1,82 @@
 package handler
 
 import (
+	"io/fs"
 	"strings"
 
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/koblas/swerver/pkg/swhttp"
+	"github.com/koblas/swerver/pkg/trace"
 )
 
-func (state HandlerState) sendFile(root http.Dir) func(w http.ResponseWriter, r *http.Request) {
+func (state HandlerState) sendFile(root http.FileSystem) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		rctx := chi.RouteContext(r.Context())
 		pathPrefix := strings.TrimSuffix(rctx.RoutePattern(), "/*")
-		fs := http.StripPrefix(pathPrefix, swhttp.FileServer(root, state.RenderSingle, !state.NoDirectoryListing))
+		trace.Add(r, "static %s", rctx.RoutePattern())
+		fs := http.StripPrefix(pathPrefix, swhttp.FileServer(root, swhttp.Options{
+			SinglePage:       state.RenderSingle,
+			DirectoryListing: !state.NoDirectoryListing,
+			Listed:           state.listed,
+			Cache:            state.cache,
+			DirectoryTheme:   state.DirectoryTheme,
+			DirectoryThemes:  state.themes,
+			CleanUrls: func(name string) bool {
+				return applicable(name, state.CleanUrls, state.NoCleanUrls)
+			},
+			SlashRedirects:      state.slashing(),
+			LanguageNegotiation: state.LanguageNegotiation,
+			DirectoryPrecedence: state.DirectoryPrecedence,
+			StrictCase:          state.StrictCase,
+			DirNames:            state.dirNames,
+			DefaultContentType:  state.DefaultContentType,
+			OnServe:             state.onServe,
+			ErrorCacheControl:   state.errorCacheControl,
+			CompressionCache:    state.compressed,
+			Hits:                state.hits,
+			Thumbnails:          state.thumbnails,
+			RetryAfter:          state.RetryAfter,
+			MaxRanges:           state.MaxRanges,
+			DirectoryIndex:      state.directoryIndex,
+			ETags:               state.etags,
+			MaxNameLength:       state.MaxNameLength,
+			DirectoryHeadStatus: state.DirectoryHeadStatus,
+			ListingLimiter:      state.listingLimiter,
+			IgnoreEmptyRanges:   state.IgnoreEmptyRanges,
+			BasePath:            state.basePath(),
+			DecompressGzip:      state.DecompressGzip,
+			Precompressed:       !state.NoCompression,
+			SuggestNotFound:     state.SuggestNotFound,
+			DropQuery:           state.DropQuery,
+			DirectoryFilter:     state.DirectoryFilter,
+			DirectoryFallback:   state.DirectoryFallback,
+			NoCache: func(name string) bool {
+				return matchesAny(name, state.NoCachePaths)
+			},
+			NoRange: func(name string) bool {
+				return matchesAny(name, state.NoRangePaths)
+			},
+		}))
 		fs.ServeHTTP(w, r)
 	}
 }
+
+// basePath is the configured basePath with a leading slash and without a
+// trailing one, empty when the site is served from the root
+func (state HandlerState) basePath() string {
+	base := strings.Trim(state.BasePath, "/")
+	if base == "" {
+		return ""
+	}
+
+	return "/" + base
+}
+
+// onServe decorates the response for a static file about to be served
+func (state HandlerState) onServe(w http.ResponseWriter, r *http.Request, name string, d fs.FileInfo) {
+	state.preloadHeaders(w, name)
+	state.cacheControlHeader(w, name)
+	state.dispositionHeader(w, d.Name())
+}
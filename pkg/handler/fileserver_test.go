@@ -0,0 +1,664 @@
+package handler
+
+import (
+	"encoding/json"
+	"html"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koblas/swerver/pkg/swhttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirectoryThemes(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"docs/a.txt": "a",
+	})
+	router := newTestRouter(Configuration{Public: public})
+
+	w := doRequest(router, "GET", "/docs/?view=grid", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `class="grid"`)
+	assert.Contains(t, w.Body.String(), "a.txt")
+
+	w = doRequest(router, "GET", "/docs/", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), `class="grid"`)
+	assert.Contains(t, w.Body.String(), `id="toggle"`)
+
+	w = doRequest(router, "GET", "/docs/?view=unknown", nil)
+	assert.Contains(t, w.Body.String(), `id="toggle"`)
+}
+
+func TestDirectoryThemeConfigured(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"docs/a.txt": "a",
+	})
+	theme := filepath.Join(t.TempDir(), "plain.html")
+	if err := os.WriteFile(theme, []byte("plain:{{range .Files}}{{.Base}} {{end}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	router := newTestRouter(Configuration{
+		Public:          public,
+		DirectoryTheme:  "plain",
+		DirectoryThemes: map[string]string{"plain": theme},
+	})
+
+	w := doRequest(router, "GET", "/docs/", nil)
+	assert.Equal(t, "plain:.. a.txt ", w.Body.String())
+
+	w = doRequest(router, "GET", "/docs/?view=grid", nil)
+	assert.Contains(t, w.Body.String(), `class="grid"`)
+}
+
+func TestLanguageNegotiation(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"about.html":    "about",
+		"about.en.html": "about en",
+		"about.fr.html": "about fr",
+		"contact.html":  "contact",
+	})
+	router := newTestRouter(Configuration{
+		Public:              public,
+		LanguageNegotiation: true,
+	})
+
+	w := doRequest(router, "GET", "/about", map[string]string{"Accept-Language": "fr-CA, fr;q=0.9, en;q=0.5"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "about fr", w.Body.String())
+	assert.Contains(t, w.Header().Values("Vary"), "Accept-Language")
+
+	w = doRequest(router, "GET", "/about", map[string]string{"Accept-Language": "en-US,en;q=0.8,fr;q=0.2"})
+	assert.Equal(t, "about en", w.Body.String())
+
+	w = doRequest(router, "GET", "/about", map[string]string{"Accept-Language": "de"})
+	assert.Equal(t, "about", w.Body.String())
+
+	w = doRequest(router, "GET", "/contact", map[string]string{"Accept-Language": "fr"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "contact", w.Body.String())
+}
+
+func TestDirectoryPrecedence(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"docs/index.html": "docs index",
+		"docs/a.txt":      "a",
+	})
+
+	router := newTestRouter(Configuration{Public: public})
+	w := doRequest(router, "GET", "/docs/", nil)
+	assert.Equal(t, "docs index", w.Body.String())
+	w = doRequest(router, "GET", "/docs/index.html", nil)
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+
+	router = newTestRouter(Configuration{Public: public, DirectoryPrecedence: "indexFirst"})
+	w = doRequest(router, "GET", "/docs/", nil)
+	assert.Equal(t, "docs index", w.Body.String())
+
+	router = newTestRouter(Configuration{Public: public, DirectoryPrecedence: "listFirst"})
+	w = doRequest(router, "GET", "/docs/", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "a.txt")
+	assert.Contains(t, w.Body.String(), "index.html")
+	w = doRequest(router, "GET", "/docs/index.html", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "docs index", w.Body.String())
+
+	// Without listings the index is the only thing that can be served
+	router = newTestRouter(Configuration{Public: public, DirectoryPrecedence: "listFirst", NoDirectoryListing: true})
+	w = doRequest(router, "GET", "/docs/", nil)
+	assert.Equal(t, "docs index", w.Body.String())
+}
+
+func TestDefaultContentType(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"LICENSE":   "Permission is hereby granted",
+		"blob":      "\x00\x01\x02\x03",
+		"notes.txt": "notes",
+	})
+
+	router := newTestRouter(Configuration{Public: public})
+	w := doRequest(router, "GET", "/LICENSE", nil)
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	w = doRequest(router, "GET", "/blob", nil)
+	assert.Equal(t, "application/octet-stream", w.Header().Get("Content-Type"))
+
+	router = newTestRouter(Configuration{Public: public, DefaultContentType: "text/markdown; charset=utf-8"})
+	w = doRequest(router, "GET", "/LICENSE", nil)
+	assert.Equal(t, "text/markdown; charset=utf-8", w.Header().Get("Content-Type"))
+	w = doRequest(router, "GET", "/blob", nil)
+	assert.Equal(t, "text/markdown; charset=utf-8", w.Header().Get("Content-Type"))
+	w = doRequest(router, "GET", "/notes.txt", nil)
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+}
+
+// insensitiveDir mimics a case-insensitive filesystem holding lower case names
+type insensitiveDir struct {
+	http.Dir
+}
+
+func (d insensitiveDir) Open(name string) (http.File, error) {
+	return d.Dir.Open(strings.ToLower(name))
+}
+
+func TestStrictCase(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html":      "index",
+		"docs/readme.txt": "readme",
+	})
+	root := insensitiveDir{http.Dir(public)}
+
+	lenient := swhttp.FileServer(root, swhttp.Options{})
+	w := doRequest(lenient, "GET", "/Index.html", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "index", w.Body.String())
+	w = doRequest(lenient, "GET", "/docs/README.txt", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	strict := swhttp.FileServer(root, swhttp.Options{StrictCase: true})
+	w = doRequest(strict, "GET", "/Index.html", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(strict, "GET", "/docs/README.txt", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(strict, "GET", "/docs/readme.txt", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "readme", w.Body.String())
+	w = doRequest(strict, "GET", "/", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Every element of the path has to match, not only the file name
+	for _, handler := range []http.Handler{strict, swhttp.FileServer(root, swhttp.Options{StrictCase: true, DirNames: swhttp.NewDirNames()})} {
+		w = doRequest(handler, "GET", "/DOCS/readme.txt", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = doRequest(handler, "GET", "/Docs/", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = doRequest(handler, "GET", "/docs/readme.txt", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+}
+
+func TestStrictCaseDirNames(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"docs/readme.txt": "readme",
+	})
+	root := insensitiveDir{http.Dir(public)}
+	names := swhttp.NewDirNames()
+	strict := swhttp.FileServer(root, swhttp.Options{StrictCase: true, DirNames: names})
+
+	w := doRequest(strict, "GET", "/docs/readme.txt", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The cached listing is read again once the directory changes
+	assert.NoError(t, os.WriteFile(filepath.Join(public, "docs", "notes.txt"), []byte("notes"), 0o644))
+	later := time.Now().Add(time.Second)
+	assert.NoError(t, os.Chtimes(filepath.Join(public, "docs"), later, later))
+	w = doRequest(strict, "GET", "/docs/notes.txt", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "notes", w.Body.String())
+	assert.True(t, names.Contains(root, "/docs", "notes.txt"))
+	assert.False(t, names.Contains(root, "/docs", "Notes.txt"))
+}
+
+func TestErrorPagePath(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html": "index",
+	})
+	router := newTestRouter(Configuration{Public: public})
+
+	w := doRequest(router, "GET", "/missing/page.html", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "GET /missing/page.html")
+
+	w = doRequest(router, "GET", "/%3Cscript%3Ealert(1)%3C/script%3E", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NotContains(t, w.Body.String(), "<script>")
+	assert.Contains(t, w.Body.String(), "&lt;script&gt;alert(1)&lt;/script&gt;")
+
+	w = doRequest(router, "GET", "/missing", map[string]string{"Accept": "application/json"})
+	assert.NotContains(t, w.Body.String(), "/missing")
+}
+
+func TestDirectoryIndexRules(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"docs/v1/README.html":    "v1 readme",
+		"docs/v1/index.html":     "v1 index",
+		"docs/v2/index.html":     "v2 index",
+		"docs/guide/README.html": "guide readme",
+		"docs/guide/index.html":  "guide index",
+	})
+	router := newTestRouter(Configuration{
+		Public:              public,
+		DirectoryIndexRules: map[string]string{"v*": "README.html"},
+	})
+
+	w := doRequest(router, "GET", "/docs/v1/", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "v1 readme", w.Body.String())
+
+	// Without the custom document the default index is used
+	w = doRequest(router, "GET", "/docs/v2/", nil)
+	assert.Equal(t, "v2 index", w.Body.String())
+
+	w = doRequest(router, "GET", "/docs/guide/", nil)
+	assert.Equal(t, "guide index", w.Body.String())
+}
+
+func TestDirectoryPrecedenceNegotiate(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"docs/index.html": "docs index",
+		"docs/a.txt":      "a",
+	})
+	router := newTestRouter(Configuration{Public: public, DirectoryPrecedence: "negotiate"})
+
+	w := doRequest(router, "GET", "/docs/", map[string]string{"Accept": "text/html,application/xhtml+xml,*/*;q=0.8"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "docs index", w.Body.String())
+	assert.Contains(t, w.Header().Values("Vary"), "Accept")
+
+	w = doRequest(router, "GET", "/docs/", map[string]string{"Accept": "application/json"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `"name":"a.txt"`)
+	assert.Contains(t, w.Body.String(), `"name":"index.html"`)
+	assert.Contains(t, w.Header().Values("Vary"), "Accept")
+}
+
+func TestMaxNameLength(t *testing.T) {
+	long := strings.Repeat("a", 40) + ".txt"
+	public := writeFiles(t, map[string]string{
+		"docs/" + long:   "long",
+		"docs/short.txt": "short",
+	})
+	config := Configuration{Public: public, MaxNameLength: 12}
+
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w := doRequest(handler, "GET", "/docs/", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), ">aaaaaaaaaaa…</a>")
+		assert.Regexp(t, `href="[^"]*`+long+`"`, w.Body.String())
+		assert.Contains(t, w.Body.String(), ">short.txt</a>")
+	}
+}
+
+func TestBasePathBreadcrumbs(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"docs/guide/intro.txt": "intro",
+	})
+	config := Configuration{Public: public, BasePath: "/app/"}
+
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w := doRequest(handler, "GET", "/docs/guide/", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `href="/app/"`)
+		assert.Contains(t, w.Body.String(), `href="/app/docs/"`)
+		assert.Contains(t, w.Body.String(), `href="/app/docs/guide/"`)
+		assert.NotContains(t, w.Body.String(), `href="/"`)
+	}
+}
+
+func TestBasePathListingLinks(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"docs/guide/intro.txt":      "intro",
+		"docs/guide/advanced/a.txt": "a",
+	})
+	config := Configuration{Public: public, BasePath: "/app/"}
+
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w := doRequest(handler, "GET", "/docs/guide/", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// Links resolve to the same place whether relative or absolute
+		base, _ := url.Parse("http://example.com/app/docs/guide/")
+		links := map[string]string{}
+		for _, match := range regexp.MustCompile(`<a href="([^"]*)"[^>]*>([^<]*)</a>`).FindAllStringSubmatch(w.Body.String(), -1) {
+			href, err := url.Parse(html.UnescapeString(match[1]))
+			assert.NoError(t, err)
+			links[strings.TrimSuffix(strings.TrimSpace(match[2]), "/")] = base.ResolveReference(href).Path
+		}
+		assert.Equal(t, "/app/docs/guide/intro.txt", links["intro.txt"])
+		assert.Equal(t, "/app/docs/guide/advanced", strings.TrimSuffix(links["advanced"], "/"))
+		assert.Equal(t, "/app/docs", strings.TrimSuffix(links[".."], "/"))
+	}
+}
+
+func TestDirectoryHeadStatus(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"docs/a.txt": "a",
+	})
+
+	for _, status := range []int{0, http.StatusOK, http.StatusForbidden, http.StatusNotFound} {
+		router := newTestRouter(Configuration{Public: public, NoDirectoryListing: true, DirectoryHeadStatus: status})
+
+		w := doRequest(router, "HEAD", "/docs/", nil)
+		switch status {
+		case 0:
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		case http.StatusOK:
+			assert.Equal(t, status, w.Code)
+			assert.Empty(t, w.Body.String())
+			assert.NotEmpty(t, w.Header().Get("Last-Modified"))
+		default:
+			assert.Equal(t, status, w.Code)
+		}
+
+		// A GET is answered as before
+		w = doRequest(router, "GET", "/docs/", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = doRequest(router, "HEAD", "/missing/", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	}
+}
+
+// countingDir tracks how many directories are being read at once, every
+// read waits for release
+type countingDir struct {
+	http.Dir
+	mu      sync.Mutex
+	active  int
+	maximum int
+	release chan struct{}
+}
+
+type countingFile struct {
+	http.File
+	dir *countingDir
+}
+
+func (d *countingDir) Open(name string) (http.File, error) {
+	f, err := d.Dir.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return countingFile{f, d}, nil
+}
+
+func (f countingFile) Readdir(count int) ([]fs.FileInfo, error) {
+	d := f.dir
+	d.mu.Lock()
+	d.active++
+	if d.active > d.maximum {
+		d.maximum = d.active
+	}
+	d.mu.Unlock()
+
+	<-d.release
+
+	d.mu.Lock()
+	d.active--
+	d.mu.Unlock()
+
+	return f.File.Readdir(count)
+}
+
+func TestMaxConcurrentListings(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"docs/a.txt": "a",
+	})
+	root := &countingDir{Dir: http.Dir(public), release: make(chan struct{})}
+	handler := swhttp.FileServer(root, swhttp.Options{
+		DirectoryListing: true,
+		ListingLimiter:   swhttp.NewLimiter(2, 0),
+	})
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- doRequest(handler, "GET", "/docs/", nil).Code
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		root.release <- struct{}{}
+	}
+	wg.Wait()
+	close(codes)
+
+	for code := range codes {
+		assert.Equal(t, http.StatusOK, code)
+	}
+	assert.Equal(t, 2, root.maximum)
+}
+
+func TestListingWait(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"docs/a.txt": "a",
+	})
+	root := &countingDir{Dir: http.Dir(public), release: make(chan struct{})}
+	handler := swhttp.FileServer(root, swhttp.Options{
+		DirectoryListing: true,
+		ListingLimiter:   swhttp.NewLimiter(1, 20*time.Millisecond),
+	})
+
+	done := make(chan int)
+	go func() {
+		done <- doRequest(handler, "GET", "/docs/", nil).Code
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	w := doRequest(handler, "GET", "/docs/", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	root.release <- struct{}{}
+	assert.Equal(t, http.StatusOK, <-done)
+
+	state := newTestHandler(Configuration{Public: public, MaxConcurrentListings: 4, ListingWait: "1s"})
+	assert.NotNil(t, state.listingLimiter)
+}
+
+func TestDirectoryFilter(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"images/a.png":     "a",
+		"images/B.PNG":     "b",
+		"images/c.jpg":     "c",
+		"images/notes.txt": "n",
+	})
+	config := Configuration{Public: public, DirectoryFilter: true}
+
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w := doRequest(handler, "GET", "/images/?filter=*.png", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		body := w.Body.String()
+		assert.Contains(t, body, "a.png")
+		assert.Contains(t, body, "B.PNG")
+		assert.NotContains(t, body, "c.jpg")
+		assert.NotContains(t, body, "notes.txt")
+		assert.Contains(t, body, `name="filter" value="*.png"`)
+
+		w = doRequest(handler, "GET", "/images/", nil)
+		assert.Contains(t, w.Body.String(), "c.jpg")
+		assert.Contains(t, w.Body.String(), `name="filter" value=""`)
+
+		w = doRequest(handler, "GET", "/images/?filter=../*", nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		// Unbalanced parentheses are matched as they are
+		w = doRequest(handler, "GET", "/images/?filter=a)", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "a.png")
+		w = doRequest(handler, "GET", "/images/?filter="+url.QueryEscape("${!(!(]"), nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+
+	// The query is ignored unless enabled
+	w := doRequest(newTestRouter(Configuration{Public: public}), "GET", "/images/?filter=*.png", nil)
+	assert.Contains(t, w.Body.String(), "c.jpg")
+	assert.NotContains(t, w.Body.String(), `name="filter"`)
+}
+
+func TestDirectoryFilterEscaped(t *testing.T) {
+	public := writeFiles(t, map[string]string{"images/a.png": "a"})
+	filter := url.QueryEscape(`"><svg onload=alert(1)>`)
+
+	for _, theme := range []string{"", "grid"} {
+		config := Configuration{Public: public, DirectoryFilter: true, DirectoryTheme: theme}
+		for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+			w := doRequest(handler, "GET", "/images/?filter="+filter, nil)
+			assert.Equal(t, http.StatusOK, w.Code)
+			body := w.Body.String()
+			assert.NotContains(t, body, "<svg onload")
+			assert.Contains(t, body, `value="&#34;&gt;&lt;svg onload=alert(1)&gt;"`)
+		}
+	}
+}
+
+func TestDirectoryListingJSON(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"docs/a.txt":       "a",
+		"docs/guide/b.txt": "b",
+	})
+	config := Configuration{Public: public}
+
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w := doRequest(handler, "GET", "/docs/", map[string]string{"Accept": "application/json"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+
+		var listing struct {
+			Directory   string `json:"directory"`
+			Breadcrumbs []struct {
+				Url  string `json:"url"`
+				Name string `json:"name"`
+			} `json:"breadcrumbs"`
+			Files []struct {
+				Name  string `json:"name"`
+				Url   string `json:"url"`
+				IsDir bool   `json:"isDir"`
+			} `json:"files"`
+		}
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &listing))
+		assert.Contains(t, listing.Directory, "docs")
+		if assert.Equal(t, 2, len(listing.Breadcrumbs)) {
+			assert.Equal(t, "/", listing.Breadcrumbs[0].Url)
+			assert.Equal(t, "/docs/", listing.Breadcrumbs[1].Url)
+			assert.Equal(t, "docs", listing.Breadcrumbs[1].Name)
+		}
+		if assert.Equal(t, 3, len(listing.Files)) {
+			assert.Equal(t, "..", listing.Files[0].Name)
+			assert.True(t, listing.Files[0].IsDir)
+			assert.Equal(t, "a.txt", listing.Files[1].Name)
+			assert.False(t, listing.Files[1].IsDir)
+			assert.Contains(t, listing.Files[1].Url, "a.txt")
+			assert.Contains(t, listing.Files[2].Name, "guide")
+			assert.True(t, listing.Files[2].IsDir)
+		}
+
+		// Only the documented fields are sent
+		for _, field := range []string{"Title", "Display", "Dir", "Ext", "Filterable"} {
+			assert.NotContains(t, w.Body.String(), `"`+field+`"`)
+		}
+	}
+}
+
+func TestListingSizes(t *testing.T) {
+	for size, expected := range map[int64]string{
+		0:                      "0 B",
+		1023:                   "1023 B",
+		1536:                   "1.5 KB",
+		5 * 1024 * 1024:        "5.0 MB",
+		3 * 1024 * 1024 * 1024: "3.0 GB",
+	} {
+		assert.Equal(t, expected, swhttp.FormatSize(size))
+	}
+
+	public := writeFiles(t, map[string]string{
+		"docs/big.bin":   strings.Repeat("x", 1536),
+		"docs/sub/a.txt": "a",
+		"docs/empty.txt": "",
+	})
+	modified := time.Date(2024, 3, 4, 5, 6, 0, 0, time.Local)
+	if err := os.Chtimes(filepath.Join(public, "docs", "big.bin"), modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	config := Configuration{Public: public}
+
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w := doRequest(handler, "GET", "/docs/", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "<i>1.5 KB</i>")
+		assert.Contains(t, w.Body.String(), "<i>0 B</i>")
+		assert.Contains(t, w.Body.String(), "<i>2024-03-04 05:06</i>")
+
+		w = doRequest(handler, "GET", "/docs/", map[string]string{"Accept": "application/json"})
+		var listing struct {
+			Files []struct {
+				Name     string     `json:"name"`
+				Size     *int64     `json:"size"`
+				Modified *time.Time `json:"modified"`
+			} `json:"files"`
+		}
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &listing))
+		sizes := map[string]int64{}
+		for _, file := range listing.Files[1:] {
+			assert.NotNil(t, file.Modified, file.Name)
+			if file.Size != nil {
+				sizes[file.Name] = *file.Size
+			}
+		}
+		assert.Equal(t, map[string]int64{"big.bin": 1536, "empty.txt": 0}, sizes)
+		assert.Equal(t, modified.Unix(), listing.Files[1].Modified.Unix())
+	}
+}
+
+func TestListingParentLink(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"a.txt":        "a",
+		"docs/b.txt":   "b",
+		"docs/x/c.txt": "c",
+	})
+
+	type listing struct {
+		Files []struct {
+			Name  string `json:"name"`
+			Url   string `json:"url"`
+			IsDir bool   `json:"isDir"`
+		} `json:"files"`
+	}
+	parent := func(handler http.Handler, target string) (string, bool) {
+		w := doRequest(handler, "GET", target, map[string]string{"Accept": "application/json"})
+		assert.Equal(t, http.StatusOK, w.Code, target)
+		var data listing
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &data))
+		if len(data.Files) == 0 || data.Files[0].Name != ".." {
+			return "", false
+		}
+		assert.True(t, data.Files[0].IsDir)
+		return data.Files[0].Url, true
+	}
+
+	config := Configuration{Public: public}
+	router := newTestRouter(config)
+	_, found := parent(router, "/")
+	assert.False(t, found)
+	url, _ := parent(router, "/docs/x/")
+	assert.Equal(t, "../", url)
+	w := doRequest(router, "GET", "/docs/", nil)
+	assert.Contains(t, w.Body.String(), `href="../"`)
+
+	legacy := newTestHandler(config)
+	_, found = parent(legacy, "/")
+	assert.False(t, found)
+	url, _ = parent(legacy, "/docs/x")
+	assert.Equal(t, "/docs", url)
+	url, _ = parent(legacy, "/docs")
+	assert.Equal(t, "/", url)
+
+	config.TrailingSlash = true
+	legacy = newTestHandler(config)
+	url, _ = parent(legacy, "/docs/x/")
+	assert.Equal(t, "/docs/", url)
+	url, _ = parent(legacy, "/docs/")
+	assert.Equal(t, "/", url)
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -11,38 +12,215 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/koblas/swerver/pkg/minimatch"
 	pathToRegExp "github.com/koblas/swerver/pkg/path_to_regexp"
+	"github.com/koblas/swerver/pkg/swhttp"
+	"github.com/koblas/swerver/pkg/trace"
 )
 
+// Cache size used when files are pre-warmed without an explicit cacheSize
+const defaultCacheSize = 64 * 1024 * 1024
+
 type HandlerState struct {
 	Configuration
-	logger Logger
+	logger     Logger
+	cache      *swhttp.Cache
+	dirNames   *swhttp.DirNames
+	compressed *swhttp.CompressionCache
+	dictionary *swhttp.BrotliDictionary
+	hits       *swhttp.HitCounter
+	thumbnails *swhttp.Thumbnailer
+	bundles    *bundleCache
+	proxies    []proxyRoute
+	// Parsed artificialDelay
+	delay time.Duration
+	// Paths of the health endpoints, empty when not answered
+	healthPath string
+	readyPath  string
+	etags      *swhttp.ETagger
+	blockRules []blockRule
+	themes     map[string]*template.Template
+	// Patterns of directoryIndexRules in the order they are tried
+	indexPatterns  []string
+	ipAccess       *ipAccess
+	listingLimiter *swhttp.Limiter
+	methodRules    []methodRule
+	ipLimit        *ipLimit
+	// extensionCache keyed by lower case extension
+	extensionCache map[string]int
 }
 
-// Implements http.Handler
-func NewHandler(config Configuration) HandlerState {
+// NewHandler builds the handler for config, an invalid configuration is
+// reported as an error
+func NewHandler(config Configuration) (HandlerState, error) {
+	config = applySafeMode(config)
 	state := HandlerState{
 		Configuration: config,
 		logger:        NewLogger(config.Debug),
 	}
 
+	var err error
+	if state.blockRules, err = compileBlockRules(config); err != nil {
+		return state, err
+	}
+	if state.themes, err = loadDirectoryThemes(config.DirectoryThemes); err != nil {
+		return state, err
+	}
+	if state.indexPatterns, err = compileDirectoryIndexRules(config.DirectoryIndexRules); err != nil {
+		return state, err
+	}
+	if state.ipAccess, err = compileIPAccess(config.IPAccess); err != nil {
+		return state, err
+	}
+	if state.methodRules, err = compileMethodRules(config); err != nil {
+		return state, err
+	}
+	if state.ipLimit, err = newIPLimit(config.MaxRequestsPerIP, config.IPAccess); err != nil {
+		return state, err
+	}
+	if state.extensionCache, err = compileExtensionCache(config.ExtensionCache); err != nil {
+		return state, err
+	}
+	if state.thumbnails, err = newThumbnailer(config); err != nil {
+		return state, err
+	}
+	if state.bundles, err = newBundleCache(config.Bundles); err != nil {
+		return state, err
+	}
+	if state.healthPath, state.readyPath, err = healthPaths(config); err != nil {
+		return state, err
+	}
+	if state.delay, err = parseTimeout("artificialDelay", config.ArtificialDelay); err != nil {
+		return state, err
+	}
+	if err := checkSettings(config); err != nil {
+		return state, err
+	}
+	if state.proxies, err = state.compileProxies(); err != nil {
+		return state, err
+	}
+
+	if config.MaxConcurrentListings > 0 {
+		wait, err := parseTimeout("listingWait", config.ListingWait)
+		if err != nil {
+			return state, err
+		}
+		state.listingLimiter = swhttp.NewLimiter(config.MaxConcurrentListings, wait)
+	}
+
+	if state.etags, err = swhttp.NewETagger(config.ETagAlgorithm); err != nil {
+		return state, err
+	}
+
+	if config.CompressionCacheDir != "" && !config.NoCompression {
+		if state.compressed, err = swhttp.NewCompressionCache(config.CompressionCacheDir); err != nil {
+			return state, err
+		}
+	}
+
+	if config.BrotliDictionary != "" && !config.NoCompression {
+		if state.dictionary, err = swhttp.NewBrotliDictionary(config.BrotliDictionary); err != nil {
+			return state, err
+		}
+	}
+
+	if config.HitCounter {
+		if state.hits, err = swhttp.NewHitCounter(config.HitCounterFile); err != nil {
+			return state, err
+		}
+	}
+
+	warnConflicts(config)
+
+	if config.StrictCase {
+		state.dirNames = swhttp.NewDirNames()
+	}
+
+	if config.CacheSize > 0 {
+		state.cache = swhttp.NewCache(config.CacheSize)
+	} else if len(config.Prewarm) != 0 {
+		state.cache = swhttp.NewCache(defaultCacheSize)
+	}
+	state.prewarm()
+
 	// return gziphandler.GzipHandler(state)
-	return state
+	return state, nil
 }
 
-func acceptJSON(r *http.Request) bool {
-	accept := r.Header[http.CanonicalHeaderKey("accept")]
+// checkSettings rejects the settings taking one of a few values when they
+// have any other
+func checkSettings(config Configuration) error {
+	for _, item := range config.Redirects {
+		switch item.Type {
+		case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+			http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			return fmt.Errorf("invalid redirect type %d for %s", item.Type, item.Source)
+		}
+	}
 
-	for _, value := range accept {
-		if strings.Contains(strings.ToLower(value), "application/json") {
-			return true
+	switch config.Precedence {
+	case "", PrecedenceRedirects, PrecedenceProxy:
+	default:
+		return fmt.Errorf("invalid precedence: %s", config.Precedence)
+	}
+
+	switch config.DirectoryPrecedence {
+	case "", swhttp.IndexFirst, swhttp.ListFirst, swhttp.Negotiate:
+	default:
+		return fmt.Errorf("invalid directoryPrecedence: %s", config.DirectoryPrecedence)
+	}
+
+	switch config.Backslashes {
+	case "", BackslashReject, BackslashNormalize:
+	default:
+		return fmt.Errorf("invalid backslashes: %s", config.Backslashes)
+	}
+
+	switch config.TraceConnectStatus {
+	case 0, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+	default:
+		return fmt.Errorf("invalid traceConnectStatus: %d", config.TraceConnectStatus)
+	}
+
+	switch config.DirectoryHeadStatus {
+	case 0, http.StatusOK, http.StatusForbidden, http.StatusNotFound:
+	default:
+		return fmt.Errorf("invalid directoryHeadStatus: %d", config.DirectoryHeadStatus)
+	}
+
+	switch config.ProxyCompression {
+	case "", ProxyCompressUpstream, ProxyCompressLocal:
+	default:
+		return fmt.Errorf("invalid proxyCompression: %s", config.ProxyCompression)
+	}
+
+	return nil
+}
+
+// prewarm loads the configured hot set of files into the in-memory cache
+func (state HandlerState) prewarm() {
+	if state.cache == nil {
+		return
+	}
+
+	root := state.root()
+	for _, name := range state.Prewarm {
+		if err := state.cache.Load(root, name); err != nil {
+			log.Printf("Unable to prewarm %s: %v", name, err)
+		} else {
+			state.logger.Debug("Prewarmed", name)
 		}
 	}
+}
 
-	return false
+// acceptJSON tells if the client prefers a JSON response
+func acceptJSON(r *http.Request) bool {
+	return swhttp.AcceptJSON(r)
 }
 
 func (state HandlerState) serveFile(w http.ResponseWriter, r *http.Request, name string) {
@@ -61,10 +239,59 @@ func (state HandlerState) serveFile(w http.ResponseWriter, r *http.Request, name
 		return
 	}
 
-	http.ServeContent(w, r, d.Name(), d.ModTime(), f)
+	state.setETag(w, name, d, f)
+	http.ServeContent(state.noRange(w, r, name), r, d.Name(), d.ModTime(), f)
+}
+
+// noRange drops the Range header of a request for a file matching
+// noRangePaths, the returned writer sends Accept-Ranges: none in place of
+// the bytes http.ServeContent always sets
+func (state HandlerState) noRange(w http.ResponseWriter, r *http.Request, name string) http.ResponseWriter {
+	rel, err := filepath.Rel(state.Public, name)
+	if err != nil || !matchesAny(slasher(filepath.ToSlash(rel)), state.NoRangePaths) {
+		return w
+	}
+
+	trace.Add(r, "no range %s", rel)
+	r.Header.Del("Range")
+	r.Header.Del("If-Range")
+
+	return &hookWriter{
+		ResponseWriter: w,
+		before: func(w http.ResponseWriter, status int) {
+			w.Header().Set("Accept-Ranges", "none")
+		},
+	}
+}
+
+// setETag sets the entity tag of the file so conditional requests can be
+// answered with a 304, a failure only means the response goes without it
+func (state HandlerState) setETag(w http.ResponseWriter, name string, d os.FileInfo, f io.ReadSeeker) {
+	if state.etags == nil || w.Header().Get("Etag") != "" {
+		return
+	}
+	tag, err := state.etags.Tag(name, d, f)
+	if err != nil {
+		log.Printf("Unable to compute the etag of %s: %s", name, err)
+		return
+	}
+	w.Header().Set("Etag", tag)
 }
 
 func (state HandlerState) sendError(w http.ResponseWriter, r *http.Request, path string, statusCode int) {
+	if value := state.errorCacheControl(statusCode); value != "" {
+		w.Header().Set("Cache-Control", value)
+	}
+
+	if statusCode == http.StatusNotFound && state.DirectoryFallback != "" {
+		if fallback := swhttp.FindFallback(http.Dir(state.Public), r.URL.Path, state.DirectoryFallback); fallback != "" {
+			trace.Add(r, "fallback %s", fallback)
+			w.WriteHeader(statusCode)
+			state.serveFile(w, r, filepath.Join(state.Public, filepath.FromSlash(fallback)))
+			return
+		}
+	}
+
 	errorPage := filepath.Join(state.Public, path, fmt.Sprintf("%d.html", statusCode))
 	_, err := os.Lstat(errorPage)
 	if err == nil {
@@ -77,12 +304,16 @@ func (state HandlerState) sendError(w http.ResponseWriter, r *http.Request, path
 		StatusCode int    `json:"-"`
 		Code       string `json:"code"`
 		Message    string `json:"message"`
+		Method     string `json:"-"`
+		Path       string `json:"-"`
+		// Existing paths close to a missing one
+		Suggestions []string `json:"suggestions,omitempty"`
 	}
 	type errorInfo = struct {
 		Error errorBodyType `json:"error"`
 	}
 
-	errorBody := errorBodyType{StatusCode: statusCode}
+	errorBody := errorBodyType{StatusCode: statusCode, Method: r.Method, Path: r.URL.Path}
 	switch statusCode {
 	case http.StatusBadRequest:
 		errorBody.Code = "bad_request"
@@ -90,9 +321,15 @@ func (state HandlerState) sendError(w http.ResponseWriter, r *http.Request, path
 	case http.StatusNotFound:
 		errorBody.Code = "not_found"
 		errorBody.Message = "The requested path could not be found"
+		if state.SuggestNotFound {
+			errorBody.Suggestions = swhttp.Suggestions(state.root(), r.URL.Path, swhttp.MaxSuggestions, state.listed)
+		}
 	case http.StatusInternalServerError:
 		errorBody.Code = "internal_server_error"
 		errorBody.Message = "A server error has occurred"
+	default:
+		errorBody.Code = strings.ReplaceAll(strings.ToLower(http.StatusText(statusCode)), " ", "_")
+		errorBody.Message = http.StatusText(statusCode)
 	}
 
 	if acceptJSON(r) {
@@ -132,50 +369,65 @@ func sourceMatches(source string, requestPath string, allowSegments bool) (bool,
 	slashed := slasher(source)
 	resolvedPath := path.Clean(requestPath)
 
+	compiled := compileSource(slashed, allowSegments)
+
 	if allowSegments {
-		normalized := strings.Replace(slashed, "*", "(.*)", -1)
-		matcher, err := pathToRegExp.PathToRegexp(normalized, pathToRegExp.NewOptions())
-		if err != nil {
+		if compiled.segments == nil {
 			return false, keys, []string{}
 		}
 
-		didMatch, result := matcher.MatchString(resolvedPath)
+		didMatch, result := compiled.segments.MatchString(resolvedPath)
 
 		if didMatch {
-			return true, keys, result.Results
+			return true, result.Keys(), result.Results
 		}
 	}
 
-	if ok, _ := minimatch.MatchString(resolvedPath, slashed, minimatch.Options{}); ok {
+	if compiled.glob != nil && compiled.glob.Match(resolvedPath, false) {
 		return true, keys, []string{}
 	}
 
 	return false, keys, []string{}
 }
 
-func applyRewrites(path string, rewrites []ConfigRewrite, repetitive bool) *string {
-	var fallback *string
-
-	if len(rewrites) == 0 {
-		return &path
-	}
-
-	rewritesCopy := rewrites[:]
-	offset := 0
-	for idx, item := range rewrites {
-		target := toTarget(item.Source, item.Destination, path)
+// applyRewrites applies every matching rewrite in turn, each rule at most
+// once, returning nil when no rule matched. A chain of rewrites leading
+// back to an earlier path is reported as a redirectLoopError.
+func applyRewrites(path string, query url.Values, rewrites []ConfigRewrite) (*string, error) {
+	remaining := append([]ConfigRewrite{}, rewrites...)
+	chain := []string{path}
+	var result *string
+
+	for {
+		matched := false
+		for idx, item := range remaining {
+			target := toTarget(item.Source, item.Destination, path, ruleQuery(item.MatchQuery, query))
+			if target == nil {
+				continue
+			}
 
-		if target != nil {
-			// Remove rules that were already applied
-			copy(rewritesCopy[:idx-offset], rewritesCopy[:idx-offset+1])
-			rewritesCopy = rewritesCopy[:len(rewritesCopy)-1]
-			offset++
+			var err error
+			path = slasher(*target)
+			if chain, err = extendChain(chain, path); err != nil {
+				return nil, err
+			}
+			rewritten := path
+			result = &rewritten
 
-			return applyRewrites(slasher(*target), rewritesCopy, true)
+			// Rules that were applied aren't tried again
+			remaining = append(remaining[:idx:idx], remaining[idx+1:]...)
+			matched = true
+			break
+		}
+		if !matched {
+			return result, nil
 		}
 	}
+}
 
-	return fallback
+// slashing tells if trailing slashes are added or removed by redirects
+func (state HandlerState) slashing() bool {
+	return state.TrailingSlash || state.NoTrailingSlash
 }
 
 func (state HandlerState) applicableClean(decodedPath string) bool {
@@ -192,14 +444,19 @@ func (state HandlerState) applicableClean(decodedPath string) bool {
 	return false
 }
 
-func (state HandlerState) shouldRedirect(decodedPath string, cleanUrl bool) (*string, int) {
-	slashing := false
-	defaultType := http.StatusTemporaryRedirect
-
-	if len(state.Redirects) == 0 && !slashing && !cleanUrl {
-		return nil, defaultType
+// shouldRedirect is the target and status of the redirect for decodedPath,
+// and whether the query string of the request should be carried over
+func (state HandlerState) shouldRedirect(decodedPath string, query url.Values, cleanUrl bool) (*string, int, bool) {
+	if target := state.slashRedirect(decodedPath, cleanUrl); target != nil {
+		return target, http.StatusTemporaryRedirect, true
 	}
 
+	return state.redirectRule(decodedPath, query)
+}
+
+// slashRedirect is the clean URL of decodedPath with the trailing slash
+// added or removed as configured, nil when it doesn't change
+func (state HandlerState) slashRedirect(decodedPath string, cleanUrl bool) *string {
 	cleanedUrl := false
 
 	// By stripping the HTML parts from the decoded
@@ -216,43 +473,43 @@ func (state HandlerState) shouldRedirect(decodedPath string, cleanUrl bool) (*st
 		}
 	}
 
-	if slashing {
+	if state.slashing() {
 		name := path.Base(decodedPath)
 		ext := path.Ext(decodedPath)
 		isTrailed := strings.HasSuffix(decodedPath, "/")
 		isDotfile := strings.HasPrefix(name, ".")
 
 		target := ""
-		if state.TrailingSlash && isTrailed {
-			target = decodedPath[0 : len(decodedPath)-1]
+		if state.NoTrailingSlash && isTrailed {
+			target = strings.TrimRight(decodedPath, "/")
 		} else if state.TrailingSlash && !isTrailed && ext == "" && !isDotfile {
 			target = decodedPath + "/"
 		}
 
-		decodedPath = strings.ReplaceAll(decodedPath, "//", "/")
-
 		if target != "" {
-			return &target, defaultType
+			value := ensureSlashStart(target)
+			return &value
 		}
 	}
 
 	if cleanedUrl {
 		value := ensureSlashStart(decodedPath)
-		return &value, defaultType
+		return &value
 	}
 
-	for _, item := range state.Redirects {
-		target := toTarget(item.Source, item.Destination, decodedPath)
+	return nil
+}
 
-		if target != nil {
-			if item.Type == 0 {
-				return target, defaultType
-			}
-			return target, item.Type
+// matchesAny tells if decodedPath matches one of sources, none matches
+// an empty list
+func matchesAny(decodedPath string, sources []string) bool {
+	for _, source := range sources {
+		if ok, _, _ := sourceMatches(source, decodedPath, false); ok {
+			return true
 		}
 	}
 
-	return nil, defaultType
+	return false
 }
 
 func applicable(decodedPath string, configEntry []string, noFlag bool) bool {
@@ -273,7 +530,9 @@ func applicable(decodedPath string, configEntry []string, noFlag bool) bool {
 }
 
 func (state HandlerState) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// TODO: Windows...
+	if !state.checkTraceConnect(w, r) || !state.checkBackslashes(w, r) {
+		return
+	}
 	relativePath := r.URL.Path
 	absolutePath := filepath.Join(state.Public, relativePath)
 
@@ -285,11 +544,17 @@ func (state HandlerState) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	cleanUrl := applicable(relativePath, state.CleanUrls, state.NoCleanUrls)
-	redirect, _ := state.shouldRedirect(relativePath, cleanUrl)
+	redirect, status, keepQuery := state.shouldRedirect(relativePath, r.URL.Query(), cleanUrl)
 
 	if redirect != nil {
-		state.logger.Debug("Redirecting", redirect)
-		http.Redirect(w, r, *redirect, http.StatusTemporaryRedirect)
+		if err := state.checkRedirectChain(relativePath, *redirect); err != nil {
+			state.sendLoopError(w, r, err)
+			return
+		}
+		target := state.carryQuery(r, *redirect, keepQuery)
+		state.logger.Debug("Redirecting", target)
+		trace.Add(r, "redirect %s", target)
+		http.Redirect(w, r, target, status)
 		return
 	}
 
@@ -310,27 +575,35 @@ func (state HandlerState) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if path.Ext(relativePath) != "" {
 		fileInfo, err := os.Lstat(absolutePath)
 		if err != nil && !os.IsNotExist(err) {
-			state.sendError(w, r, "/", http.StatusBadRequest)
+			state.sendStatError(w, r, err)
 			return
 		} else {
 			stats = fileInfo
 		}
 	}
 
-	rewrittenPath := applyRewrites(relativePath, state.Rewrites, false)
+	rewrittenPath, err := applyRewrites(relativePath, r.URL.Query(), state.Rewrites)
+	if err != nil {
+		state.sendLoopError(w, r, err)
+		return
+	}
+	if rewrittenPath != nil && *rewrittenPath != relativePath {
+		trace.Add(r, "rewrite %s -> %s", relativePath, *rewrittenPath)
+	}
 
 	if stats == nil && (cleanUrl || rewrittenPath != nil) {
 		tstats, tabsolutePath := findRelated(state.Public, relativePath, rewrittenPath)
 		if tstats != nil {
 			stats = tstats
 			absolutePath = tabsolutePath
+			trace.Add(r, "related %s", state.tracePath(absolutePath))
 		}
 	}
 
 	if stats == nil {
 		fileInfo, err := os.Lstat(absolutePath)
 		if err != nil && !os.IsNotExist(err) {
-			state.sendError(w, r, "/", http.StatusBadRequest)
+			state.sendStatError(w, r, err)
 			return
 		} else {
 			stats = fileInfo
@@ -338,7 +611,18 @@ func (state HandlerState) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if stats != nil && stats.IsDir() {
-		related, err := state.renderDirectory(state.Public, relativePath, absolutePath)
+		var filter minimatch.Minimatch
+		filterValue := ""
+		if state.DirectoryFilter {
+			filter, filterValue, err = swhttp.ListingFilter(r)
+			if err != nil {
+				trace.Add(r, "%v", err)
+				state.sendError(w, r, "/", http.StatusBadRequest)
+				return
+			}
+		}
+
+		related, err := state.renderDirectory(state.Public, relativePath, absolutePath, state.listingPagination(r.URL.Query()), filter, filterValue)
 
 		if err != nil {
 			fmt.Println(err)
@@ -349,8 +633,11 @@ func (state HandlerState) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if related.singleFile {
 			stats = related.stats
 			absolutePath = related.absolutePath
+			trace.Add(r, "single file %s", state.tracePath(absolutePath))
 		} else if related.outputData != nil {
+			trace.Add(r, "directory listing %s", relativePath)
 			if acceptJSON(r) {
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
 				if err := json.NewEncoder(w).Encode(related.outputData); err != nil {
 					log.Fatal(err)
 				}
@@ -381,20 +668,27 @@ func (state HandlerState) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// resolve the symlink and run a new `stat` call just for the
 	// target of that symlink.
 	if isSymLink {
-		var err error
-		absolutePath, err = os.Readlink(absolutePath)
-		if err != nil && !os.IsNotExist(err) {
-			state.sendError(w, r, "/", http.StatusBadRequest)
+		trace.Add(r, "symlink %s", state.tracePath(absolutePath))
+		target, err := os.Readlink(absolutePath)
+		if err != nil {
+			state.sendStatError(w, r, err)
 			return
 		}
+		// A relative target is relative to the directory of the link
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(absolutePath), target)
+		}
 
-		fileInfo, err := os.Lstat(absolutePath)
-		if err != nil && !os.IsNotExist(err) {
-			state.sendError(w, r, "/", http.StatusBadRequest)
+		// Stat follows the target if it is a link itself
+		fileInfo, err := os.Stat(target)
+		if os.IsNotExist(err) {
+			state.sendError(w, r, "/", http.StatusNotFound)
+			return
+		} else if err != nil {
+			state.sendStatError(w, r, err)
 			return
-		} else {
-			stats = fileInfo
 		}
+		absolutePath, stats = target, fileInfo
 	}
 
 	file, err := os.Open(absolutePath)
@@ -403,7 +697,11 @@ func (state HandlerState) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	http.ServeContent(w, r, absolutePath, stats.ModTime(), file)
+	defer file.Close()
+
+	trace.Add(r, "serve %s", state.tracePath(absolutePath))
+	state.setETag(w, absolutePath, stats, file)
+	http.ServeContent(state.noRange(w, r, absolutePath), r, absolutePath, stats.ModTime(), file)
 }
 
 func ensureSlashStart(target string) string {
@@ -413,7 +711,58 @@ func ensureSlashStart(target string) string {
 	return "/" + target
 }
 
-func toTarget(source, destination, previousPath string) *string {
+// ruleQuery returns the request query for rules matching on it, nil otherwise
+func ruleQuery(matchQuery bool, query url.Values) url.Values {
+	if !matchQuery {
+		return nil
+	}
+	if query == nil {
+		return url.Values{}
+	}
+	return query
+}
+
+// queryMatches checks the query part of a source, "q=:term&lang=en", against
+// the request query. A :name value captures the parameter, any other value
+// has to match exactly, parameters not named in the source are ignored.
+func queryMatches(source string, query url.Values) (bool, map[string]string) {
+	captures := map[string]string{}
+
+	for _, part := range strings.Split(source, "&") {
+		if part == "" {
+			continue
+		}
+		key, expected, _ := strings.Cut(part, "=")
+		if !query.Has(key) {
+			return false, nil
+		}
+		value := query.Get(key)
+
+		if strings.HasPrefix(expected, ":") {
+			captures[expected[1:]] = value
+		} else if value != expected {
+			return false, nil
+		}
+	}
+
+	return true, captures
+}
+
+// toTarget returns the destination when source matches the path, with a
+// non-nil query the source is matched against "path?query".
+func toTarget(source, destination, previousPath string, query url.Values) *string {
+	props := map[string]string{}
+
+	if query != nil {
+		sourcePath, sourceQuery, _ := strings.Cut(source, "?")
+		didMatch, captures := queryMatches(sourceQuery, query)
+		if !didMatch {
+			return nil
+		}
+		source = sourcePath
+		props = captures
+	}
+
 	didMatch, keys, results := sourceMatches(source, previousPath, true)
 
 	if !didMatch {
@@ -432,7 +781,6 @@ func toTarget(source, destination, previousPath string) *string {
 
 	toPath := pathToRegExp.Compile(normalizedDest)
 
-	props := map[string]string{}
 	for index, item := range keys {
 		props[item.Name] = results[index+1]
 	}
@@ -443,14 +791,24 @@ func toTarget(source, destination, previousPath string) *string {
 }
 
 type fileDetails struct {
-	Title    string
-	Base     string
-	Name     string
-	Ext      string
-	Dir      string
-	Size     int
-	Relative string
-	IsDir    bool
+	Title    string `json:"-"`
+	Base     string `json:"name"`
+	Name     string `json:"-"`
+	Ext      string `json:"-"`
+	Dir      string `json:"-"`
+	Size     *int64 `json:"size,omitempty"`
+	Relative string `json:"url"`
+	IsDir    bool   `json:"isDir"`
+	// Base shortened to maxNameLength for display
+	Display string `json:"-"`
+	// Modification time, empty when unknown
+	Modified *time.Time `json:"modified,omitempty"`
+	// Size and modification time formatted for display, directories
+	// have no size
+	SizeText     string `json:"-"`
+	ModifiedText string `json:"-"`
+	// Reduced copy of an image, when thumbnails are enabled
+	Thumbnail string `json:"thumbnail,omitempty"`
 }
 
 type pathPart struct {
@@ -459,8 +817,8 @@ type pathPart struct {
 }
 
 type breadcrumbsType struct {
-	Url  string
-	Name string
+	Url  string `json:"url"`
+	Name string `json:"name"`
 }
 
 type renderDirResult struct {
@@ -475,7 +833,7 @@ type renderDirResult struct {
 }
 
 // const renderDirectory = async (current, acceptsJSON, handlers, methods, config, paths) => {
-func (state HandlerState) renderDirectory(current string, relativePath string, absolutePath string) (renderDirResult, error) {
+func (state HandlerState) renderDirectory(current string, relativePath string, absolutePath string, page *listingPage, filter minimatch.Minimatch, filterValue string) (renderDirResult, error) {
 	trailingSlash := state.TrailingSlash
 	unlisted := state.Unlisted
 	renderSingle := state.RenderSingle
@@ -507,6 +865,9 @@ func (state HandlerState) renderDirectory(current string, relativePath string, a
 		if !canBeListed(unlisted, file.Name()) {
 			continue
 		}
+		if filter != nil && !filter.Match(file.Name(), false) {
+			continue
+		}
 
 		filePath := path.Join(absolutePath, file.Name())
 
@@ -516,7 +877,7 @@ func (state HandlerState) renderDirectory(current string, relativePath string, a
 			Ext:      path.Ext(file.Name()),
 			Dir:      path.Dir(file.Name()),
 			IsDir:    file.IsDir(),
-			Relative: relativePath + needSlash + file.Name(),
+			Relative: state.basePath() + relativePath + needSlash + file.Name(),
 		}
 
 		if file.IsDir() {
@@ -536,12 +897,16 @@ func (state HandlerState) renderDirectory(current string, relativePath string, a
 			details.Ext = "txt"
 		}
 
-		// 			details.size = bytes(stats.size, {
-		// 				unitSeparator: ' ',
-		// 				decimalPlaces: 0
-		// 			});
-		// 		}
+		modified := file.ModTime()
+		details.Modified = &modified
+		details.ModifiedText = swhttp.FormatModified(modified)
+		if !file.IsDir() {
+			size := file.Size()
+			details.Size = &size
+			details.SizeText = swhttp.FormatSize(size)
+		}
 		details.Title = details.Base
+		details.Display = swhttp.TruncateName(details.Base, state.MaxNameLength)
 
 		fileResult = append(fileResult, details)
 	}
@@ -598,10 +963,10 @@ func (state HandlerState) renderDirectory(current string, relativePath string, a
 	breadcrumbs := []breadcrumbsType{
 		{
 			Name: strings.Split(directory, "/")[0],
-			Url:  "/",
+			Url:  state.basePath() + "/",
 		},
 	}
-	parents := "/"
+	parents := state.basePath() + "/"
 
 	for _, path := range pathParts[1 : len(pathParts)-1] {
 		breadcrumbs = append(breadcrumbs, breadcrumbsType{
@@ -614,22 +979,58 @@ func (state HandlerState) renderDirectory(current string, relativePath string, a
 	fmt.Println(breadcrumbs)
 
 	type returnType struct {
-		Directory string
-		Index     []breadcrumbsType
-		Paths     []pathPart
-		Files     []fileDetails
+		Directory string            `json:"directory"`
+		Index     []breadcrumbsType `json:"breadcrumbs"`
+		Paths     []pathPart        `json:"-"`
+		Files     []fileDetails     `json:"files"`
+		// Filtering is enabled, with the active glob
+		Filterable bool   `json:"-"`
+		Filter     string `json:"filter,omitempty"`
+		// Only present for a paginated listing
+		*listingPage
+	}
+
+	if page != nil {
+		fileResult = page.apply(fileResult)
+	}
+
+	// Link to the parent directory first, unless this is the root
+	if parent := strings.TrimSuffix(relativePath, "/"); parent != "" {
+		relative := path.Dir(parent)
+		if relative != "/" {
+			relative += slashSuffix
+		}
+		fileResult = append([]fileDetails{{
+			Title:    relative,
+			Base:     "..",
+			Name:     "..",
+			Display:  "..",
+			IsDir:    true,
+			Relative: state.basePath() + relative,
+		}}, fileResult...)
 	}
 
 	return renderDirResult{
 		outputData: returnType{
-			Index:     breadcrumbs,
-			Files:     fileResult,
-			Directory: directory,
+			Index:      breadcrumbs,
+			Files:      fileResult,
+			Directory:  directory,
+			Filterable: state.DirectoryFilter,
+			Filter:     filterValue,
 			// Paths:     subPaths,
+			listingPage: page,
 		},
 	}, nil
 }
 
+// listed tells if the entry at name would show in the listing of its
+// directory
+func (state HandlerState) listed(name string) bool {
+	dir, file := path.Split(name)
+
+	return applicable(dir, state.DirectoryListing, state.NoDirectoryListing) && canBeListed(state.Unlisted, file)
+}
+
 func canBeListed(excluded []string, file string) bool {
 	slashed := slasher(file)
 
@@ -682,15 +1083,90 @@ func getPossiblePaths(relativePath, extension string) []string {
 }
 
 func (state HandlerState) AttachRoutes(router chi.Router) {
-	filesDir := http.Dir(state.Public)
+	if len(state.RemoveHeaders) != 0 {
+		router.Use(state.removeHeadersMiddleware)
+	}
+	if len(state.Headers) != 0 {
+		router.Use(state.headersMiddleware)
+	}
+	if state.Trace {
+		router.Use(state.traceMiddleware)
+	}
+	router.Use(state.hostMiddleware)
+	router.Use(state.traceConnectMiddleware)
+	router.Use(state.backslashMiddleware)
+	if state.ipAccess != nil {
+		router.Use(state.ipAccessMiddleware)
+	}
+	if state.ipLimit != nil {
+		router.Use(state.ipLimitMiddleware)
+	}
+	if state.delayEnabled() {
+		router.Use(state.delayMiddleware)
+	}
+	if len(state.methodRules) != 0 {
+		router.Use(state.methodsMiddleware)
+	}
+	router.Use(state.optionsMiddleware)
+	state.attachCompression(router)
+	if len(state.blockRules) != 0 {
+		router.Use(state.blockMiddleware)
+	}
+	if len(state.LanguagePrefixes) != 0 {
+		router.Use(state.languagePrefixMiddleware)
+	}
+	if len(state.Redirects) != 0 && state.Precedence != PrecedenceProxy {
+		router.Use(state.redirectsMiddleware)
+	}
 
 	hasCatchall := false
-	for _, item := range state.Proxy {
-		router.Handle(item.Source, NewProxy(item.Destination))
-		hasCatchall = hasCatchall || (item.Source == "/*")
+	for _, route := range state.proxies {
+		route.attach(router)
+		hasCatchall = hasCatchall || (route.source == "/*")
+	}
+	if len(state.Redirects) != 0 && state.Precedence == PrecedenceProxy {
+		// Only the paths left over by the proxies get redirected
+		router = router.With(state.redirectsMiddleware)
+	}
+	if state.hits != nil {
+		router.Get(hitsPath, state.serveHits)
+	}
+	if state.InfoEndpoint {
+		router.Get(infoPath, state.serveInfo)
+	}
+	if state.thumbnails != nil {
+		router.Get(thumbnailPath+"/*", state.serveThumbnail)
+	}
+	for name := range state.Bundles {
+		router.Get(name, state.serveBundle)
+		router.Head(name, state.serveBundle)
+	}
+	if state.healthPath != "" {
+		router.Get(state.healthPath, state.serveHealth)
+		router.Head(state.healthPath, state.serveHealth)
+	}
+	if state.readyPath != "" {
+		router.Get(state.readyPath, state.serveReady)
+		router.Head(state.readyPath, state.serveReady)
 	}
 	// Default
 	if !hasCatchall {
-		router.Get("/*", state.sendFile(filesDir))
+		files := state.sendFile(state.root())
+		static := router
+		if state.slashing() || !state.NoCleanUrls {
+			static = static.With(state.slashRedirectsMiddleware)
+		}
+		if len(state.Rewrites) != 0 {
+			static = static.With(state.rewritesMiddleware)
+		}
+		static.Get("/*", files)
+		static.Head("/*", files)
+	}
+	if state.AllowUploads {
+		router.Put("/*", state.uploadFile)
+		router.Delete("/*", state.deleteFile)
+		if state.AllowBatch {
+			router.Post(batchPath, state.batchOperations)
+		}
 	}
 }
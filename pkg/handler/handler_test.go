@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeFiles creates a temporary public directory populated with files
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		full := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+// newTestHandler is NewHandler for configurations known to be valid
+func newTestHandler(config Configuration) HandlerState {
+	state, err := NewHandler(config)
+	if err != nil {
+		panic(err)
+	}
+
+	return state
+}
+
+func newTestRouter(config Configuration) chi.Router {
+	router := chi.NewRouter()
+	newTestHandler(config).AttachRoutes(router)
+
+	return router
+}
+
+func doRequest(handler http.Handler, method, target string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestPrewarmCache(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html": "<h1>hello</h1>",
+		"app.js":     "console.log('hello')",
+		"other.js":   "console.log('other')",
+	})
+
+	router := newTestRouter(Configuration{
+		Public:  public,
+		Prewarm: []string{"/app.js", "/missing.js"},
+	})
+
+	w := doRequest(router, "GET", "/app.js", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Equal(t, "console.log('hello')", w.Body.String())
+
+	w = doRequest(router, "GET", "/other.js", nil)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	w = doRequest(router, "GET", "/other.js", nil)
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+}
+
+func TestCacheAge(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"app.js": "console.log('hello')",
+	})
+	router := newTestRouter(Configuration{Public: public, CacheSize: 1024})
+
+	w := doRequest(router, "GET", "/app.js", nil)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "0", w.Header().Get("Age"))
+	assert.NotEmpty(t, w.Header().Get("Date"))
+
+	time.Sleep(1100 * time.Millisecond)
+
+	w = doRequest(router, "GET", "/app.js", nil)
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Equal(t, "1", w.Header().Get("Age"))
+	date, err := http.ParseTime(w.Header().Get("Date"))
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), date, 2*time.Second)
+}
+
+func TestPrewarmRespectsCacheSize(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"big.txt": "0123456789",
+	})
+
+	router := newTestRouter(Configuration{
+		Public:    public,
+		CacheSize: 5,
+		Prewarm:   []string{"/big.txt"},
+	})
+
+	w := doRequest(router, "GET", "/big.txt", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "0123456789", w.Body.String())
+}
+
+func TestCacheEviction(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"a.txt": "aaaaaaaaaa",
+		"b.txt": "bbbbbbbbbb",
+		"c.txt": "cccccccccc",
+	})
+	router := newTestRouter(Configuration{Public: public, CacheSize: 25})
+
+	for _, step := range []struct{ name, cache string }{
+		{"/a.txt", "MISS"},
+		{"/b.txt", "MISS"},
+		{"/a.txt", "HIT"},
+		// b is the least recently used and makes room for c
+		{"/c.txt", "MISS"},
+		{"/c.txt", "HIT"},
+		{"/a.txt", "HIT"},
+		{"/b.txt", "MISS"},
+	} {
+		w := doRequest(router, "GET", step.name, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, step.cache, w.Header().Get("X-Cache"), step.name)
+	}
+
+	// A changed file replaces its entry
+	name := filepath.Join(public, "a.txt")
+	assert.NoError(t, os.WriteFile(name, []byte("AAAAAAAAAA"), 0o644))
+	assert.NoError(t, os.Chtimes(name, time.Now(), time.Now().Add(time.Hour)))
+	w := doRequest(router, "GET", "/a.txt", nil)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "AAAAAAAAAA", w.Body.String())
+	w = doRequest(router, "GET", "/a.txt", nil)
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+}
+
+func TestNewHandlerInvalid(t *testing.T) {
+	public := writeFiles(t, map[string]string{"index.html": "index"})
+
+	configs := map[string]Configuration{
+		"block pattern":        {BlockUserAgents: []string{"("}},
+		"theme":                {DirectoryThemes: map[string]string{"missing": filepath.Join(public, "missing.html")}},
+		"index rule":           {DirectoryIndexRules: map[string]string{"[": "index.htm"}},
+		"ip access":            {IPAccess: ConfigIPAccess{Allow: []string{"10.0.0.300"}}},
+		"methods":              {Methods: []ConfigMethods{{Source: "/**", Methods: []string{}}}},
+		"extension cache":      {ExtensionCache: map[string]int{".css": -1}},
+		"thumbnail size":       {Thumbnails: true, ThumbnailSize: 5000},
+		"bundle path":          {Bundles: map[string][]string{"bundle.css": {"/*.css"}}},
+		"health path":          {Health: ConfigHealth{Path: "healthz"}},
+		"artificial delay":     {ArtificialDelay: "1 second"},
+		"listing wait":         {MaxConcurrentListings: 2, ListingWait: "soon"},
+		"redirect type":        {Redirects: []ConfigRedirect{{Source: "/a", Destination: "/b", Type: 200}}},
+		"precedence":           {Precedence: "random"},
+		"directory precedence": {DirectoryPrecedence: "indexfirst"},
+		"backslashes":          {Backslashes: "keep"},
+		"trace connect":        {TraceConnectStatus: 403},
+		"directory head":       {DirectoryHeadStatus: 500},
+		"proxy compression":    {ProxyCompression: "both"},
+		"proxy destination":    {Proxy: []ConfigProxy{{Source: "/api/**", Destination: "ftp://example.com"}}},
+		"proxy source":         {Proxy: []ConfigProxy{{Source: "/api/*.json", Destination: "http://example.com"}}},
+		"proxy timeout":        {Proxy: []ConfigProxy{{Source: "/api/**", Destination: "http://example.com"}}, ProxyDialTimeout: "5"},
+		"etag algorithm":       {ETagAlgorithm: "md4"},
+	}
+	for name, config := range configs {
+		config.Public = public
+		_, err := NewHandler(config)
+		assert.Error(t, err, name)
+	}
+}
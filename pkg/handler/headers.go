@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"net/http"
+)
+
+// headersMiddleware sets the headers of every rule whose source matches the
+// request path just before the response is sent, so they replace whatever
+// the server set. Rules are applied in order, a later rule overrides the
+// headers of an earlier one and an empty value removes the header.
+func (state HandlerState) headersMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apply := func(header http.Header) {
+			for _, rule := range state.Headers {
+				if ok, _, _ := sourceMatches(rule.Source, r.URL.Path, false); !ok {
+					continue
+				}
+				for _, item := range rule.Headers {
+					if item.Value == "" {
+						header.Del(item.Key)
+					} else {
+						header.Set(item.Key, item.Value)
+					}
+				}
+			}
+		}
+
+		hook := &hookWriter{
+			ResponseWriter: w,
+			before: func(w http.ResponseWriter, status int) {
+				apply(w.Header())
+			},
+		}
+
+		next.ServeHTTP(hook, r)
+
+		// Nothing was written, the server sends the headers on return
+		if !hook.wroteHeader {
+			apply(w.Header())
+		}
+	})
+}
+
+// removeHeadersMiddleware strips the configured headers from every response
+// just before it is sent, whichever layer set them.
+func (state HandlerState) removeHeadersMiddleware(next http.Handler) http.Handler {
+	remove := func(header http.Header) {
+		for _, name := range state.RemoveHeaders {
+			header.Del(name)
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hook := &hookWriter{
+			ResponseWriter: w,
+			before: func(w http.ResponseWriter, status int) {
+				remove(w.Header())
+			},
+		}
+
+		next.ServeHTTP(hook, r)
+
+		// Nothing was written, the server sends the headers on return
+		if !hook.wroteHeader {
+			remove(w.Header())
+		}
+	})
+}
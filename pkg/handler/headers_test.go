@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveHeaders(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"page.txt": "page",
+	})
+	config := Configuration{
+		Public:        public,
+		RemoveHeaders: []string{"x-powered-by", "Last-Modified"},
+	}
+
+	router := chi.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Powered-By", "swerver")
+			next.ServeHTTP(w, r)
+		})
+	})
+	newTestHandler(config).AttachRoutes(router)
+
+	w := doRequest(router, "GET", "/page.txt", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "page", w.Body.String())
+	assert.Empty(t, w.Header().Get("X-Powered-By"))
+	assert.Empty(t, w.Header().Get("Last-Modified"))
+	assert.NotEmpty(t, w.Header().Get("Content-Type"))
+
+	w = doRequest(router, "GET", "/missing", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get("X-Powered-By"))
+
+	w = doRequest(newTestRouter(Configuration{Public: public}), "GET", "/page.txt", nil)
+	assert.NotEmpty(t, w.Header().Get("Last-Modified"))
+}
+
+func TestHeaders(t *testing.T) {
+	config, err := ReadServeConfiguration(strings.NewReader(`{
+		"headers": [
+			{"source": "**", "headers": [{"key": "Access-Control-Allow-Origin", "value": "*"}]},
+			{"source": "**/*.js", "headers": [{"key": "Cache-Control", "value": "max-age=7200"}]},
+			{"source": "/vendor/**", "headers": [{"key": "Cache-Control", "value": "max-age=31536000, immutable"}]},
+			{"source": "/private/**", "headers": [{"key": "Access-Control-Allow-Origin", "value": null}]}
+		]
+	}`))
+	assert.Nil(t, err)
+	config.Public = writeFiles(t, map[string]string{
+		"index.html":        "index",
+		"app.js":            "app",
+		"vendor/lib.js":     "lib",
+		"private/notes.txt": "notes",
+	})
+	router := newTestRouter(config)
+
+	w := doRequest(router, "GET", "/", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Cache-Control"))
+
+	w = doRequest(router, "GET", "/app.js", nil)
+	assert.Equal(t, "max-age=7200", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+
+	// The later rule wins
+	w = doRequest(router, "GET", "/vendor/lib.js", nil)
+	assert.Equal(t, "max-age=31536000, immutable", w.Header().Get("Cache-Control"))
+
+	w = doRequest(router, "GET", "/private/notes.txt", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Values("Access-Control-Allow-Origin"))
+
+	w = doRequest(router, "GET", "/missing.js", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "max-age=7200", w.Header().Get("Cache-Control"))
+}
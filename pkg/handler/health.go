@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/koblas/swerver/pkg/swhttp"
+	"github.com/koblas/swerver/pkg/trace"
+)
+
+// Liveness endpoint used when health.path isn't given
+const defaultHealthPath = "/healthz"
+
+type healthStatus struct {
+	Status string `json:"status"`
+}
+
+// healthPaths checks the health configuration and returns the liveness and
+// readiness paths to answer, empty when disabled. A path where the public
+// directory has a file is left to the file unless override is set, this is
+// only checked at startup so the probes never touch the filesystem.
+func healthPaths(config Configuration) (string, string, error) {
+	health := config.Health
+	if health.Disabled {
+		return "", "", nil
+	}
+
+	live := health.Path
+	if live == "" {
+		live = defaultHealthPath
+	}
+	for _, name := range []string{live, health.ReadyPath} {
+		if name != "" && (name[0] != '/' || name == "/" || path.Clean(name) != name) {
+			return "", "", fmt.Errorf("invalid health path %q", name)
+		}
+	}
+	if live == health.ReadyPath {
+		return "", "", fmt.Errorf("the health path and readyPath are both %s", live)
+	}
+
+	return healthPath(config, live), healthPath(config, health.ReadyPath), nil
+}
+
+// healthPath is name unless a file, or its clean URL, exists at name
+func healthPath(config Configuration, name string) string {
+	if name == "" || config.Health.Override {
+		return name
+	}
+
+	file := filepath.Join(config.Public, filepath.FromSlash(name))
+	for _, candidate := range []string{file, file + ".html"} {
+		if _, err := os.Lstat(candidate); err == nil {
+			log.Printf("Serving %s from the public directory, set health.override to answer health checks there", name)
+			return ""
+		}
+	}
+
+	return name
+}
+
+func sendHealth(w http.ResponseWriter, code int, status string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(healthStatus{status})
+}
+
+// serveHealth answers liveness probes, it only tells the server is running
+func (state HandlerState) serveHealth(w http.ResponseWriter, r *http.Request) {
+	sendHealth(w, http.StatusOK, "ok")
+}
+
+// serveReady answers readiness probes, with a 503 while the public
+// directory can't be read
+func (state HandlerState) serveReady(w http.ResponseWriter, r *http.Request) {
+	f, err := state.root().Open("/")
+	if err == nil {
+		_, err = f.Readdir(1)
+		f.Close()
+	}
+	if err != nil && err != io.EOF {
+		log.Printf("Public directory unavailable: %v", err)
+		trace.Add(r, "not ready: %v", err)
+		swhttp.SetRetryAfter(w, state.RetryAfter)
+		sendHealth(w, http.StatusServiceUnavailable, "unavailable")
+		return
+	}
+
+	sendHealth(w, http.StatusOK, "ok")
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthEndpoint(t *testing.T) {
+	public := writeFiles(t, map[string]string{"index.html": "home"})
+	config := Configuration{Public: public}
+	config.Health.ReadyPath = "/readyz"
+
+	router := newTestRouter(config)
+	for _, target := range []string{"/healthz", "/readyz"} {
+		w := doRequest(router, "GET", target, nil)
+		assert.Equal(t, http.StatusOK, w.Code, target)
+		assert.Equal(t, "{\"status\":\"ok\"}\n", w.Body.String())
+		assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	}
+
+	// Readiness fails once the public directory is gone, liveness doesn't
+	assert.Nil(t, os.RemoveAll(public))
+	w := doRequest(router, "GET", "/readyz", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "{\"status\":\"unavailable\"}\n", w.Body.String())
+	w = doRequest(router, "GET", "/healthz", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHealthPathConfigured(t *testing.T) {
+	public := writeFiles(t, map[string]string{"index.html": "home"})
+	config := Configuration{Public: public}
+	config.Health.Path = "/-/live"
+
+	router := newTestRouter(config)
+	w := doRequest(router, "GET", "/-/live", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "{\"status\":\"ok\"}\n", w.Body.String())
+	w = doRequest(router, "GET", "/healthz", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	config.Health.Disabled = true
+	router = newTestRouter(config)
+	w = doRequest(router, "GET", "/-/live", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHealthPathFile(t *testing.T) {
+	public := writeFiles(t, map[string]string{"healthz": "from disk"})
+	config := Configuration{Public: public}
+
+	router := newTestRouter(config)
+	w := doRequest(router, "GET", "/healthz", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "from disk", w.Body.String())
+
+	// A clean URL counts as a file
+	assert.Nil(t, os.Rename(filepath.Join(public, "healthz"), filepath.Join(public, "healthz.html")))
+	w = doRequest(newTestRouter(config), "GET", "/healthz", nil)
+	assert.Equal(t, "from disk", w.Body.String())
+
+	config.Health.Override = true
+	router = newTestRouter(config)
+	w = doRequest(router, "GET", "/healthz", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "{\"status\":\"ok\"}\n", w.Body.String())
+}
@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Endpoint reporting the download counts when hitCounter is enabled
+const hitsPath = "/__hits"
+
+// serveHits answers with the download count of every file, or of the
+// single file given by ?path=
+func (state HandlerState) serveHits(w http.ResponseWriter, r *http.Request) {
+	var result interface{}
+
+	if name := r.URL.Query().Get("path"); name != "" {
+		result = map[string]int64{name: state.hits.Get(name)}
+	} else {
+		result = state.hits.Counts()
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(result)
+}
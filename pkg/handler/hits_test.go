@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHitCounter(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"files/a.zip": "a",
+		"files/b.zip": "b",
+	})
+	counts := filepath.Join(t.TempDir(), "hits.json")
+	config := Configuration{Public: public, HitCounter: true, HitCounterFile: counts}
+	router := newTestRouter(config)
+
+	for i := 0; i < 3; i++ {
+		w := doRequest(router, "GET", "/files/a.zip", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	// Neither a HEAD nor a missing file is a download
+	doRequest(router, "HEAD", "/files/b.zip", nil)
+	doRequest(router, "GET", "/files/c.zip", nil)
+
+	w := doRequest(router, "GET", "/files/", nil)
+	assert.Contains(t, w.Body.String(), "3 downloads")
+
+	w = doRequest(router, "GET", hitsPath, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	result := map[string]int64{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, map[string]int64{"/files/a.zip": 3}, result)
+
+	w = doRequest(router, "GET", hitsPath+"?path=/files/b.zip", nil)
+	assert.JSONEq(t, `{"/files/b.zip": 0}`, w.Body.String())
+
+	// The counts are loaded back from the file
+	router = newTestRouter(config)
+	doRequest(router, "GET", "/files/a.zip", nil)
+	w = doRequest(router, "GET", hitsPath+"?path=/files/a.zip", nil)
+	assert.JSONEq(t, `{"/files/a.zip": 4}`, w.Body.String())
+
+	w = doRequest(newTestRouter(Configuration{Public: public}), "GET", hitsPath, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
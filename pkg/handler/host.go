@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/koblas/swerver/pkg/trace"
+)
+
+// hostMiddleware deals with requests that came without a Host header, only
+// possible with HTTP/1.0. They are given the defaultHost, or refused with a
+// 400 when there is none, so nothing builds a URL on an empty host. A fully
+// qualified host (example.com.) loses its trailing dot unless keepHostDot
+// is set, so it is matched like the name it stands for.
+func (state HandlerState) hostMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "" {
+			if !state.KeepHostDot {
+				if host := trimHostDot(r.Host); host != r.Host {
+					trace.Add(r, "host %s", host)
+					r.Host = host
+				}
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if state.DefaultHost == "" {
+			log.Printf("Rejected request for %s without a Host header", r.URL.Path)
+			trace.Add(r, "missing host")
+			state.sendError(w, r, "/", http.StatusBadRequest)
+			return
+		}
+
+		trace.Add(r, "default host %s", state.DefaultHost)
+		r.Host = state.DefaultHost
+		next.ServeHTTP(w, r)
+	})
+}
+
+// trimHostDot removes the trailing dot of a host name, keeping its port
+func trimHostDot(host string) string {
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		name, port = host, ""
+	}
+	if len(name) < 2 || !strings.HasSuffix(name, ".") {
+		return host
+	}
+	name = strings.TrimSuffix(name, ".")
+	if port == "" {
+		return name
+	}
+
+	return net.JoinHostPort(name, port)
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMissingHost(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html": "index",
+	})
+
+	noHost := func(router http.Handler) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Proto, req.ProtoMajor, req.ProtoMinor = "HTTP/1.0", 1, 0
+		req.Host = ""
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := noHost(newTestRouter(Configuration{Public: public}))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = noHost(newTestRouter(Configuration{Public: public, DefaultHost: "www.example.com", Trace: true}))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "index", w.Body.String())
+	assert.Contains(t, w.Header().Get(traceHeader), "default host www.example.com")
+
+	w = doRequest(newTestRouter(Configuration{Public: public}), "GET", "/", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestTrailingDotHost(t *testing.T) {
+	for host, expected := range map[string]string{
+		"www.example.com.":      "www.example.com",
+		"www.example.com.:8080": "www.example.com:8080",
+		"www.example.com":       "www.example.com",
+		"[::1]:80":              "[::1]:80",
+		".":                     ".",
+	} {
+		assert.Equal(t, expected, trimHostDot(host), host)
+	}
+
+	public := writeFiles(t, map[string]string{
+		"index.html": "index",
+	})
+
+	w := doRequest(newTestRouter(Configuration{Public: public, Trace: true}), "GET", "http://www.example.com./", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get(traceHeader), "host www.example.com")
+	assert.NotContains(t, w.Header().Get(traceHeader), "host www.example.com.")
+
+	w = doRequest(newTestRouter(Configuration{Public: public, Trace: true, KeepHostDot: true}), "GET", "http://www.example.com./", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Header().Get(traceHeader), "host www.example.com")
+
+	// Host rules are written without the dot
+	var config Configuration
+	config.Ssl.RedirectAddr = "80"
+	w = doRequest(NewRedirectServer(config).Handler, "GET", "http://www.example.com./a", nil)
+	assert.Equal(t, "https://www.example.com/a", w.Header().Get("Location"))
+
+	config.KeepHostDot = true
+	w = doRequest(NewRedirectServer(config).Handler, "GET", "http://www.example.com./a", nil)
+	assert.Equal(t, "https://www.example.com./a", w.Header().Get("Location"))
+}
@@ -0,0 +1,18 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/koblas/swerver/pkg/version"
+)
+
+// Endpoint reporting the build information when infoEndpoint is enabled
+const infoPath = "/__info"
+
+// serveInfo answers with the version, build and uptime of the server
+func (state HandlerState) serveInfo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(version.Get())
+}
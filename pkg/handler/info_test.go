@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"testing"
+
+	"github.com/koblas/swerver/pkg/version"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInfoEndpoint(t *testing.T) {
+	public := writeFiles(t, map[string]string{"index.html": "hello"})
+
+	w := doRequest(newTestRouter(Configuration{Public: public}), "GET", infoPath, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	version.Commit, version.Date = "abc1234", "2024-01-02T03:04:05Z"
+	defer func() { version.Commit, version.Date = "", "" }()
+
+	w = doRequest(newTestRouter(Configuration{Public: public, InfoEndpoint: true}), "GET", infoPath, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	var info map[string]interface{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(t, version.Version, info["version"])
+	assert.Equal(t, "abc1234", info["commit"])
+	assert.Equal(t, "2024-01-02T03:04:05Z", info["date"])
+	assert.Equal(t, runtime.Version(), info["goVersion"])
+	assert.GreaterOrEqual(t, info["uptime"], float64(0))
+
+	assert.Equal(t, version.Version+" (abc1234, built 2024-01-02T03:04:05Z) "+runtime.Version(), version.String())
+}
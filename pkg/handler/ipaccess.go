@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/koblas/swerver/pkg/trace"
+)
+
+type ipAccess struct {
+	allow   []*net.IPNet
+	deny    []*net.IPNet
+	trusted []*net.IPNet
+	paths   []string
+}
+
+// parseNetworks reads a list of addresses and CIDR ranges, a plain
+// address stands for itself
+func parseNetworks(name string, values []string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			if ip := net.ParseIP(value); ip != nil && ip.To4() != nil {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s entry: %v", name, err)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// compileIPAccess parses the ipAccess configuration, nil when it has no
+// rules
+func compileIPAccess(config ConfigIPAccess) (*ipAccess, error) {
+	if len(config.Allow) == 0 && len(config.Deny) == 0 {
+		return nil, nil
+	}
+
+	access := &ipAccess{paths: config.Paths}
+	var err error
+	if access.allow, err = parseNetworks("ipAccess allow", config.Allow); err != nil {
+		return nil, err
+	}
+	if access.deny, err = parseNetworks("ipAccess deny", config.Deny); err != nil {
+		return nil, err
+	}
+	if access.trusted, err = parseNetworks("ipAccess trustedProxies", config.TrustedProxies); err != nil {
+		return nil, err
+	}
+
+	return access, nil
+}
+
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP resolves the address of the client, when the request came
+// through trusted proxies the last untrusted X-Forwarded-For entry is used
+func clientIP(r *http.Request, trusted []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !contains(trusted, ip) {
+		return ip
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for idx := len(forwarded) - 1; idx >= 0; idx-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[idx]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !contains(trusted, ip) {
+			break
+		}
+	}
+
+	return ip
+}
+
+func (access *ipAccess) clientIP(r *http.Request) net.IP {
+	return clientIP(r, access.trusted)
+}
+
+// allowed tells if the client, whose address is returned, may access the
+// request path
+func (access *ipAccess) allowed(r *http.Request) (net.IP, bool) {
+	ip := access.clientIP(r)
+
+	if len(access.paths) != 0 && !matchesAny(r.URL.Path, access.paths) {
+		return ip, true
+	}
+	if ip == nil || contains(access.deny, ip) {
+		return ip, false
+	}
+
+	return ip, len(access.allow) == 0 || contains(access.allow, ip)
+}
+
+// ipAccessMiddleware refuses clients outside of the allow list or on the
+// deny list
+func (state HandlerState) ipAccessMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip, ok := state.ipAccess.allowed(r); !ok {
+			log.Printf("Denied %v access to %s", ip, r.URL.Path)
+			trace.Add(r, "ip denied")
+			state.sendError(w, r, "/", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
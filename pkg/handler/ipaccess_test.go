@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func requestFrom(handler http.Handler, target, remoteAddr string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", target, nil)
+	req.RemoteAddr = remoteAddr
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestIPAccess(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html":       "index",
+		"admin/index.html": "admin",
+	})
+	router := newTestRouter(Configuration{
+		Public: public,
+		IPAccess: ConfigIPAccess{
+			Allow: []string{"10.0.0.0/8", "2001:db8::/32"},
+			Deny:  []string{"10.6.6.0/24", "10.7.7.7"},
+		},
+	})
+
+	w := requestFrom(router, "/", "10.1.2.3:4000", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = requestFrom(router, "/", "[2001:db8::1]:4000", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	for _, addr := range []string{"192.168.1.1:4000", "10.6.6.200:4000", "10.7.7.7:4000", "[2001:db9::1]:4000"} {
+		w = requestFrom(router, "/", addr, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code, addr)
+		assert.Contains(t, w.Body.String(), "Forbidden")
+	}
+	w = requestFrom(router, "/", "10.7.7.8:4000", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestIPAccessScoped(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html":       "index",
+		"admin/users.json": "[]",
+	})
+	router := newTestRouter(Configuration{
+		Public: public,
+		IPAccess: ConfigIPAccess{
+			Allow:          []string{"10.0.0.0/8"},
+			Paths:          []string{"/admin/**"},
+			TrustedProxies: []string{"192.168.0.1"},
+		},
+	})
+
+	w := requestFrom(router, "/", "192.168.1.1:4000", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = requestFrom(router, "/admin/users.json", "192.168.1.1:4000", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Only a trusted proxy may name the client
+	w = requestFrom(router, "/admin/users.json", "192.168.0.1:4000", map[string]string{"X-Forwarded-For": "10.1.1.1"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = requestFrom(router, "/admin/users.json", "192.168.0.1:4000", map[string]string{"X-Forwarded-For": "10.1.1.1, 172.16.0.1"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = requestFrom(router, "/admin/users.json", "192.168.5.5:4000", map[string]string{"X-Forwarded-For": "10.1.1.1"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
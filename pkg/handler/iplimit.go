@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/koblas/swerver/pkg/trace"
+)
+
+// ipLimit counts the requests in flight for each client address
+type ipLimit struct {
+	max     int
+	trusted []*net.IPNet
+
+	mu     sync.Mutex
+	active map[string]int
+}
+
+// newIPLimit allows max requests at once per client, nil when max isn't
+// positive. Clients behind the trusted proxies of ipAccess are told apart
+// by their X-Forwarded-For address.
+func newIPLimit(max int, config ConfigIPAccess) (*ipLimit, error) {
+	if max <= 0 {
+		return nil, nil
+	}
+
+	trusted, err := parseNetworks("ipAccess trustedProxies", config.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ipLimit{
+		max:     max,
+		trusted: trusted,
+		active:  map[string]int{},
+	}, nil
+}
+
+func (limit *ipLimit) acquire(key string) bool {
+	limit.mu.Lock()
+	defer limit.mu.Unlock()
+
+	if limit.active[key] >= limit.max {
+		return false
+	}
+	limit.active[key]++
+
+	return true
+}
+
+func (limit *ipLimit) release(key string) {
+	limit.mu.Lock()
+	defer limit.mu.Unlock()
+
+	// Drop idle clients so the map doesn't grow with every address seen
+	if limit.active[key] <= 1 {
+		delete(limit.active, key)
+	} else {
+		limit.active[key]--
+	}
+}
+
+// ipLimitMiddleware answers with a 429 once a client has too many
+// requests in flight, like parallel downloads
+func (state HandlerState) ipLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.RemoteAddr
+		if ip := clientIP(r, state.ipLimit.trusted); ip != nil {
+			key = ip.String()
+		}
+
+		if !state.ipLimit.acquire(key) {
+			log.Printf("Too many requests from %s for %s", key, r.URL.Path)
+			trace.Add(r, "ip limit reached")
+			w.Header().Set("Retry-After", "1")
+			state.sendError(w, r, "/", http.StatusTooManyRequests)
+			return
+		}
+		defer state.ipLimit.release(key)
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxRequestsPerIP(t *testing.T) {
+	state := newTestHandler(Configuration{Public: t.TempDir(), MaxRequestsPerIP: 2})
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	handler := state.ipLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			entered <- struct{}{}
+			<-release
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := requestFrom(handler, "/slow", "10.0.0.1:1234", nil)
+			assert.Equal(t, http.StatusOK, w.Code)
+		}()
+		<-entered
+	}
+
+	// The third request from the same address is refused
+	w := requestFrom(handler, "/fast", "10.0.0.1:5678", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	// Another client is unaffected
+	w = requestFrom(handler, "/fast", "10.0.0.2:1234", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	close(release)
+	wg.Wait()
+
+	w = requestFrom(handler, "/fast", "10.0.0.1:5678", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, state.ipLimit.active)
+}
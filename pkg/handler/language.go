@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/koblas/swerver/pkg/trace"
+)
+
+// Cookie recording the language picked through a path prefix
+const languageCookie = "lang"
+
+// languagePrefixMiddleware strips a recognized leading language segment,
+// /fr/about is served as /about, and records the language in the lang
+// cookie and the Content-Language header.
+func (state HandlerState) languagePrefixMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang := state.DefaultLanguage
+
+		segment, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		for _, prefix := range state.LanguagePrefixes {
+			if !strings.EqualFold(segment, prefix) {
+				continue
+			}
+			lang = prefix
+			trace.Add(r, "language prefix %s", prefix)
+
+			// Leave the caller's request untouched
+			r = r.Clone(r.Context())
+			r.URL.Path = "/" + rest
+			r.URL.RawPath = ""
+			// Let language negotiation pick the matching document
+			r.Header.Set("Accept-Language", prefix)
+			http.SetCookie(w, &http.Cookie{Name: languageCookie, Value: prefix, Path: "/"})
+			break
+		}
+
+		if lang != "" {
+			w.Header().Set("Content-Language", lang)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
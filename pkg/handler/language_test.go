@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLanguagePrefixes(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"about.html":    "about",
+		"about.fr.html": "about fr",
+	})
+	config := Configuration{
+		Public:           public,
+		LanguagePrefixes: []string{"en", "fr"},
+		DefaultLanguage:  "en",
+	}
+
+	router := newTestRouter(config)
+	w := doRequest(router, "GET", "/fr/about", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "about", w.Body.String())
+	assert.Equal(t, "fr", w.Header().Get("Content-Language"))
+	assert.Equal(t, "lang=fr; Path=/", w.Header().Get("Set-Cookie"))
+
+	w = doRequest(router, "GET", "/about", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "about", w.Body.String())
+	assert.Equal(t, "en", w.Header().Get("Content-Language"))
+	assert.Empty(t, w.Header().Get("Set-Cookie"))
+
+	w = doRequest(router, "GET", "/de/about", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	config.LanguageNegotiation = true
+	router = newTestRouter(config)
+	w = doRequest(router, "GET", "/fr/about", map[string]string{"Accept-Language": "en"})
+	assert.Equal(t, "about fr", w.Body.String())
+}
+
+func TestLanguagePrefixesKeepRequest(t *testing.T) {
+	state, err := NewHandler(Configuration{LanguagePrefixes: []string{"fr"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seen *http.Request
+	handler := state.languagePrefixMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r
+	}))
+
+	r := httptest.NewRequest("GET", "/fr/about", nil)
+	r.Header.Set("Accept-Language", "en")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	assert.Equal(t, "/about", seen.URL.Path)
+	assert.Equal(t, "fr", seen.Header.Get("Accept-Language"))
+	assert.Equal(t, "/fr/about", r.URL.Path)
+	assert.Equal(t, "en", r.Header.Get("Accept-Language"))
+}
@@ -1,13 +1,21 @@
 package handler
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
 	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
 )
 
+// ConfigFileNames are the configuration files looked for in the current
+// directory when none is given, the first one found is used
+var ConfigFileNames = []string{"swerver.json", "swerver.yaml", "swerver.yml"}
+
 // Configuration file format as defined by the serve utility
 type serveConfiguration = struct {
 	Public string `json:"public"`
@@ -16,46 +24,218 @@ type serveConfiguration = struct {
 	Rewrites  []struct {
 		Source      string `json:"source" validate:"min=1"`
 		Destination string `json:"destination" validate:"min=1"`
+		MatchQuery  bool   `json:"matchQuery"`
 	} `json:"rewrites"`
 	Redirects []struct {
 		Source      string `json:"source" validate:"min=1"`
 		Destination string `json:"destination" validate:"min=1"`
 		Type        int    `json:"type"`
+		MatchQuery  bool   `json:"matchQuery"`
 	} `json:"redirects"`
 	Proxy []struct {
-		Source      string `json:"source" validate:"min=1"`
-		Destination string `json:"destination" validate:"min=1"`
+		Source        string `json:"source" validate:"min=1"`
+		Destination   string `json:"destination" validate:"min=1"`
+		TrailingSlash *bool  `json:"trailingSlash"`
 	} `json:"proxy"`
 	Headers []struct {
 		Source  string `json:"source" validate:"min=1,max=100"`
 		Headers []struct {
-			Key   string `json:"key" validate:"min=1,max=128,"`
-			Value string `json:"value" validate:"min=1,max=2048,"`
-		}
+			Key   string `json:"key" validate:"min=1,max=128"`
+			Value string `json:"value" validate:"max=2048"`
+		} `json:"headers"`
 	} `json:"headers"`
 	DirectoryListing json.RawMessage `json:"directoryListing"`
 	Unlisted         *[]string       `json:"unlisted"`
 	TrailingSlash    *bool           `json:"trailingSlash"`
 	RenderSingle     bool            `json:"renderSingle"`
 	Symlinks         bool            `json:"symlinks"`
+	CacheSize        int64           `json:"cacheSize"`
+	Prewarm          []string        `json:"prewarm"`
+	BlockHeaders     []struct {
+		Key       string `json:"key" validate:"min=1"`
+		Pattern   string `json:"pattern"`
+		MaxLength int    `json:"maxLength"`
+	} `json:"blockHeaders"`
+	BlockUserAgents []string          `json:"blockUserAgents"`
+	BlockStatus     int               `json:"blockStatus"`
+	DirectoryTheme  string            `json:"directoryTheme"`
+	DirectoryThemes map[string]string `json:"directoryThemes"`
+
+	LanguageNegotiation bool   `json:"languageNegotiation"`
+	Trace               bool   `json:"trace"`
+	TraceSecret         string `json:"traceSecret"`
+	MaxWalkDepth        int    `json:"maxWalkDepth"`
+	DirectoryPrecedence string `json:"directoryPrecedence"`
+	Preload             map[string][]struct {
+		Href string `json:"href" validate:"min=1"`
+		As   string `json:"as"`
+	} `json:"preload"`
+	DefaultContentType         string            `json:"defaultContentType"`
+	StrictCase                 bool              `json:"strictCase"`
+	LanguagePrefixes           []string          `json:"languagePrefixes"`
+	DefaultLanguage            string            `json:"defaultLanguage"`
+	NoKeepAlive                bool              `json:"noKeepAlive"`
+	ContentDisposition         bool              `json:"contentDisposition"`
+	SafeMode                   bool              `json:"safeMode"`
+	AllowUploads               bool              `json:"allowUploads"`
+	UploadPaths                []string          `json:"uploadPaths"`
+	MaxUploadSize              int64             `json:"maxUploadSize"`
+	UploadToken                string            `json:"uploadToken"`
+	AllowBatch                 bool              `json:"allowBatch"`
+	RemoveHeaders              []string          `json:"removeHeaders"`
+	ErrorCacheControl          map[string]string `json:"errorCacheControl"`
+	ProxyDialTimeout           string            `json:"proxyDialTimeout"`
+	ProxyTLSTimeout            string            `json:"proxyTLSTimeout"`
+	ProxyResponseHeaderTimeout string            `json:"proxyResponseHeaderTimeout"`
+	ProxyExpectContinueTimeout string            `json:"proxyExpectContinueTimeout"`
+	DirectoryPageSize          int               `json:"directoryPageSize"`
+	AccessLogFile              string            `json:"accessLogFile"`
+	ErrorLogFile               string            `json:"errorLogFile"`
+	CompressionCacheDir        string            `json:"compressionCacheDir"`
+	NoCompressPaths            []string          `json:"noCompressPaths"`
+	BrotliDictionary           string            `json:"brotliDictionary"`
+	HitCounter                 bool              `json:"hitCounter"`
+	HitCounterFile             string            `json:"hitCounterFile"`
+	RetryAfter                 int               `json:"retryAfter"`
+	MaxRanges                  int               `json:"maxRanges"`
+	DirectoryIndexRules        map[string]string `json:"directoryIndexRules"`
+	ETagAlgorithm              string            `json:"etagAlgorithm"`
+	DefaultHost                string            `json:"defaultHost"`
+	NoCachePaths               []string          `json:"noCachePaths"`
+	IPAccess                   struct {
+		Allow          []string `json:"allow"`
+		Deny           []string `json:"deny"`
+		Paths          []string `json:"paths"`
+		TrustedProxies []string `json:"trustedProxies"`
+	} `json:"ipAccess"`
+	ProxyCompression      string `json:"proxyCompression"`
+	MaxNameLength         int    `json:"maxNameLength"`
+	DirectoryHeadStatus   int    `json:"directoryHeadStatus"`
+	MaxConcurrentListings int    `json:"maxConcurrentListings"`
+	ListingWait           string `json:"listingWait"`
+	IgnoreEmptyRanges     bool   `json:"ignoreEmptyRanges"`
+	ShutdownTimeout       string `json:"shutdownTimeout"`
+	BasePath              string `json:"basePath"`
+	Methods               []struct {
+		Source  string   `json:"source" validate:"min=1,max=100"`
+		Methods []string `json:"methods" validate:"min=1"`
+	} `json:"methods"`
+	DecompressGzip   bool   `json:"decompressGzip"`
+	Precedence       string `json:"precedence"`
+	SuggestNotFound  bool   `json:"suggestNotFound"`
+	DropQuery        bool   `json:"dropQuery"`
+	DirectoryFilter  bool   `json:"directoryFilter"`
+	MaxRequestsPerIP int    `json:"maxRequestsPerIP"`
+	KeepHostDot      bool   `json:"keepHostDot"`
+	CacheControl     []struct {
+		Source string `json:"source" validate:"min=1,max=100"`
+		Value  string `json:"value" validate:"min=1,max=2048"`
+	} `json:"cacheControl"`
+	ProxyMaxResponseBytes int64               `json:"proxyMaxResponseBytes"`
+	InfoEndpoint          bool                `json:"infoEndpoint"`
+	ExtensionCache        map[string]int      `json:"extensionCache"`
+	ArtificialDelay       string              `json:"artificialDelay"`
+	DelayQuery            bool                `json:"delayQuery"`
+	Backslashes           string              `json:"backslashes"`
+	DirectoryFallback     string              `json:"directoryFallback"`
+	NoRangePaths          []string            `json:"noRangePaths"`
+	Thumbnails            bool                `json:"thumbnails"`
+	ThumbnailSize         int                 `json:"thumbnailSize"`
+	TraceConnectStatus    int                 `json:"traceConnectStatus"`
+	Bundles               map[string][]string `json:"bundles"`
+	Health                struct {
+		Path      string `json:"path"`
+		ReadyPath string `json:"readyPath"`
+		Disabled  bool   `json:"disabled"`
+		Override  bool   `json:"override"`
+	} `json:"health"`
 
 	Ssl struct {
-		KeyFile  string `json:"keyFile"`
-		CertFile string `json:"certFile"`
+		KeyFile           string `json:"keyFile"`
+		CertFile          string `json:"certFile"`
+		ClientCaFile      string `json:"clientCaFile"`
+		RequireClientCert bool   `json:"requireClientCert"`
+		AutoCert          struct {
+			Hosts         []string `json:"hosts"`
+			CacheDir      string   `json:"cacheDir"`
+			Email         string   `json:"email"`
+			ChallengeAddr string   `json:"challengeAddr"`
+		} `json:"autoCert"`
+		RedirectAddr string `json:"redirectAddr"`
+		RedirectPort string `json:"redirectPort"`
 	} `json:"ssl"`
 }
 
+// FindConfigurationFile returns the first of ConfigFileNames that exists,
+// or the first name when there is none
+func FindConfigurationFile() string {
+	for _, name := range ConfigFileNames {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+
+	return ConfigFileNames[0]
+}
+
+// LoadServeConfiguration reads the configuration file at filepath, a path
+// of "-" reads the configuration from stdin. A .yaml or .yml file is read
+// as YAML, anything else as JSON. A missing file results in the default
+// configuration.
 func LoadServeConfiguration(filepath string) (Configuration, error) {
-	config := Configuration{}
+	if filepath == "-" {
+		return ReadServeConfiguration(os.Stdin)
+	}
+
+	file, err := os.Open(filepath)
+	if err != nil {
+		return buildConfiguration(serveConfiguration{})
+	}
+	defer file.Close()
+
+	switch strings.ToLower(path.Ext(filepath)) {
+	case ".yaml", ".yml":
+		return ReadServeConfigurationYAML(file)
+	}
+
+	return ReadServeConfiguration(file)
+}
+
+// ReadServeConfigurationYAML decodes a YAML configuration from reader. The
+// document is translated to JSON first, so the keys and the values accepted
+// are exactly those of a JSON configuration.
+func ReadServeConfigurationYAML(reader io.Reader) (Configuration, error) {
+	var document interface{}
+
+	if err := yaml.NewDecoder(reader).Decode(&document); err != nil && err != io.EOF {
+		return Configuration{}, err
+	}
+	if document == nil {
+		return buildConfiguration(serveConfiguration{})
+	}
+
+	data, err := json.Marshal(document)
+	if err != nil {
+		return Configuration{}, fmt.Errorf("unsupported YAML configuration: %w", err)
+	}
+
+	return ReadServeConfiguration(bytes.NewReader(data))
+}
+
+// ReadServeConfiguration decodes a JSON configuration from reader
+func ReadServeConfiguration(reader io.Reader) (Configuration, error) {
 	data := serveConfiguration{}
 
-	file, err := ioutil.ReadFile(filepath)
-	if err == nil {
-		if err = json.Unmarshal([]byte(file), &data); err != nil {
-			return config, err
-		}
+	if err := json.NewDecoder(reader).Decode(&data); err != nil && err != io.EOF {
+		return Configuration{}, err
 	}
 
+	return buildConfiguration(data)
+}
+
+func buildConfiguration(data serveConfiguration) (Configuration, error) {
+	config := Configuration{}
+
 	if cwd, err := os.Getwd(); err != nil {
 		panic(err)
 	} else {
@@ -66,20 +246,20 @@ func LoadServeConfiguration(filepath string) (Configuration, error) {
 		}
 	}
 
-	// if data.CleanUrls != nil {
-	// 	var boolValue bool
-	// 	var strValue []string
+	if data.CleanUrls != nil {
+		var boolValue bool
+		var strValue []string
 
-	// 	if err := json.Unmarshal(data.CleanUrls, &boolValue); err == nil {
-	// 		config.NoCleanUrls = !boolValue
-	// 	} else if err := json.Unmarshal(data.CleanUrls, &strValue); err == nil {
-	// 		config.CleanUrls = strValue
-	// 	}
-	// }
+		if err := json.Unmarshal(data.CleanUrls, &boolValue); err == nil {
+			config.NoCleanUrls = !boolValue
+		} else if err := json.Unmarshal(data.CleanUrls, &strValue); err == nil {
+			config.CleanUrls = strValue
+		}
+	}
 
-	// config.Rewrites = data.Rewrites
-	// config.Redirects = data.Redirects
-	// config.Headers = data.Headers
+	config.Rewrites = data.Rewrites
+	config.Redirects = data.Redirects
+	config.Headers = data.Headers
 	config.Proxy = data.Proxy
 
 	if data.DirectoryListing != nil {
@@ -101,10 +281,11 @@ func LoadServeConfiguration(filepath string) (Configuration, error) {
 		config.Unlisted = append(config.Unlisted, ".DS_Store", ".git")
 	}
 
-	// config.TrailingSlash = true
-	// if data.TrailingSlash != nil {
-	// 	config.TrailingSlash = *data.TrailingSlash
-	// }
+	// Paths are left alone unless trailingSlash is given either way
+	if data.TrailingSlash != nil {
+		config.TrailingSlash = *data.TrailingSlash
+		config.NoTrailingSlash = !*data.TrailingSlash
+	}
 	config.RenderSingle = data.RenderSingle
 	// if config.RenderSingle {
 	// 	config.Rewrites = append(config.Rewrites, ConfigRewrite{
@@ -112,7 +293,83 @@ func LoadServeConfiguration(filepath string) (Configuration, error) {
 	// 		Destination: "/index.html",
 	// 	})
 	// }
-	// config.Symlinks = data.Symlinks
+	config.Symlinks = data.Symlinks
+	config.CacheSize = data.CacheSize
+	config.Prewarm = data.Prewarm
+	config.BlockHeaders = data.BlockHeaders
+	config.BlockUserAgents = data.BlockUserAgents
+	config.BlockStatus = data.BlockStatus
+	config.DirectoryTheme = data.DirectoryTheme
+	config.DirectoryThemes = data.DirectoryThemes
+	config.LanguageNegotiation = data.LanguageNegotiation
+	config.Trace = data.Trace
+	config.TraceSecret = data.TraceSecret
+	config.MaxWalkDepth = data.MaxWalkDepth
+	config.DirectoryPrecedence = data.DirectoryPrecedence
+	config.Preload = data.Preload
+	config.DefaultContentType = data.DefaultContentType
+	config.StrictCase = data.StrictCase
+	config.LanguagePrefixes = data.LanguagePrefixes
+	config.DefaultLanguage = data.DefaultLanguage
+	config.NoKeepAlive = data.NoKeepAlive
+	config.ContentDisposition = data.ContentDisposition
+	config.SafeMode = data.SafeMode
+	config.AllowUploads = data.AllowUploads
+	config.UploadPaths = data.UploadPaths
+	config.MaxUploadSize = data.MaxUploadSize
+	config.UploadToken = data.UploadToken
+	config.AllowBatch = data.AllowBatch
+	config.RemoveHeaders = data.RemoveHeaders
+	config.ErrorCacheControl = data.ErrorCacheControl
+	config.ProxyDialTimeout = data.ProxyDialTimeout
+	config.ProxyTLSTimeout = data.ProxyTLSTimeout
+	config.ProxyResponseHeaderTimeout = data.ProxyResponseHeaderTimeout
+	config.ProxyExpectContinueTimeout = data.ProxyExpectContinueTimeout
+	config.DirectoryPageSize = data.DirectoryPageSize
+	config.AccessLogFile = data.AccessLogFile
+	config.ErrorLogFile = data.ErrorLogFile
+	config.CompressionCacheDir = data.CompressionCacheDir
+	config.NoCompressPaths = data.NoCompressPaths
+	config.BrotliDictionary = data.BrotliDictionary
+	config.HitCounter = data.HitCounter
+	config.HitCounterFile = data.HitCounterFile
+	config.RetryAfter = data.RetryAfter
+	config.MaxRanges = data.MaxRanges
+	config.DirectoryIndexRules = data.DirectoryIndexRules
+	config.ETagAlgorithm = data.ETagAlgorithm
+	config.DefaultHost = data.DefaultHost
+	config.NoCachePaths = data.NoCachePaths
+	config.IPAccess = data.IPAccess
+	config.ProxyCompression = data.ProxyCompression
+	config.MaxNameLength = data.MaxNameLength
+	config.DirectoryHeadStatus = data.DirectoryHeadStatus
+	config.MaxConcurrentListings = data.MaxConcurrentListings
+	config.ListingWait = data.ListingWait
+	config.IgnoreEmptyRanges = data.IgnoreEmptyRanges
+	config.ShutdownTimeout = data.ShutdownTimeout
+	config.BasePath = data.BasePath
+	config.Methods = data.Methods
+	config.DecompressGzip = data.DecompressGzip
+	config.Precedence = data.Precedence
+	config.SuggestNotFound = data.SuggestNotFound
+	config.DropQuery = data.DropQuery
+	config.DirectoryFilter = data.DirectoryFilter
+	config.MaxRequestsPerIP = data.MaxRequestsPerIP
+	config.KeepHostDot = data.KeepHostDot
+	config.CacheControl = data.CacheControl
+	config.ProxyMaxResponseBytes = data.ProxyMaxResponseBytes
+	config.InfoEndpoint = data.InfoEndpoint
+	config.ExtensionCache = data.ExtensionCache
+	config.ArtificialDelay = data.ArtificialDelay
+	config.DelayQuery = data.DelayQuery
+	config.Backslashes = data.Backslashes
+	config.DirectoryFallback = data.DirectoryFallback
+	config.NoRangePaths = data.NoRangePaths
+	config.Thumbnails = data.Thumbnails
+	config.ThumbnailSize = data.ThumbnailSize
+	config.TraceConnectStatus = data.TraceConnectStatus
+	config.Bundles = data.Bundles
+	config.Health = data.Health
 	config.Ssl = data.Ssl
 
 	b, _ := json.Marshal(config)
@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadServeConfiguration(t *testing.T) {
+	config, err := ReadServeConfiguration(strings.NewReader(`{
+		"directoryListing": false,
+		"unlisted": ["secret"],
+		"renderSingle": true,
+		"proxy": [{"source": "/api/*", "destination": "http://localhost:8080/"}]
+	}`))
+
+	assert.Nil(t, err)
+	assert.True(t, config.NoDirectoryListing)
+	assert.Equal(t, []string{"secret"}, config.Unlisted)
+	assert.True(t, config.RenderSingle)
+	assert.Equal(t, 1, len(config.Proxy))
+	assert.Equal(t, "/api/*", config.Proxy[0].Source)
+
+	config, err = ReadServeConfiguration(strings.NewReader(`{"directoryListing": ["/assets/**"]}`))
+	assert.Nil(t, err)
+	assert.False(t, config.NoDirectoryListing)
+	assert.Equal(t, []string{"/assets/**"}, config.DirectoryListing)
+	assert.Equal(t, []string{".DS_Store", ".git"}, config.Unlisted)
+}
+
+func TestReadServeConfigurationEmpty(t *testing.T) {
+	config, err := ReadServeConfiguration(strings.NewReader(""))
+
+	assert.Nil(t, err)
+	assert.NotEmpty(t, config.Public)
+	assert.False(t, config.NoDirectoryListing)
+}
+
+func TestReadServeConfigurationInvalid(t *testing.T) {
+	_, err := ReadServeConfiguration(strings.NewReader(`{"directoryListing": `))
+
+	assert.NotNil(t, err)
+}
+
+func TestReadServeConfigurationRewrites(t *testing.T) {
+	config, err := ReadServeConfiguration(strings.NewReader(`{
+		"rewrites": [{"source": "/blog/:slug", "destination": "/posts/:slug.html"}]
+	}`))
+
+	assert.Nil(t, err)
+	assert.Equal(t, []ConfigRewrite{{Source: "/blog/:slug", Destination: "/posts/:slug.html"}}, config.Rewrites)
+
+	rewritten, err := applyRewrites("/blog/hello", nil, config.Rewrites)
+	assert.Nil(t, err)
+	assert.Equal(t, "/posts/hello.html", *rewritten)
+
+	config.Public = writeFiles(t, map[string]string{
+		"posts/hello.html": "hello post",
+	})
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w := doRequest(handler, "GET", "/blog/hello", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "hello post", w.Body.String())
+
+		w = doRequest(handler, "GET", "/blog/missing", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	}
+}
+
+func TestSinglePageRewrite(t *testing.T) {
+	// The rewrite --single adds to the configuration
+	config := Configuration{
+		Public: writeFiles(t, map[string]string{
+			"index.html": "app",
+			"app.js":     "script",
+		}),
+		Rewrites: []ConfigRewrite{{Source: "**", Destination: "/index.html"}},
+	}
+
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w := doRequest(handler, "GET", "/users/42", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "app", w.Body.String())
+
+		w = doRequest(handler, "GET", "/app.js", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "script", w.Body.String())
+	}
+}
+
+func TestReadServeConfigurationCleanUrls(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"post.html":      "post",
+		"blog/post.html": "blog post",
+	})
+
+	config, err := ReadServeConfiguration(strings.NewReader(`{"cleanUrls": false}`))
+	assert.Nil(t, err)
+	assert.True(t, config.NoCleanUrls)
+	config.Public = public
+	w := doRequest(newTestRouter(config), "GET", "/post", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	config, err = ReadServeConfiguration(strings.NewReader(`{"cleanUrls": true}`))
+	assert.Nil(t, err)
+	assert.False(t, config.NoCleanUrls)
+	assert.Empty(t, config.CleanUrls)
+	config.Public = public
+	w = doRequest(newTestRouter(config), "GET", "/post", nil)
+	assert.Equal(t, "post", w.Body.String())
+
+	config, err = ReadServeConfiguration(strings.NewReader(`{"cleanUrls": ["/blog/**"]}`))
+	assert.Nil(t, err)
+	assert.False(t, config.NoCleanUrls)
+	assert.Equal(t, []string{"/blog/**"}, config.CleanUrls)
+	config.Public = public
+	router := newTestRouter(config)
+	w = doRequest(router, "GET", "/blog/post", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "blog post", w.Body.String())
+	w = doRequest(router, "GET", "/post", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestReadServeConfigurationTrailingSlash(t *testing.T) {
+	config, err := ReadServeConfiguration(strings.NewReader(`{"trailingSlash": true}`))
+	assert.Nil(t, err)
+	assert.True(t, config.TrailingSlash)
+	assert.False(t, config.NoTrailingSlash)
+
+	public := writeFiles(t, map[string]string{"docs/index.html": "docs"})
+	config.Public = public
+	w := doRequest(newTestRouter(config), "GET", "/docs", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "/docs/", w.Header().Get("Location"))
+
+	config, err = ReadServeConfiguration(strings.NewReader(`{"trailingSlash": false}`))
+	assert.Nil(t, err)
+	assert.False(t, config.TrailingSlash)
+	assert.True(t, config.NoTrailingSlash)
+	config.Public = public
+	w = doRequest(newTestRouter(config), "GET", "/docs/", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "/docs", w.Header().Get("Location"))
+	w = doRequest(newTestRouter(config), "GET", "/docs", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "docs", w.Body.String())
+
+	config, err = ReadServeConfiguration(strings.NewReader(`{}`))
+	assert.Nil(t, err)
+	assert.False(t, config.TrailingSlash)
+	assert.False(t, config.NoTrailingSlash)
+}
+
+func TestReadServeConfigurationYAML(t *testing.T) {
+	config, err := ReadServeConfigurationYAML(strings.NewReader(`
+directoryListing: false
+cleanUrls:
+  - /blog/**
+trailingSlash: true
+proxy:
+  - source: /api/*
+    destination: http://localhost:8080/
+headers:
+  - source: "**/*.js"
+    headers:
+      - key: Cache-Control
+        value: max-age=7200
+extensionCache:
+  .css: 3600
+`))
+	assert.Nil(t, err)
+	assert.True(t, config.NoDirectoryListing)
+	assert.Equal(t, []string{"/blog/**"}, config.CleanUrls)
+	assert.True(t, config.TrailingSlash)
+	assert.Equal(t, "/api/*", config.Proxy[0].Source)
+	assert.Equal(t, "max-age=7200", config.Headers[0].Headers[0].Value)
+	assert.Equal(t, map[string]int{".css": 3600}, config.ExtensionCache)
+
+	config, err = ReadServeConfigurationYAML(strings.NewReader(""))
+	assert.Nil(t, err)
+	assert.NotEmpty(t, config.Public)
+
+	_, err = ReadServeConfigurationYAML(strings.NewReader("directoryListing: [unclosed"))
+	assert.NotNil(t, err)
+}
+
+func TestLoadServeConfigurationFormats(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"swerver.yml":  "renderSingle: true\n",
+		"swerver.yaml": "symlinks: true\n",
+		"other.json":   `{"renderSingle": true}`,
+	})
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+
+	config, err := LoadServeConfiguration("swerver.yml")
+	assert.Nil(t, err)
+	assert.True(t, config.RenderSingle)
+
+	config, err = LoadServeConfiguration("other.json")
+	assert.Nil(t, err)
+	assert.True(t, config.RenderSingle)
+
+	// swerver.json comes first, then swerver.yaml and swerver.yml
+	assert.Equal(t, "swerver.yaml", FindConfigurationFile())
+	assert.Nil(t, os.WriteFile("swerver.json", []byte("{}"), 0o644))
+	assert.Equal(t, "swerver.json", FindConfigurationFile())
+	assert.Nil(t, os.Remove("swerver.json"))
+	assert.Nil(t, os.Remove("swerver.yaml"))
+	assert.Equal(t, "swerver.yml", FindConfigurationFile())
+	assert.Nil(t, os.Remove("swerver.yml"))
+	assert.Equal(t, "swerver.json", FindConfigurationFile())
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// LogFile is a log file opened for appending, it can be reopened after an
+// external tool like logrotate moved it away.
+type LogFile struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenLogFile opens path for appending, creating it when needed
+func OpenLogFile(path string) (*LogFile, error) {
+	logFile := &LogFile{path: path}
+	if err := logFile.Reopen(); err != nil {
+		return nil, err
+	}
+
+	return logFile, nil
+}
+
+// Reopen switches to a freshly opened file at the configured path, the
+// current file stays in use when that fails.
+func (l *LogFile) Reopen() error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	previous := l.file
+	l.file = file
+	l.mu.Unlock()
+
+	if previous != nil {
+		previous.Close()
+	}
+
+	return nil
+}
+
+func (l *LogFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file.Write(p)
+}
+
+func (l *LogFile) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file.Close()
+}
+
+// AccessLogger is the request logging middleware writing to out
+func AccessLogger(out io.Writer) func(http.Handler) http.Handler {
+	return middleware.RequestLogger(&middleware.DefaultLogFormatter{
+		Logger:  log.New(out, "", log.LstdFlags),
+		NoColor: true,
+	})
+}
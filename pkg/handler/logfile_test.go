@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLogFile(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html": "index",
+	})
+	name := filepath.Join(t.TempDir(), "access.log")
+
+	logFile, err := OpenLogFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.Close()
+
+	router := chi.NewRouter()
+	router.Use(AccessLogger(logFile))
+	newTestHandler(Configuration{Public: public}).AttachRoutes(router)
+
+	doRequest(router, "GET", "/", nil)
+	data, err := os.ReadFile(name)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"GET http://example.com/ HTTP/1.1"`)
+	assert.Contains(t, string(data), " 200 ")
+
+	// Rotate the way logrotate does, by moving the file away and reopening
+	rotated := name + ".1"
+	if err := os.Rename(name, rotated); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, logFile.Reopen())
+
+	doRequest(router, "GET", "/missing", nil)
+	data, err = os.ReadFile(name)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "/missing")
+	assert.NotContains(t, string(data), "http://example.com/ HTTP")
+
+	data, err = os.ReadFile(rotated)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "/missing")
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/koblas/swerver/pkg/trace"
+)
+
+// Longest chain of redirects or rewrites applied for a single request
+const maxRedirectChain = 10
+
+// redirectLoopError reports a chain of redirects or rewrites that leads
+// back to an earlier path or grows too long
+type redirectLoopError struct {
+	chain []string
+}
+
+func (e redirectLoopError) Error() string {
+	return fmt.Sprintf("redirect loop: %s", strings.Join(e.chain, " -> "))
+}
+
+// extendChain adds next to the chain, failing when it was seen before or
+// the chain becomes too long
+func extendChain(chain []string, next string) ([]string, error) {
+	chain = append(chain, next)
+
+	for _, prior := range chain[:len(chain)-1] {
+		if prior == next {
+			return chain, redirectLoopError{chain}
+		}
+	}
+	if len(chain) > maxRedirectChain {
+		return chain, redirectLoopError{chain}
+	}
+
+	return chain, nil
+}
+
+// checkRedirectChain follows the redirects the client would be sent
+// through after target, reporting a loop before the first redirect is
+// answered. Redirects leaving the server aren't followed.
+func (state HandlerState) checkRedirectChain(source, target string) error {
+	chain := []string{source}
+
+	for {
+		u, err := url.Parse(target)
+		if err != nil || u.Host != "" || !strings.HasPrefix(u.Path, "/") {
+			return nil
+		}
+		if chain, err = extendChain(chain, target); err != nil {
+			return err
+		}
+
+		cleanUrl := applicable(u.Path, state.CleanUrls, state.NoCleanUrls)
+		next, _, _ := state.shouldRedirect(u.Path, u.Query(), cleanUrl)
+		if next == nil {
+			return nil
+		}
+		target = *next
+	}
+}
+
+// sendLoopError logs the chain and answers with 508 Loop Detected
+func (state HandlerState) sendLoopError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("Request for %s: %v", r.URL.Path, err)
+	trace.Add(r, "%v", err)
+	state.sendError(w, r, "/", http.StatusLoopDetected)
+}
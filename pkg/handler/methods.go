@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/koblas/swerver/pkg/trace"
+)
+
+type methodRule struct {
+	source  string
+	methods map[string]bool
+	allow   string
+}
+
+// compileMethodRules reads the methods configuration, method names are
+// case insensitive and allowing GET also allows HEAD.
+func compileMethodRules(config Configuration) ([]methodRule, error) {
+	rules := []methodRule{}
+
+	for _, item := range config.Methods {
+		if len(item.Methods) == 0 {
+			return nil, fmt.Errorf("no methods allowed for %s", item.Source)
+		}
+
+		rule := methodRule{source: item.Source, methods: map[string]bool{}}
+		names := []string{}
+		add := func(method string) {
+			if !rule.methods[method] {
+				rule.methods[method] = true
+				names = append(names, method)
+			}
+		}
+		for _, method := range item.Methods {
+			method = strings.ToUpper(strings.TrimSpace(method))
+			if method == "" || strings.ContainsAny(method, " \t,") {
+				return nil, fmt.Errorf("invalid method %q for %s", method, item.Source)
+			}
+			add(method)
+			if method == http.MethodGet {
+				add(http.MethodHead)
+			}
+		}
+		rule.allow = strings.Join(names, ", ")
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// methodsMiddleware refuses the methods not allowed on a path with a 405,
+// listing the allowed ones in the Allow header
+func (state HandlerState) methodsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, rule := range state.methodRules {
+			if ok, _, _ := sourceMatches(rule.source, r.URL.Path, false); !ok {
+				continue
+			}
+			if !rule.methods[r.Method] {
+				trace.Add(r, "method %s not allowed by %s", r.Method, rule.source)
+				w.Header().Set("Allow", rule.allow)
+				state.sendError(w, r, "/", http.StatusMethodNotAllowed)
+				return
+			}
+			break
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkTraceConnect refuses TRACE, which lets a script read headers it
+// shouldn't (cross-site tracing), and CONNECT with the traceConnectStatus.
+// It reports false when the request was refused.
+func (state HandlerState) checkTraceConnect(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodTrace && r.Method != http.MethodConnect {
+		return true
+	}
+
+	status := state.TraceConnectStatus
+	if status == 0 {
+		status = http.StatusMethodNotAllowed
+	}
+	trace.Add(r, "method %s refused", r.Method)
+	if status == http.StatusMethodNotAllowed {
+		w.Header().Set("Allow", strings.Join(state.allowedMethods(), ", "))
+	}
+	state.sendError(w, r, "/", status)
+
+	return false
+}
+
+// traceConnectMiddleware refuses TRACE and CONNECT before any route, a
+// proxy would otherwise forward them
+func (state HandlerState) traceConnectMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if state.checkTraceConnect(w, r) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
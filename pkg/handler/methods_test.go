@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMethods(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"static/app.js":   "js",
+		"uploads/old.txt": "old",
+	})
+
+	router := newTestRouter(Configuration{
+		Public:       public,
+		AllowUploads: true,
+		Methods: []ConfigMethods{
+			{Source: "/static/**", Methods: []string{"GET"}},
+			{Source: "/uploads/**", Methods: []string{"get", "put"}},
+		},
+	})
+
+	w := doRequest(router, "GET", "/static/app.js", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(router, "HEAD", "/static/app.js", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doRequest(router, "PUT", "/static/app.js", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, HEAD", w.Header().Get("Allow"))
+	assert.Contains(t, w.Body.String(), "Method Not Allowed")
+
+	w = doRequest(router, "DELETE", "/uploads/old.txt", map[string]string{"Accept": "application/json"})
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, HEAD, PUT", w.Header().Get("Allow"))
+	assert.Contains(t, w.Body.String(), `"code":"method_not_allowed"`)
+
+	w = doRequest(router, "GET", "/uploads/old.txt", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Paths without a rule keep the global behaviour
+	w = doRequest(router, "PUT", "/other.txt", nil)
+	assert.NotEqual(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestTraceConnect(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html": "index",
+	})
+	config := Configuration{Public: public}
+
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		for _, method := range []string{"TRACE", "CONNECT"} {
+			w := doRequest(handler, method, "/index.html", nil)
+			assert.Equal(t, http.StatusMethodNotAllowed, w.Code, method)
+			assert.Equal(t, "GET, HEAD, OPTIONS", w.Header().Get("Allow"), method)
+			assert.NotEqual(t, "index", w.Body.String(), method)
+		}
+
+		w := doRequest(handler, "TRACE", "/missing", map[string]string{"Accept": "application/json"})
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"method_not_allowed"`)
+	}
+
+	// Also refused ahead of a catch-all proxy, which would forward them
+	config.TraceConnectStatus = http.StatusNotImplemented
+	config.Proxy = []ConfigProxy{{Source: "/**", Destination: "http://127.0.0.1:1/*"}}
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		for _, method := range []string{"TRACE", "CONNECT"} {
+			w := doRequest(handler, method, "/index.html", nil)
+			assert.Equal(t, http.StatusNotImplemented, w.Code, method)
+			assert.Empty(t, w.Header().Get("Allow"), method)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+)
+
+// allowedMethods lists the methods the server answers with the current
+// configuration
+func (state HandlerState) allowedMethods() []string {
+	methods := []string{http.MethodGet, http.MethodHead, http.MethodOptions}
+
+	if len(state.Proxy) != 0 {
+		// Proxied requests are forwarded whatever their method
+		methods = append(methods, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete)
+	} else if state.AllowUploads {
+		methods = append(methods, http.MethodPut, http.MethodDelete)
+		if state.AllowBatch {
+			methods = append(methods, http.MethodPost)
+		}
+	}
+
+	return methods
+}
+
+// optionsMiddleware answers the server wide "OPTIONS *" request with the
+// supported methods, without looking at the filesystem.
+func (state HandlerState) optionsMiddleware(next http.Handler) http.Handler {
+	allow := strings.Join(state.allowedMethods(), ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodOptions || r.RequestURI != "*" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Allow", allow)
+		w.Header().Set("Content-Length", "0")
+		w.WriteHeader(http.StatusOK)
+	})
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// listingPage describes the slice of a paginated directory listing
+type listingPage struct {
+	Total   int  `json:"total"`
+	Page    int  `json:"page"`
+	Limit   int  `json:"limit"`
+	HasMore bool `json:"hasMore"`
+}
+
+// listingPagination reads ?page= (starting at 1) and ?limit= from the query,
+// falling back to directoryPageSize. Listings aren't paginated when neither
+// gives a limit.
+func (state HandlerState) listingPagination(query url.Values) *listingPage {
+	limit := state.DirectoryPageSize
+	if value, err := strconv.Atoi(query.Get("limit")); err == nil && value > 0 {
+		limit = value
+	}
+	if limit <= 0 {
+		return nil
+	}
+
+	page := 1
+	if value, err := strconv.Atoi(query.Get("page")); err == nil && value > 0 {
+		page = value
+	}
+
+	return &listingPage{Page: page, Limit: limit}
+}
+
+// apply returns the files on the page, filling in the totals
+func (p *listingPage) apply(files []fileDetails) []fileDetails {
+	p.Total = len(files)
+
+	start := (p.Page - 1) * p.Limit
+	if start > len(files) {
+		start = len(files)
+	}
+	end := start + p.Limit
+	if end > len(files) {
+		end = len(files)
+	}
+	p.HasMore = end < len(files)
+
+	return files[start:end]
+}
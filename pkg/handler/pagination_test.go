@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type jsonListing struct {
+	Files []struct {
+		Base string `json:"name"`
+	}
+	Total   *int  `json:"total"`
+	Page    *int  `json:"page"`
+	Limit   *int  `json:"limit"`
+	HasMore *bool `json:"hasMore"`
+}
+
+func getListing(t *testing.T, handler http.Handler, target string) jsonListing {
+	w := doRequest(handler, "GET", target, map[string]string{"Accept": "application/json"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	listing := jsonListing{}
+	if err := json.Unmarshal(w.Body.Bytes(), &listing); err != nil {
+		t.Fatal(err)
+	}
+
+	return listing
+}
+
+func names(listing jsonListing) []string {
+	result := []string{}
+	for _, file := range listing.Files {
+		result = append(result, file.Base)
+	}
+	return result
+}
+
+func TestListingPagination(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"docs/a.txt": "a",
+		"docs/b.txt": "b",
+		"docs/c.txt": "c",
+		"docs/d.txt": "d",
+		"docs/e.txt": "e",
+	})
+	state := newTestHandler(Configuration{Public: public})
+
+	listing := getListing(t, state, "/docs/")
+	// The parent link heads every page without being counted
+	assert.Equal(t, 6, len(listing.Files))
+	assert.Nil(t, listing.Total)
+	assert.Nil(t, listing.HasMore)
+
+	listing = getListing(t, state, "/docs/?limit=2&page=2")
+	assert.Equal(t, []string{"..", "c.txt", "d.txt"}, names(listing))
+	assert.Equal(t, 5, *listing.Total)
+	assert.Equal(t, 2, *listing.Page)
+	assert.Equal(t, 2, *listing.Limit)
+	assert.True(t, *listing.HasMore)
+
+	listing = getListing(t, state, "/docs/?limit=2&page=3")
+	assert.Equal(t, []string{"..", "e.txt"}, names(listing))
+	assert.False(t, *listing.HasMore)
+
+	listing = getListing(t, state, "/docs/?limit=2&page=9")
+	assert.Equal(t, []string{".."}, names(listing))
+	assert.Equal(t, 5, *listing.Total)
+
+	state = newTestHandler(Configuration{Public: public, DirectoryPageSize: 3})
+	listing = getListing(t, state, "/docs/")
+	assert.Equal(t, []string{"..", "a.txt", "b.txt", "c.txt"}, names(listing))
+	assert.Equal(t, 1, *listing.Page)
+	assert.Equal(t, 3, *listing.Limit)
+	assert.True(t, *listing.HasMore)
+}
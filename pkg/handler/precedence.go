@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/koblas/swerver/pkg/trace"
+)
+
+// Which of two rules matching the same path applies, PrecedenceRedirects
+// answers redirects before requests are proxied, PrecedenceProxy proxies
+// the paths of a proxy source whatever the redirects.
+const (
+	PrecedenceRedirects = "redirects"
+	PrecedenceProxy     = "proxy"
+)
+
+// Wildcards and named segments of a source, replaced to build a path the
+// source matches
+var sourceWildcard = regexp.MustCompile(`\*\*|\*|:[A-Za-z0-9_]+|\{[^}]*\}|\([^)]*\)`)
+
+type ruleSource struct {
+	kind   string
+	source string
+	match  func(string) bool
+}
+
+// samplePath is a request path matched by source
+func samplePath(source string) string {
+	source, _, _ = strings.Cut(source, "?")
+
+	return slasher(sourceWildcard.ReplaceAllString(source, "x"))
+}
+
+// ruleSources lists the sources of the features that can claim the same
+// path, in the order they are applied
+func ruleSources(config Configuration) []ruleSource {
+	sources := []ruleSource{}
+
+	addSegments := func(kind, source string) {
+		path, _, _ := strings.Cut(source, "?")
+		sources = append(sources, ruleSource{kind, source, func(value string) bool {
+			ok, _, _ := sourceMatches(path, value, true)
+			return ok
+		}})
+	}
+
+	proxy := func() {
+		for _, item := range config.Proxy {
+			pattern, err := proxyPattern(item.Source)
+			if err != nil {
+				continue
+			}
+			// chi parameters match a segment, a trailing wildcard the rest
+			glob := sourceWildcard.ReplaceAllString(pattern, "*")
+			if strings.HasSuffix(glob, "/*") {
+				glob += "*"
+			}
+			sources = append(sources, ruleSource{"proxy", item.Source, func(value string) bool {
+				ok, _, _ := sourceMatches(glob, value, false)
+				return ok
+			}})
+		}
+	}
+
+	if config.Precedence == PrecedenceProxy {
+		proxy()
+	}
+	for _, item := range config.Redirects {
+		addSegments("redirect", item.Source)
+	}
+	if config.Precedence != PrecedenceProxy {
+		proxy()
+	}
+	for _, item := range config.Rewrites {
+		addSegments("rewrite", item.Source)
+	}
+	if !config.NoCleanUrls {
+		for _, source := range config.CleanUrls {
+			glob := source
+			sources = append(sources, ruleSource{"cleanUrls", source, func(value string) bool {
+				ok, _, _ := sourceMatches(glob, value, false)
+				return ok
+			}})
+		}
+	}
+
+	return sources
+}
+
+// detectConflicts lists the rules of different features that can match
+// the same path, with the one applied first
+func detectConflicts(config Configuration) []string {
+	conflicts := []string{}
+	sources := ruleSources(config)
+
+	for i, first := range sources {
+		for _, second := range sources[i+1:] {
+			if first.kind == second.kind {
+				continue
+			}
+			if first.match(samplePath(second.source)) || second.match(samplePath(first.source)) {
+				conflicts = append(conflicts, first.kind+" "+first.source+" takes precedence over "+second.kind+" "+second.source)
+			}
+		}
+	}
+
+	return conflicts
+}
+
+// redirectRule is the target and status of the first redirect rule
+// matching decodedPath. The query string is consumed by rules matching it,
+// other rules carry it over.
+func (state HandlerState) redirectRule(decodedPath string, query url.Values) (*string, int, bool) {
+	for _, item := range state.Redirects {
+		target := toTarget(item.Source, item.Destination, decodedPath, ruleQuery(item.MatchQuery, query))
+
+		if target != nil {
+			if item.Type == 0 {
+				return target, http.StatusTemporaryRedirect, !item.MatchQuery
+			}
+			return target, item.Type, !item.MatchQuery
+		}
+	}
+
+	return nil, http.StatusTemporaryRedirect, true
+}
+
+// carryQuery appends the query string of r to a redirect target, unless
+// dropQuery is set or the target has a query of its own
+func (state HandlerState) carryQuery(r *http.Request, target string, keepQuery bool) string {
+	if !keepQuery || state.DropQuery || r.URL.RawQuery == "" || strings.Contains(target, "?") {
+		return target
+	}
+
+	return target + "?" + r.URL.RawQuery
+}
+
+// redirectsMiddleware answers the requests matching a redirect rule
+func (state HandlerState) redirectsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target, status, keepQuery := state.redirectRule(r.URL.Path, r.URL.Query())
+		if target == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := state.checkRedirectChain(r.URL.Path, *target); err != nil {
+			state.sendLoopError(w, r, err)
+			return
+		}
+
+		location := state.carryQuery(r, *target, keepQuery)
+		trace.Add(r, "redirect %s", location)
+		http.Redirect(w, r, location, status)
+	})
+}
+
+// slashRedirectsMiddleware redirects files to their clean URL, with the
+// trailing slash added or removed as configured. Index documents are left
+// to the file server, which redirects them to their directory unless
+// listings come first, and missing pages are answered with a 404.
+func (state HandlerState) slashRedirectsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Path
+		if path.Base(name) == "index.html" || (path.Ext(name) == ".html" && !state.exists(name)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cleanUrl := applicable(name, state.CleanUrls, state.NoCleanUrls)
+		target := state.slashRedirect(name, cleanUrl)
+		if target == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := state.checkRedirectChain(r.URL.Path, *target); err != nil {
+			state.sendLoopError(w, r, err)
+			return
+		}
+
+		location := state.carryQuery(r, *target, true)
+		trace.Add(r, "redirect %s", location)
+		http.Redirect(w, r, location, http.StatusTemporaryRedirect)
+	})
+}
+
+// warnConflicts logs the rules shadowing each other
+func warnConflicts(config Configuration) {
+	for _, conflict := range detectConflicts(config) {
+		log.Printf("Warning: overlapping rules, %s", conflict)
+	}
+}
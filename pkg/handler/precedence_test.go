@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleConflicts(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("proxied " + r.URL.Path))
+	}))
+	defer upstream.Close()
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	config := Configuration{
+		Public:    t.TempDir(),
+		Redirects: []ConfigRedirect{{Source: "/api/old", Destination: "/api/new"}},
+		Proxy:     []ConfigProxy{{Source: "/api/*", Destination: upstream.URL + "/*"}},
+	}
+
+	// Redirects come first by default
+	router := newTestRouter(config)
+	assert.Contains(t, logged.String(), "redirect /api/old takes precedence over proxy /api/*")
+
+	w := doRequest(router, "GET", "/api/old", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "/api/new", w.Header().Get("Location"))
+	w = doRequest(router, "GET", "/api/new", nil)
+	assert.Equal(t, "proxied /new", w.Body.String())
+
+	logged.Reset()
+	config.Precedence = PrecedenceProxy
+	router = newTestRouter(config)
+	assert.Contains(t, logged.String(), "proxy /api/* takes precedence over redirect /api/old")
+
+	w = doRequest(router, "GET", "/api/old", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "proxied /old", w.Body.String())
+
+	// Redirects still apply outside of the proxied paths
+	config.Redirects = append(config.Redirects, ConfigRedirect{Source: "/docs", Destination: "/manual"})
+	w = doRequest(newTestRouter(config), "GET", "/docs", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+
+	assert.Empty(t, detectConflicts(Configuration{
+		Redirects: []ConfigRedirect{{Source: "/old/**", Destination: "/new"}},
+		Proxy:     []ConfigProxy{{Source: "/api/*", Destination: upstream.URL}},
+		Rewrites:  []ConfigRewrite{{Source: "/app/**", Destination: "/index.html"}},
+	}))
+	assert.Equal(t, []string{"rewrite /blog/:slug takes precedence over cleanUrls /blog/**"}, detectConflicts(Configuration{
+		Rewrites:  []ConfigRewrite{{Source: "/blog/:slug", Destination: "/post.html"}},
+		CleanUrls: []string{"/blog/**"},
+	}))
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+)
+
+// preloadHeaders adds a Link preload header for every resource configured
+// for the HTML document name
+func (state HandlerState) preloadHeaders(w http.ResponseWriter, name string) {
+	if len(state.Preload) == 0 || path.Ext(name) != ".html" {
+		return
+	}
+
+	sources := make([]string, 0, len(state.Preload))
+	for source := range state.Preload {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	for _, source := range sources {
+		if ok, _, _ := sourceMatches(source, name, false); !ok {
+			continue
+		}
+		for _, link := range state.Preload[source] {
+			value := fmt.Sprintf("<%s>; rel=preload", link.Href)
+			if link.As != "" {
+				value += "; as=" + link.As
+			}
+			w.Header().Add("Link", value)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreloadHeaders(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html":      "<h1>hello</h1>",
+		"about.html":      "<h1>about</h1>",
+		"app.js":          "console.log('hello')",
+		"docs/index.html": "<h1>docs</h1>",
+	})
+	router := newTestRouter(Configuration{
+		Public: public,
+		Preload: map[string][]ConfigPreload{
+			"/index.html": {
+				{Href: "/app.js", As: "script"},
+				{Href: "/app.css", As: "style"},
+			},
+		},
+	})
+
+	w := doRequest(router, "GET", "/", nil)
+	assert.Equal(t, []string{
+		"</app.js>; rel=preload; as=script",
+		"</app.css>; rel=preload; as=style",
+	}, w.Header().Values("Link"))
+
+	w = doRequest(router, "GET", "/about.html", nil)
+	assert.Empty(t, w.Header().Values("Link"))
+
+	w = doRequest(router, "GET", "/docs/", nil)
+	assert.Empty(t, w.Header().Values("Link"))
+
+	w = doRequest(router, "GET", "/app.js", nil)
+	assert.Empty(t, w.Header().Values("Link"))
+}
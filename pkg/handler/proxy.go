@@ -1,14 +1,19 @@
 package handler
 
 import (
+	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/koblas/swerver/pkg/swhttp"
+	"github.com/koblas/swerver/pkg/trace"
 )
 
 type Set map[string]struct{}
@@ -45,20 +50,54 @@ func appendHostToXForwardHeader(header http.Header, host string) {
 	header.Set("X-Forwarded-For", host)
 }
 
+// Where proxied responses get compressed, ProxyCompressUpstream lets the
+// upstream encode the response and compresses only what it sent as is,
+// ProxyCompressLocal always asks for an unencoded response.
+const (
+	ProxyCompressUpstream = "upstream"
+	ProxyCompressLocal    = "local"
+)
+
+// Idle connections kept open to each upstream, the default of 2 makes a
+// busy proxy route dial a new connection for most requests
+const proxyMaxIdleConnsPerHost = 64
+
+// proxyRoute is a proxy entry ready to be routed
+type proxyRoute struct {
+	source  string
+	pattern string
+	handler *proxy
+}
+
 type proxy struct {
-	remote string
+	remote        string
+	client        *http.Client
+	trailingSlash *bool
+	identity      bool
+	// Largest response body forwarded, zero for no limit
+	maxResponseBytes int64
+}
+
+// NewProxy forwards requests to remote through transport, nil uses a
+// transport with the default timeouts
+func NewProxy(remote string, transport http.RoundTripper) (http.Handler, error) {
+	return newProxy(remote, transport)
 }
 
-func NewProxy(remote string) http.Handler {
+func newProxy(remote string, transport http.RoundTripper) (*proxy, error) {
 	u, err := url.Parse(remote)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	if u.Scheme != "http" && u.Scheme != "https" {
-		log.Fatal("Only http and https proxy supported")
+		return nil, fmt.Errorf("only http and https proxy supported: %s", remote)
 	}
 
-	return &proxy{remote: remote}
+	if transport == nil {
+		transport = newProxyTransport()
+	}
+
+	return &proxy{remote: remote, client: &http.Client{Transport: transport}}, nil
 }
 
 func (p *proxy) ServeHTTP(wr http.ResponseWriter, req *http.Request) {
@@ -70,28 +109,289 @@ func (p *proxy) ServeHTTP(wr http.ResponseWriter, req *http.Request) {
 		remote = strings.ReplaceAll(remote, key, value)
 	}
 
+	if p.trailingSlash != nil {
+		remote = withTrailingSlash(remote, *p.trailingSlash)
+	}
+
+	trace.Add(req, "proxy %s", remote)
+
 	newreq, err := http.NewRequest(req.Method, remote, req.Body)
 	if err != nil {
-		http.Error(wr, "Server Error", http.StatusInternalServerError)
-		log.Fatal("ServeHTTP:", err)
-
+		log.Printf("Proxy request for %s failed: %v", remote, err)
+		http.Error(wr, "Bad Gateway", http.StatusBadGateway)
 		return
 	}
+	// Forwarding the length and Expect: 100-continue lets the upstream
+	// refuse the body before it is sent. The client gets its 100 Continue
+	// from the server once the transport starts reading the body, which it
+	// does when the upstream asked for it.
+	newreq.ContentLength = req.ContentLength
 	copyHeader(newreq.Header, req.Header, Set{})
+	if p.identity {
+		newreq.Header.Set("Accept-Encoding", "identity")
+	} else if acceptsEventStream(req) {
+		// Events have to reach the client as they are sent, an encoded
+		// stream could be held back by the upstream compressor. Removing
+		// the header would let the transport ask for gzip on its own.
+		newreq.Header.Set("Accept-Encoding", "identity")
+	}
 
 	if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
 		appendHostToXForwardHeader(newreq.Header, clientIP)
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(newreq)
-	if err != nil {
-		http.Error(wr, "Server Error", http.StatusInternalServerError)
-		log.Fatal("ServeHTTP:", err)
+	resp, err := p.client.Do(newreq)
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		log.Printf("Proxy timeout for %s: %v", remote, err)
+		http.Error(wr, "Gateway Timeout", http.StatusGatewayTimeout)
+		return
+	}
+	if err != nil || resp == nil {
+		log.Printf("Proxy error for %s: %v", remote, err)
+		http.Error(wr, "Bad Gateway", http.StatusBadGateway)
+		return
 	}
 	defer resp.Body.Close()
 
+	if p.maxResponseBytes > 0 && resp.ContentLength > p.maxResponseBytes {
+		log.Printf("Proxy response for %s of %d bytes exceeds %d bytes", remote, resp.ContentLength, p.maxResponseBytes)
+		http.Error(wr, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+
 	copyHeader(wr.Header(), resp.Header, hopHeaders)
+	// The compression middleware overwrites Vary, recording the upstream
+	// values keeps them in the final header
+	swhttp.AddVary(wr, req, resp.Header.Values("Vary")...)
+	if isEventStream(resp.Header) {
+		trace.Add(req, "event stream")
+		wr.Header().Del("Content-Length")
+		wr.WriteHeader(resp.StatusCode)
+		copyFlushing(wr, resp.Body)
+		return
+	}
 	wr.WriteHeader(resp.StatusCode)
-	io.Copy(wr, resp.Body)
+	if p.maxResponseBytes <= 0 {
+		io.Copy(wr, resp.Body)
+		return
+	}
+
+	// The size wasn't announced, the body is cut at the limit
+	n, _ := io.Copy(wr, io.LimitReader(resp.Body, p.maxResponseBytes))
+	if n == p.maxResponseBytes && exceeds(resp.Body) {
+		log.Printf("Proxy response for %s truncated at %d bytes", remote, p.maxResponseBytes)
+	}
+}
+
+// exceeds tells if body has any data left
+func exceeds(body io.Reader) bool {
+	n, _ := io.ReadFull(body, make([]byte, 1))
+
+	return n > 0
+}
+
+// proxyPattern translates a proxy source into a chi route pattern. Segments
+// are literal, named with {name} or :name, and the last one may be * or **
+// to match the rest of the path, however many segments it has.
+func proxyPattern(source string) (string, error) {
+	if !strings.HasPrefix(source, "/") {
+		return "", fmt.Errorf("proxy source %q must start with /", source)
+	}
+
+	segments := strings.Split(source[1:], "/")
+	for idx, segment := range segments {
+		switch {
+		case segment == "*" || segment == "**":
+			if idx != len(segments)-1 {
+				return "", fmt.Errorf("proxy source %q: %s is only supported as the last segment", source, segment)
+			}
+			segments[idx] = "*"
+		case strings.HasPrefix(segment, ":") && len(segment) > 1:
+			segments[idx] = "{" + segment[1:] + "}"
+		case strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") && len(segment) > 2:
+			// already a chi parameter
+		case strings.ContainsAny(segment, "*?[]{}():"):
+			return "", fmt.Errorf("proxy source %q: unsupported pattern %q", source, segment)
+		}
+	}
+
+	return "/" + strings.Join(segments, "/"), nil
+}
+
+// compileProxies builds the handlers of the proxy entries, they share a
+// transport with the configured timeouts
+func (state HandlerState) compileProxies() ([]proxyRoute, error) {
+	if len(state.Proxy) == 0 {
+		return nil, nil
+	}
+
+	transport, err := state.proxyTransport()
+	if err != nil {
+		return nil, err
+	}
+
+	routes := []proxyRoute{}
+	for _, item := range state.Proxy {
+		handler, err := newProxy(item.Destination, transport)
+		if err != nil {
+			return nil, err
+		}
+		handler.trailingSlash = item.TrailingSlash
+		handler.identity = state.proxyCompressLocally()
+		handler.maxResponseBytes = state.ProxyMaxResponseBytes
+
+		pattern, err := proxyPattern(item.Source)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, proxyRoute{source: item.Source, pattern: pattern, handler: handler})
+	}
+
+	return routes, nil
+}
+
+// attach registers the routes of a proxy entry, with trailingSlash set a
+// literal source is routed both with and without the trailing slash.
+func (route proxyRoute) attach(router chi.Router) {
+	pattern, handler := route.pattern, route.handler
+
+	base := strings.TrimSuffix(pattern, "/")
+	if handler.trailingSlash == nil || strings.HasSuffix(pattern, "*") || base == "" {
+		router.Handle(pattern, handler)
+		return
+	}
+
+	router.Handle(base, handler)
+	router.Handle(base+"/", handler)
+}
+
+// withTrailingSlash adds or removes the trailing slash on the path of remote
+func withTrailingSlash(remote string, slash bool) string {
+	base, query, hasQuery := strings.Cut(remote, "?")
+
+	base = strings.TrimRight(base, "/")
+	if slash {
+		base += "/"
+	}
+	if hasQuery {
+		base += "?" + query
+	}
+
+	return base
+}
+
+// acceptsEventStream tells if the client asked for Server-Sent Events
+func acceptsEventStream(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept") {
+		if strings.Contains(value, "text/event-stream") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isEventStream tells if a response carries Server-Sent Events, they are
+// never compressed since text/event-stream isn't a compressible type.
+func isEventStream(header http.Header) bool {
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+
+	return mediaType == "text/event-stream"
+}
+
+// copyFlushing copies body to w flushing after every read so each event is
+// sent as soon as the upstream produced it
+func copyFlushing(w http.ResponseWriter, body io.Reader) error {
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// proxyTransport builds the transport shared by all proxy routes with the
+// configured timeouts, timeouts left out keep the net/http defaults.
+func (state HandlerState) proxyTransport() (*http.Transport, error) {
+	transport := newProxyTransport()
+
+	timeouts := []struct {
+		name  string
+		value string
+		set   func(time.Duration)
+	}{
+		{"proxyDialTimeout", state.ProxyDialTimeout, func(timeout time.Duration) {
+			dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+			transport.DialContext = dialer.DialContext
+		}},
+		{"proxyTLSTimeout", state.ProxyTLSTimeout, func(timeout time.Duration) {
+			transport.TLSHandshakeTimeout = timeout
+		}},
+		{"proxyResponseHeaderTimeout", state.ProxyResponseHeaderTimeout, func(timeout time.Duration) {
+			transport.ResponseHeaderTimeout = timeout
+		}},
+		{"proxyExpectContinueTimeout", state.ProxyExpectContinueTimeout, func(timeout time.Duration) {
+			transport.ExpectContinueTimeout = timeout
+		}},
+	}
+	for _, item := range timeouts {
+		timeout, err := parseTimeout(item.name, item.value)
+		if err != nil {
+			return nil, err
+		}
+		if timeout != 0 {
+			item.set(timeout)
+		}
+	}
+
+	return transport, nil
+}
+
+// newProxyTransport is the default transport pooling connections to the
+// upstreams, shared by all the proxy routes
+func newProxyTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = proxyMaxIdleConnsPerHost
+
+	return transport
+}
+
+// parseTimeout reads a duration like "5s" from the configuration
+func parseTimeout(name, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", name, err)
+	}
+
+	return timeout, nil
+}
+
+// proxyCompressLocally tells if proxied responses are requested unencoded
+// and compressed by the compression middleware
+func (state HandlerState) proxyCompressLocally() bool {
+	switch state.ProxyCompression {
+	case "", ProxyCompressUpstream:
+		return false
+	case ProxyCompressLocal:
+		return !state.NoCompression
+	}
+
+	return false
 }
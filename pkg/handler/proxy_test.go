@@ -0,0 +1,341 @@
+package handler
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyResponseHeaderTimeout(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Write([]byte("upstream"))
+	}))
+	defer upstream.Close()
+
+	router := newTestRouter(Configuration{
+		Public:                     t.TempDir(),
+		Proxy:                      []ConfigProxy{{Source: "/api/*", Destination: upstream.URL + "/*"}},
+		ProxyDialTimeout:           "1s",
+		ProxyTLSTimeout:            "1s",
+		ProxyResponseHeaderTimeout: "50ms",
+	})
+
+	w := doRequest(router, "GET", "/api/slow", nil)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+
+	w = doRequest(router, "GET", "/api/fast", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "upstream", w.Body.String())
+}
+
+func TestProxyUpstreamError(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Drop the connection without answering
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer upstream.Close()
+
+	public := writeFiles(t, map[string]string{"index.html": "hello"})
+	router := newTestRouter(Configuration{
+		Public: public,
+		Proxy:  []ConfigProxy{{Source: "/api/*", Destination: upstream.URL + "/*"}},
+	})
+
+	w := doRequest(router, "GET", "/api/items", nil)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+
+	// Static files are still served
+	w = doRequest(router, "GET", "/index.html", nil)
+	assert.NotEqual(t, http.StatusBadGateway, w.Code)
+	assert.Less(t, w.Code, 400)
+
+	// An upstream that isn't listening at all
+	upstream.Close()
+	w = doRequest(router, "GET", "/api/items", nil)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+}
+
+func TestProxyTransport(t *testing.T) {
+	state := newTestHandler(Configuration{ProxyTLSTimeout: "3s", ProxyResponseHeaderTimeout: "2s"})
+
+	transport, err := state.proxyTransport()
+	assert.Nil(t, err)
+	assert.Equal(t, 3*time.Second, transport.TLSHandshakeTimeout)
+	assert.Equal(t, 2*time.Second, transport.ResponseHeaderTimeout)
+
+	transport, _ = newTestHandler(Configuration{ProxyExpectContinueTimeout: "250ms"}).proxyTransport()
+	assert.Equal(t, 250*time.Millisecond, transport.ExpectContinueTimeout)
+
+	transport, _ = newTestHandler(Configuration{}).proxyTransport()
+	assert.Equal(t, http.DefaultTransport.(*http.Transport).TLSHandshakeTimeout, transport.TLSHandshakeTimeout)
+	assert.Equal(t, time.Duration(0), transport.ResponseHeaderTimeout)
+	assert.Equal(t, proxyMaxIdleConnsPerHost, transport.MaxIdleConnsPerHost)
+
+	_, err = newTestHandler(Configuration{ProxyTLSTimeout: "3"}).proxyTransport()
+	assert.NotNil(t, err)
+}
+
+func TestProxyEventStream(t *testing.T) {
+	next := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "identity", r.Header.Get("Accept-Encoding"))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: one\n\n"))
+		w.(http.Flusher).Flush()
+
+		// The second event is only sent once the client saw the first
+		select {
+		case <-next:
+		case <-time.After(2 * time.Second):
+			return
+		}
+		w.Write([]byte("data: two\n\n"))
+	}))
+	defer upstream.Close()
+
+	server := httptest.NewServer(newTestRouter(Configuration{
+		Public: t.TempDir(),
+		Proxy:  []ConfigProxy{{Source: "/events", Destination: upstream.URL + "/events"}},
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/events", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "data: one\n", line)
+	close(next)
+
+	rest, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "\ndata: two\n\n", string(rest))
+}
+
+func TestProxyTrailingSlash(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RequestURI()))
+	}))
+	defer upstream.Close()
+
+	slash, noSlash := true, false
+	router := newTestRouter(Configuration{
+		Public: t.TempDir(),
+		Proxy: []ConfigProxy{
+			{Source: "/api", Destination: upstream.URL + "/v1/api", TrailingSlash: &slash},
+			{Source: "/rpc/", Destination: upstream.URL + "/rpc/", TrailingSlash: &noSlash},
+			{Source: "/items/*", Destination: upstream.URL + "/items/*", TrailingSlash: &noSlash},
+		},
+	})
+
+	for _, target := range []string{"/api", "/api/"} {
+		w := doRequest(router, "GET", target, nil)
+		assert.Equal(t, http.StatusOK, w.Code, target)
+		assert.Equal(t, "/v1/api/", w.Body.String(), target)
+	}
+	for _, target := range []string{"/rpc", "/rpc/"} {
+		w := doRequest(router, "GET", target, nil)
+		assert.Equal(t, http.StatusOK, w.Code, target)
+		assert.Equal(t, "/rpc", w.Body.String(), target)
+	}
+
+	w := doRequest(router, "GET", "/items/42/", nil)
+	assert.Equal(t, "/items/42", w.Body.String())
+
+	assert.Equal(t, "http://host/a/?x=1", withTrailingSlash("http://host/a?x=1", true))
+	assert.Equal(t, "http://host/a", withTrailingSlash("http://host/a//", false))
+}
+
+func TestProxySourcePatterns(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RequestURI()))
+	}))
+	defer upstream.Close()
+
+	router := newTestRouter(Configuration{
+		Public: t.TempDir(),
+		Proxy: []ConfigProxy{
+			{Source: "/api/*", Destination: upstream.URL + "/*"},
+			{Source: "/v1/**", Destination: upstream.URL + "/v1/*"},
+			{Source: "/users/:id/avatar", Destination: upstream.URL + "/avatars/id"},
+		},
+	})
+
+	for target, expected := range map[string]string{
+		"/api/items":         "/items",
+		"/api/items/42/tags": "/items/42/tags",
+		"/v1/a/b/c":          "/v1/a/b/c",
+		"/users/7/avatar":    "/avatars/7",
+	} {
+		w := doRequest(router, "GET", target, nil)
+		assert.Equal(t, http.StatusOK, w.Code, target)
+		assert.Equal(t, expected, w.Body.String(), target)
+	}
+
+	for source, expected := range map[string]string{
+		"/api/*":        "/api/*",
+		"/api/**":       "/api/*",
+		"/**":           "/*",
+		"/users/:id":    "/users/{id}",
+		"/users/{id}/x": "/users/{id}/x",
+		"/plain/":       "/plain/",
+	} {
+		pattern, err := proxyPattern(source)
+		assert.NoError(t, err, source)
+		assert.Equal(t, expected, pattern, source)
+	}
+
+	for _, source := range []string{"api/*", "/api/*/users", "/**/x", "/*.js", "/file?", "/[ab]"} {
+		_, err := proxyPattern(source)
+		assert.Error(t, err, source)
+	}
+}
+
+func TestProxyCompression(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Vary", "Origin")
+		w.Header().Set("X-Accept-Encoding", r.Header.Get("Accept-Encoding"))
+		body := strings.Repeat(`{"name":"value"},`, 100)
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write([]byte(body))
+	}))
+	defer upstream.Close()
+
+	for _, mode := range []string{"", "local"} {
+		router := newTestRouter(Configuration{
+			Public:           t.TempDir(),
+			Proxy:            []ConfigProxy{{Source: "/api/*", Destination: upstream.URL + "/*"}},
+			ProxyCompression: mode,
+		})
+
+		w := doRequest(router, "GET", "/api/items", map[string]string{"Accept-Encoding": "gzip"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+		assert.Empty(t, w.Header().Get("Content-Length"))
+		assert.Equal(t, []string{"Accept-Encoding, Origin"}, w.Header().Values("Vary"))
+		assert.Equal(t, strings.Repeat(`{"name":"value"},`, 100), gunzip(t, w.Body.Bytes()))
+		if mode == "local" {
+			assert.Equal(t, "identity", w.Header().Get("X-Accept-Encoding"))
+		} else {
+			assert.Equal(t, "gzip", w.Header().Get("X-Accept-Encoding"))
+		}
+	}
+}
+
+func BenchmarkProxy(b *testing.B) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer upstream.Close()
+
+	router := newTestRouter(Configuration{
+		Public: b.TempDir(),
+		Proxy:  []ConfigProxy{{Source: "/api/*", Destination: upstream.URL + "/*"}},
+	})
+
+	// Concurrent clients on the same upstream, whatever the CPU count
+	b.SetParallelism(16)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/api/items", nil))
+			if w.Code != http.StatusOK {
+				b.Fatalf("unexpected status %d", w.Code)
+			}
+		}
+	})
+}
+
+func TestProxyMaxResponseBytes(t *testing.T) {
+	body := strings.Repeat("x", 100)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			// Flushing before writing leaves the size unknown
+			w.(http.Flusher).Flush()
+		}
+		io.WriteString(w, body)
+	}))
+	defer upstream.Close()
+
+	router := newTestRouter(Configuration{
+		Public:                writeFiles(t, map[string]string{"index.html": "hello"}),
+		Proxy:                 []ConfigProxy{{Source: "/api/*", Destination: upstream.URL + "/*"}},
+		ProxyMaxResponseBytes: 64,
+	})
+
+	w := doRequest(router, "GET", "/api/sized", nil)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.NotContains(t, w.Body.String(), "xxx")
+
+	w = doRequest(router, "GET", "/api/chunked", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, body[:64], w.Body.String())
+
+	router = newTestRouter(Configuration{
+		Public:                writeFiles(t, map[string]string{"index.html": "hello"}),
+		Proxy:                 []ConfigProxy{{Source: "/api/*", Destination: upstream.URL + "/*"}},
+		ProxyMaxResponseBytes: 100,
+	})
+	for _, target := range []string{"/api/sized", "/api/chunked"} {
+		w = doRequest(router, "GET", target, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, body, w.Body.String())
+	}
+}
+
+func TestProxyExpectContinue(t *testing.T) {
+	received := make(chan string, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/refused" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		assert.Equal(t, "100-continue", r.Header.Get("Expect"))
+		assert.Equal(t, int64(4), r.ContentLength)
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer upstream.Close()
+
+	server := httptest.NewServer(newTestRouter(Configuration{
+		Public: writeFiles(t, map[string]string{"index.html": "hello"}),
+		Proxy:  []ConfigProxy{{Source: "/api/*", Destination: upstream.URL + "/*"}},
+	}))
+	defer server.Close()
+
+	resp, sent := expectContinue(t, server.URL+"/api/items", "data", nil)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.True(t, sent)
+	assert.Equal(t, "data", <-received)
+
+	// The upstream refuses without asking for the body, so does the client
+	resp, sent = expectContinue(t, server.URL+"/api/refused", "data", nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.False(t, sent)
+}
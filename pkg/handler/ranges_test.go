@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxRanges(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	public := writeFiles(t, map[string]string{
+		"data.txt": content,
+	})
+	router := newTestRouter(Configuration{Public: public, MaxRanges: 3, NoCompression: true})
+
+	ranges := []string{}
+	for i := 0; i < 20; i++ {
+		ranges = append(ranges, fmt.Sprintf("%d-%d", i*5, i*5))
+	}
+
+	w := doRequest(router, "GET", "/data.txt", map[string]string{"Range": "bytes=" + strings.Join(ranges, ",")})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, content, w.Body.String())
+
+	w = doRequest(router, "GET", "/data.txt", map[string]string{"Range": "bytes=" + strings.Join(ranges[:3], ",")})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "multipart/byteranges"))
+
+	w = doRequest(router, "GET", "/data.txt", map[string]string{"Range": "bytes=10-19"})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "0123456789", w.Body.String())
+}
+
+func TestEmptyFileRanges(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"empty.txt": "",
+		"data.txt":  "0123456789",
+	})
+	router := newTestRouter(Configuration{Public: public, NoCompression: true})
+
+	w := doRequest(router, "GET", "/empty.txt", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("Content-Length"))
+	assert.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+	assert.Empty(t, w.Body.String())
+
+	for _, ranges := range []string{"bytes=0-", "bytes=0-0", "bytes=-5", "bytes=-0", "bytes=5-10"} {
+		w = doRequest(router, "GET", "/empty.txt", map[string]string{"Range": ranges})
+		assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code, ranges)
+		assert.Equal(t, "bytes */0", w.Header().Get("Content-Range"), ranges)
+	}
+
+	// A suffix of nothing can't be satisfied whatever the size
+	w = doRequest(router, "GET", "/data.txt", map[string]string{"Range": "bytes=-0"})
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+	assert.Equal(t, "bytes */10", w.Header().Get("Content-Range"))
+	w = doRequest(router, "GET", "/data.txt", map[string]string{"Range": "bytes=-20"})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "bytes 0-9/10", w.Header().Get("Content-Range"))
+
+	router = newTestRouter(Configuration{Public: public, NoCompression: true, IgnoreEmptyRanges: true, CacheSize: 1024})
+	for i := 0; i < 2; i++ {
+		w = doRequest(router, "GET", "/empty.txt", map[string]string{"Range": "bytes=0-"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "0", w.Header().Get("Content-Length"))
+		assert.Empty(t, w.Header().Get("Content-Range"))
+	}
+	w = doRequest(router, "GET", "/data.txt", map[string]string{"Range": "bytes=0-"})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+}
+
+func TestNoRangePaths(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"live/status.txt": "0123456789",
+		"data.txt":        "0123456789",
+	})
+	config := Configuration{Public: public, NoCompression: true, NoRangePaths: []string{"/live/**"}}
+
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w := doRequest(handler, "GET", "/live/status.txt", map[string]string{"Range": "bytes=2-4"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "0123456789", w.Body.String())
+		assert.Equal(t, "none", w.Header().Get("Accept-Ranges"))
+		assert.Empty(t, w.Header().Get("Content-Range"))
+
+		w = doRequest(handler, "GET", "/data.txt", map[string]string{"Range": "bytes=2-4"})
+		assert.Equal(t, http.StatusPartialContent, w.Code)
+		assert.Equal(t, "234", w.Body.String())
+		assert.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+	}
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+)
+
+// HTTPSRedirect permanently redirects every request to its https:// URL,
+// keeping the path and query. The target uses port, none for 443 or empty.
+func HTTPSRedirect(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if name, _, err := net.SplitHostPort(host); err == nil {
+			host = name
+		}
+		if host == "" {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if net.ParseIP(host) != nil && net.ParseIP(host).To4() == nil {
+			host = "[" + host + "]"
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// NewRedirectServer is the plain HTTP listener of ssl.redirectAddr sending
+// its requests to HTTPS, nil when none is configured
+func NewRedirectServer(config Configuration) *http.Server {
+	if config.Ssl.RedirectAddr == "" {
+		return nil
+	}
+
+	handler := HTTPSRedirect(config.Ssl.RedirectPort)
+	if !config.KeepHostDot {
+		next := handler
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Host = trimHostDot(r.Host)
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	return &http.Server{
+		Addr:    ListenAddress(config.Ssl.RedirectAddr),
+		Handler: handler,
+	}
+}
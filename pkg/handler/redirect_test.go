@@ -0,0 +1,312 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedirectMatchQuery(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html": "index",
+	})
+	config := Configuration{
+		Public: public,
+		Redirects: []ConfigRedirect{
+			{Source: "/docs?lang=fr", Destination: "/fr/docs", MatchQuery: true},
+			{Source: "/search?q=:term", Destination: "/find/:term", MatchQuery: true},
+		},
+	}
+
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w := doRequest(handler, "GET", "/search?q=hello+world&page=2", nil)
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, "/find/hello%20world", w.Header().Get("Location"))
+
+		w = doRequest(handler, "GET", "/docs?lang=fr", nil)
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, "/fr/docs", w.Header().Get("Location"))
+
+		w = doRequest(handler, "GET", "/docs?lang=de", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = doRequest(handler, "GET", "/search", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	}
+}
+
+func TestRewriteMatchQuery(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"pages/42.html": "page 42",
+	})
+	config := Configuration{
+		Public:   public,
+		Rewrites: []ConfigRewrite{{Source: "/page?id=:id", Destination: "/pages/:id.html", MatchQuery: true}},
+	}
+
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w := doRequest(handler, "GET", "/page?id=42", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "page 42", w.Body.String())
+
+		w = doRequest(handler, "GET", "/page", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	}
+}
+
+func TestRedirectLoop(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html": "index",
+	})
+	config := Configuration{
+		Public: public,
+		Redirects: []ConfigRedirect{
+			{Source: "/a", Destination: "/b"},
+			{Source: "/b", Destination: "/a"},
+		},
+	}
+
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w := doRequest(handler, "GET", "/a", nil)
+		assert.Equal(t, http.StatusLoopDetected, w.Code)
+		assert.Contains(t, w.Body.String(), "Loop Detected")
+
+		w = doRequest(handler, "GET", "/a", map[string]string{"Accept": "application/json"})
+		assert.Equal(t, http.StatusLoopDetected, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"loop_detected"`)
+	}
+}
+
+func TestRewriteLoop(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html": "index",
+	})
+	config := Configuration{
+		Public: public,
+		Rewrites: []ConfigRewrite{
+			{Source: "/a", Destination: "/b"},
+			{Source: "/b", Destination: "/a"},
+		},
+	}
+
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w := doRequest(handler, "GET", "/a", nil)
+		assert.Equal(t, http.StatusLoopDetected, w.Code)
+	}
+
+	_, err := applyRewrites("/a", nil, config.Rewrites)
+	assert.EqualError(t, err, "redirect loop: /a -> /b -> /a")
+}
+
+func TestSlashRedirectLoop(t *testing.T) {
+	// The clean url of /a.html is redirected back to it
+	config := Configuration{
+		Public:    writeFiles(t, map[string]string{"a.html": "a"}),
+		Redirects: []ConfigRedirect{{Source: "/a", Destination: "/a.html"}},
+	}
+
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w := doRequest(handler, "GET", "/a.html", nil)
+		assert.Equal(t, http.StatusLoopDetected, w.Code)
+	}
+}
+
+func TestRedirectChainLength(t *testing.T) {
+	rewrites := []ConfigRewrite{}
+	for i := 0; i < maxRedirectChain; i++ {
+		rewrites = append(rewrites, ConfigRewrite{Source: fmt.Sprintf("/p%d", i), Destination: fmt.Sprintf("/p%d", i+1)})
+	}
+
+	_, err := applyRewrites("/p0", nil, rewrites)
+	assert.Error(t, err)
+	_, err = applyRewrites("/p1", nil, rewrites)
+	assert.NoError(t, err)
+
+	state := newTestHandler(Configuration{})
+	assert.NoError(t, state.checkRedirectChain("/old", "https://example.com/new"))
+}
+
+func TestRedirectType(t *testing.T) {
+	config, err := ReadServeConfiguration(strings.NewReader(`{
+		"redirects": [
+			{"source": "/default", "destination": "/new"},
+			{"source": "/moved", "destination": "/new", "type": 301},
+			{"source": "/found", "destination": "/new", "type": 302},
+			{"source": "/other", "destination": "/new", "type": 303},
+			{"source": "/temporary", "destination": "/new", "type": 307},
+			{"source": "/permanent", "destination": "/new", "type": 308}
+		]
+	}`))
+	assert.Nil(t, err)
+	config.Public = writeFiles(t, map[string]string{
+		"new.html": "new",
+	})
+	state := newTestHandler(config)
+
+	for target, status := range map[string]int{
+		"/default":   http.StatusTemporaryRedirect,
+		"/moved":     http.StatusMovedPermanently,
+		"/found":     http.StatusFound,
+		"/other":     http.StatusSeeOther,
+		"/temporary": http.StatusTemporaryRedirect,
+		"/permanent": http.StatusPermanentRedirect,
+	} {
+		w := doRequest(state, "GET", target, nil)
+		assert.Equal(t, status, w.Code, target)
+		assert.Equal(t, "/new", w.Header().Get("Location"), target)
+	}
+}
+
+func TestTrailingSlash(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"about.html":  "about",
+		"docs/a.txt":  "a",
+		".well-known": "dotfile",
+		"style.css":   "css",
+	})
+
+	config := Configuration{Public: public, TrailingSlash: true}
+	for _, add := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w := doRequest(add, "GET", "/about", nil)
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, "/about/", w.Header().Get("Location"))
+		w = doRequest(add, "GET", "/about/", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "about", w.Body.String())
+		w = doRequest(add, "GET", "/style.css", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = doRequest(add, "GET", "/.well-known", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = doRequest(add, "GET", "/docs/", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// Clean urls and the slash are handled by a single redirect
+		w = doRequest(add, "GET", "/about.html", nil)
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, "/about/", w.Header().Get("Location"))
+	}
+
+	config = Configuration{Public: public, NoTrailingSlash: true}
+	for _, remove := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w := doRequest(remove, "GET", "/about/", nil)
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, "/about", w.Header().Get("Location"))
+		w = doRequest(remove, "GET", "/about", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "about", w.Body.String())
+		w = doRequest(remove, "GET", "/", nil)
+		assert.NotEqual(t, http.StatusTemporaryRedirect, w.Code)
+		w = doRequest(remove, "GET", "/docs", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = doRequest(remove, "GET", "/about.html", nil)
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, "/about", w.Header().Get("Location"))
+	}
+
+	// Without either setting the path is served as requested
+	config = Configuration{Public: public}
+	for _, neither := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w := doRequest(neither, "GET", "/about", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = doRequest(neither, "GET", "/docs/", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+}
+
+func TestCleanUrlRedirect(t *testing.T) {
+	config := Configuration{
+		Public: writeFiles(t, map[string]string{
+			"about.html":      "about",
+			"docs/index.html": "docs",
+		}),
+	}
+
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w := doRequest(handler, "GET", "/about.html", nil)
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, "/about", w.Header().Get("Location"))
+
+		w = doRequest(handler, "GET", "/docs/index", nil)
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, "/docs", w.Header().Get("Location"))
+	}
+
+	// Pages are served as requested without clean urls
+	config.NoCleanUrls = true
+	w := doRequest(newTestRouter(config), "GET", "/about.html", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "about", w.Body.String())
+}
+
+func TestRedirectQuery(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"about.html":    "about",
+		"docs/a.txt":    "a",
+		"new/page.html": "page",
+	})
+	config := Configuration{
+		Public: public,
+		Redirects: []ConfigRedirect{
+			{Source: "/old", Destination: "/new/page"},
+			{Source: "/search?q=:term", Destination: "/find/:term", MatchQuery: true},
+		},
+	}
+
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		// Clean URL redirects keep the query by default
+		w := doRequest(handler, "GET", "/about.html?v=123", nil)
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, "/about?v=123", w.Header().Get("Location"))
+
+		w = doRequest(handler, "GET", "/old?utm=x", nil)
+		assert.Equal(t, "/new/page?utm=x", w.Header().Get("Location"))
+
+		// A query matched by the rule is not passed on
+		w = doRequest(handler, "GET", "/search?q=shoes&page=2", nil)
+		assert.Equal(t, "/find/shoes", w.Header().Get("Location"))
+	}
+
+	w := doRequest(newTestRouter(config), "GET", "/docs?v=1", nil)
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "docs/?v=1", w.Header().Get("Location"))
+
+	config.DropQuery = true
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		w = doRequest(handler, "GET", "/about.html?v=123", nil)
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, "/about", w.Header().Get("Location"))
+
+		w = doRequest(handler, "GET", "/old?utm=x", nil)
+		assert.Equal(t, "/new/page", w.Header().Get("Location"))
+	}
+
+	w = doRequest(newTestRouter(config), "GET", "/docs?v=1", nil)
+	assert.Equal(t, "docs/", w.Header().Get("Location"))
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	w := doRequest(HTTPSRedirect(""), "GET", "http://example.com:8080/docs/a.html?v=1", nil)
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "https://example.com/docs/a.html?v=1", w.Header().Get("Location"))
+
+	w = doRequest(HTTPSRedirect("8443"), "GET", "http://example.com/", nil)
+	assert.Equal(t, "https://example.com:8443/", w.Header().Get("Location"))
+
+	w = doRequest(HTTPSRedirect("443"), "GET", "http://[::1]:80/a", nil)
+	assert.Equal(t, "https://[::1]/a", w.Header().Get("Location"))
+
+	assert.Nil(t, NewRedirectServer(Configuration{}))
+
+	var config Configuration
+	config.Ssl.RedirectAddr = "80"
+	config.Ssl.RedirectPort = "8443"
+	server := NewRedirectServer(config)
+	if assert.NotNil(t, server) {
+		assert.Equal(t, ":80", server.Addr)
+		w = doRequest(server.Handler, "POST", "http://example.com/form", nil)
+		assert.Equal(t, "https://example.com:8443/form", w.Header().Get("Location"))
+	}
+}
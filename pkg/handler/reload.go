@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+type reloadable struct {
+	handler http.Handler
+}
+
+// Reloader serves requests with the most recently built handler. A reload
+// swaps the handler atomically, requests in flight finish on the handler
+// they started with.
+type Reloader struct {
+	build   func() (http.Handler, error)
+	current atomic.Value
+}
+
+// NewReloader serves with handler until the first reload, build creates
+// the handler for every reload.
+func NewReloader(handler http.Handler, build func() (http.Handler, error)) *Reloader {
+	reloader := &Reloader{build: build}
+	reloader.current.Store(reloadable{handler})
+
+	return reloader
+}
+
+// Reload builds a new handler and swaps it in, the current handler is kept
+// when the configuration can't be loaded.
+func (reloader *Reloader) Reload() (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("invalid configuration: %v", p)
+		}
+	}()
+
+	handler, err := reloader.build()
+	if err != nil {
+		return err
+	}
+	reloader.current.Store(reloadable{handler})
+
+	return nil
+}
+
+func (reloader *Reloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reloader.current.Load().(reloadable).handler.ServeHTTP(w, r)
+}
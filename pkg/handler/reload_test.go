@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloader(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html": "index",
+	})
+	config := Configuration{
+		Public:    public,
+		Redirects: []ConfigRedirect{{Source: "/old", Destination: "/new"}},
+	}
+
+	var loadErr error
+	reloader := NewReloader(newTestHandler(config), func() (http.Handler, error) {
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		return newTestHandler(config), nil
+	})
+
+	w := doRequest(reloader, "GET", "/old", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "/new", w.Header().Get("Location"))
+
+	config.Redirects = []ConfigRedirect{{Source: "/old", Destination: "/newer"}}
+	assert.Nil(t, reloader.Reload())
+	w = doRequest(reloader, "GET", "/old", nil)
+	assert.Equal(t, "/newer", w.Header().Get("Location"))
+
+	// A broken configuration keeps the current handler
+	config.Redirects = []ConfigRedirect{{Source: "/old", Destination: "/newest"}}
+	loadErr = errors.New("unexpected end of JSON input")
+	assert.NotNil(t, reloader.Reload())
+	w = doRequest(reloader, "GET", "/old", nil)
+	assert.Equal(t, "/newer", w.Header().Get("Location"))
+}
+
+func TestReloaderPanic(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html": "index",
+	})
+
+	reloader := NewReloader(newTestRouter(Configuration{Public: public}), func() (http.Handler, error) {
+		return newTestRouter(Configuration{Public: public, BlockUserAgents: []string{"("}}), nil
+	})
+
+	assert.NotNil(t, reloader.Reload())
+	w := doRequest(reloader, "GET", "/", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "index", w.Body.String())
+}
+
+func TestReloaderInvalidConfiguration(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html": "index",
+	})
+
+	// Valid JSON with a setting NewHandler rejects
+	source := `{"redirects": [{"source": "/old", "destination": "/new", "type": 200}]}`
+	reloader := NewReloader(newTestRouter(Configuration{Public: public}), func() (http.Handler, error) {
+		config, err := ReadServeConfiguration(strings.NewReader(source))
+		if err != nil {
+			return nil, err
+		}
+		config.Public = public
+
+		state, err := NewHandler(config)
+		if err != nil {
+			return nil, err
+		}
+		router := chi.NewRouter()
+		state.AttachRoutes(router)
+
+		return router, nil
+	})
+
+	err := reloader.Reload()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid redirect type 200")
+	w := doRequest(reloader, "GET", "/", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "index", w.Body.String())
+	w = doRequest(reloader, "GET", "/old", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
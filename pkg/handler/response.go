@@ -0,0 +1,36 @@
+package handler
+
+import "net/http"
+
+// hookWriter calls before just ahead of the response headers being sent,
+// giving middleware a last chance to adjust them.
+type hookWriter struct {
+	http.ResponseWriter
+	before      func(w http.ResponseWriter, status int)
+	wroteHeader bool
+}
+
+func (w *hookWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.before(w.ResponseWriter, status)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *hookWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *hookWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
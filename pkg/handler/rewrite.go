@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/koblas/swerver/pkg/swhttp"
+	"github.com/koblas/swerver/pkg/trace"
+)
+
+// rewritesMiddleware serves the file a rewrite rule points the request
+// to. Existing files with an extension are served as is, and a rewrite to
+// a missing file leaves the request alone.
+func (state HandlerState) rewritesMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Path
+		if path.Ext(name) != "" && state.exists(name) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rewritten, err := applyRewrites(name, r.URL.Query(), state.Rewrites)
+		if err != nil {
+			state.sendLoopError(w, r, err)
+			return
+		}
+		if rewritten == nil || *rewritten == name || !state.exists(*rewritten) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		trace.Add(r, "rewrite %s -> %s", name, *rewritten)
+		next.ServeHTTP(w, swhttp.WithRewrite(r, *rewritten))
+	})
+}
+
+// exists tells if something is at name in the public directory
+func (state HandlerState) exists(name string) bool {
+	_, err := os.Lstat(filepath.Join(state.Public, filepath.FromSlash(name)))
+	return !os.IsNotExist(err)
+}
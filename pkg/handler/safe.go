@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// noSymlinkDir is an http.Dir refusing anything reached through a symlink,
+// which keeps every file served inside of the directory.
+type noSymlinkDir struct {
+	http.Dir
+}
+
+func (d noSymlinkDir) Open(name string) (http.File, error) {
+	current := string(d.Dir)
+	for _, part := range strings.Split(path.Clean("/"+name), "/") {
+		if part == "" {
+			continue
+		}
+		current = filepath.Join(current, part)
+
+		info, err := os.Lstat(current)
+		if err != nil {
+			return nil, err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+	}
+
+	return d.Dir.Open(name)
+}
+
+// applySafeMode removes everything a safe mode configuration must not do,
+// no matter what the rest of the configuration asks for.
+func applySafeMode(config Configuration) Configuration {
+	if !config.SafeMode {
+		return config
+	}
+
+	config.Proxy = nil
+	config.Symlinks = false
+	config.AllowUploads = false
+
+	return config
+}
+
+// root is the file system static content is served from, symlinks are
+// only followed when the symlinks option is set
+func (state HandlerState) root() http.FileSystem {
+	if state.SafeMode || !state.Symlinks {
+		return noSymlinkDir{http.Dir(state.Public)}
+	}
+	return http.Dir(state.Public)
+}
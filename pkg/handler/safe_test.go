@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSafeModeProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("upstream"))
+	}))
+	defer upstream.Close()
+
+	public := writeFiles(t, map[string]string{
+		"api/status": "static",
+	})
+	config := Configuration{
+		Public: public,
+		Proxy:  []ConfigProxy{{Source: "/api/*", Destination: upstream.URL + "/"}},
+	}
+
+	w := doRequest(newTestRouter(config), "GET", "/api/status", nil)
+	assert.Equal(t, "upstream", w.Body.String())
+
+	config.SafeMode = true
+	router := newTestRouter(config)
+	w = doRequest(router, "GET", "/api/status", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "static", w.Body.String())
+	w = doRequest(router, "GET", "/api/other", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSafeModeSymlinks(t *testing.T) {
+	outside := writeFiles(t, map[string]string{
+		"secret.txt": "secret",
+	})
+	public := writeFiles(t, map[string]string{
+		"index.html": "index",
+	})
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(public, "secret.txt")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(public, "outside")); err != nil {
+		t.Fatal(err)
+	}
+	config := Configuration{Public: public, Symlinks: true}
+
+	router := newTestRouter(config)
+	w := doRequest(router, "GET", "/secret.txt", nil)
+	assert.Equal(t, "secret", w.Body.String())
+
+	config.SafeMode = true
+	assert.False(t, newTestHandler(config).Symlinks)
+
+	router = newTestRouter(config)
+	w = doRequest(router, "GET", "/secret.txt", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(router, "GET", "/outside/secret.txt", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(router, "GET", "/", nil)
+	assert.Equal(t, "index", w.Body.String())
+}
+
+func TestSymlinks(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html":       "index",
+		"docs/target.txt":  "target",
+		"other/nested.txt": "nested",
+	})
+	links := map[string]string{
+		"absolute.txt":      filepath.Join(public, "docs", "target.txt"),
+		"relative.txt":      "docs/target.txt",
+		"docs/sibling.txt":  "target.txt",
+		"docs/parent.txt":   "../other/nested.txt",
+		"docs/dangling.txt": "missing.txt",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(public, name)); err != nil {
+			t.Skip("symlinks not supported:", err)
+		}
+	}
+	expected := map[string]string{
+		"/absolute.txt":     "target",
+		"/relative.txt":     "target",
+		"/docs/sibling.txt": "target",
+		"/docs/parent.txt":  "nested",
+	}
+
+	config, err := ReadServeConfiguration(strings.NewReader(`{"symlinks": true}`))
+	assert.Nil(t, err)
+	assert.True(t, config.Symlinks)
+	config.Public = public
+
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		for target, body := range expected {
+			w := doRequest(handler, "GET", target, nil)
+			assert.Equal(t, http.StatusOK, w.Code, target)
+			assert.Equal(t, body, w.Body.String(), target)
+		}
+		w := doRequest(handler, "GET", "/docs/dangling.txt", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	}
+
+	config.Symlinks = false
+	for _, handler := range []http.Handler{newTestRouter(config), newTestHandler(config)} {
+		for target := range expected {
+			w := doRequest(handler, "GET", target, nil)
+			assert.Equal(t, http.StatusNotFound, w.Code, target)
+		}
+		w := doRequest(handler, "GET", "/docs/target.txt", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelfSignedCertificate(t *testing.T) {
+	cert, err := SelfSignedCertificate([]string{"dev.test", "0.0.0.0", "localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"localhost", "dev.test"}, leaf.DNSNames)
+	assert.Len(t, leaf.IPAddresses, 2)
+	for _, host := range []string{"localhost", "dev.test", "127.0.0.1", "::1"} {
+		assert.NoError(t, leaf.VerifyHostname(host), host)
+	}
+	assert.Error(t, leaf.VerifyHostname("example.com"))
+
+	servers := []*http.Server{{Addr: "127.0.0.1:0"}, {Addr: ":8080"}}
+	assert.Equal(t, []string{"127.0.0.1"}, ListenHosts(servers))
+
+	// A client trusting the certificate gets a response over HTTPS
+	config := Configuration{Public: writeFiles(t, map[string]string{"index.html": "secure"})}
+	server := newTestServer(t, config, "127.0.0.1:0", newTestRouter(config))
+	UseCertificate(server, cert)
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeTLS(listener, "", "")
+	t.Cleanup(func() { server.Close() })
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err := client.Get("https://" + listener.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "secure", string(body))
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ListenAddress turns a --listen endpoint into a server address, a bare
+// port listens on all interfaces and a tcp:// prefix is dropped.
+func ListenAddress(endpoint string) string {
+	endpoint = strings.TrimPrefix(endpoint, "tcp://")
+	if !strings.Contains(endpoint, ":") {
+		return ":" + endpoint
+	}
+
+	return endpoint
+}
+
+// ListenAll binds the address of every server up front, so that a port
+// already in use stops the start up instead of taking the other servers
+// down once they serve. Nothing stays bound on failure.
+func ListenAll(servers []*http.Server) (map[*http.Server]net.Listener, error) {
+	listeners := map[*http.Server]net.Listener{}
+	for _, server := range servers {
+		listener, err := net.Listen("tcp", server.Addr)
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+			return nil, fmt.Errorf("unable to listen on %s: %w", server.Addr, err)
+		}
+		listeners[server] = listener
+	}
+
+	return listeners, nil
+}
+
+// NewServer creates the http.Server listening on addr with the server level
+// settings from the configuration applied.
+func NewServer(config Configuration, addr string, handler http.Handler) (*http.Server, error) {
+	server := &http.Server{
+		Addr:    addr,
+		Handler: handler,
+	}
+	server.SetKeepAlivesEnabled(!config.NoKeepAlive)
+	routeGeneralOptions(server)
+
+	if config.Ssl.ClientCaFile != "" {
+		tlsConfig, err := clientAuthConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		server.TLSConfig = tlsConfig
+	}
+
+	return server, nil
+}
+
+// clientAuthConfig verifies client certificates against the configured CA,
+// clients without a certificate are only accepted when it isn't required.
+func clientAuthConfig(config Configuration) (*tls.Config, error) {
+	data, err := os.ReadFile(config.Ssl.ClientCaFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssl.clientCaFile: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("invalid ssl.clientCaFile: no certificates found in %s", config.Ssl.ClientCaFile)
+	}
+
+	clientAuth := tls.VerifyClientCertIfGiven
+	if config.Ssl.RequireClientCert {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: clientAuth,
+	}, nil
+}
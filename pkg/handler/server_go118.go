@@ -0,0 +1,9 @@
+//go:build !go1.20
+
+package handler
+
+import "net/http"
+
+// routeGeneralOptions can't be done before Go 1.20, net/http answers
+// "OPTIONS *" itself.
+func routeGeneralOptions(server *http.Server) {}
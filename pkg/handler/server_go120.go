@@ -0,0 +1,11 @@
+//go:build go1.20
+
+package handler
+
+import "net/http"
+
+// routeGeneralOptions lets "OPTIONS *" reach the handler instead of the
+// built-in net/http answer, which doesn't list the allowed methods.
+func routeGeneralOptions(server *http.Server) {
+	server.DisableGeneralOptionsHandler = true
+}
@@ -0,0 +1,301 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(t *testing.T, config Configuration, addr string, handler http.Handler) *http.Server {
+	server, err := NewServer(config, addr, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return server
+}
+
+func serveOnce(t *testing.T, config Configuration) *http.Response {
+	router := newTestRouter(config)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t, config, listener.Addr().String(), router)
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	return resp
+}
+
+func TestServerKeepAlive(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html": "index",
+	})
+
+	resp := serveOnce(t, Configuration{Public: public})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.False(t, resp.Close)
+
+	resp = serveOnce(t, Configuration{Public: public, NoKeepAlive: true})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, resp.Close)
+}
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert creates a certificate signed by parent, self-signed when parent is nil
+func newTestCert(t *testing.T, parent *testCert, template *x509.Certificate) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCert{cert: cert, key: key}
+}
+
+func newTestCA(t *testing.T, name string) *testCert {
+	return newTestCert(t, nil, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+}
+
+func (c *testCert) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+}
+
+func (c *testCert) keyPem(t *testing.T) []byte {
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func (c *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair(c.pem(), c.keyPem(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestServerClientCertificates(t *testing.T) {
+	ca := newTestCA(t, "swerver test CA")
+	other := newTestCA(t, "other CA")
+	serverCert := newTestCert(t, ca, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	clientTemplate := func() *x509.Certificate {
+		return &x509.Certificate{
+			Subject:     pkix.Name{CommonName: "client"},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+	}
+	trusted := newTestCert(t, ca, clientTemplate())
+	untrusted := newTestCert(t, other, clientTemplate())
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"ca.pem":     ca.pem(),
+		"server.pem": serverCert.pem(),
+		"server.key": serverCert.keyPem(t),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := Configuration{
+		Public: writeFiles(t, map[string]string{"index.html": "index"}),
+	}
+	config.Ssl.CertFile = filepath.Join(dir, "server.pem")
+	config.Ssl.KeyFile = filepath.Join(dir, "server.key")
+	config.Ssl.ClientCaFile = filepath.Join(dir, "ca.pem")
+	config.Ssl.RequireClientCert = true
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t, config, listener.Addr().String(), newTestRouter(config))
+	go server.ServeTLS(listener, config.Ssl.CertFile, config.Ssl.KeyFile)
+	t.Cleanup(func() { server.Close() })
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(certificates []tls.Certificate) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certificates},
+		}}
+		resp, err := client.Get("https://" + listener.Addr().String() + "/")
+		if err == nil {
+			resp.Body.Close()
+		}
+		return resp, err
+	}
+
+	resp, err := get([]tls.Certificate{trusted.tlsCertificate(t)})
+	assert.Nil(t, err)
+	if err == nil {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	_, err = get([]tls.Certificate{untrusted.tlsCertificate(t)})
+	assert.NotNil(t, err)
+
+	_, err = get(nil)
+	assert.NotNil(t, err)
+}
+
+func TestClientCaFileInvalid(t *testing.T) {
+	dir := t.TempDir()
+	config := Configuration{Public: dir}
+	router := newTestRouter(config)
+
+	config.Ssl.ClientCaFile = filepath.Join(dir, "missing.pem")
+	_, err := NewServer(config, "127.0.0.1:0", router)
+	assert.Error(t, err)
+
+	config.Ssl.ClientCaFile = filepath.Join(dir, "empty.pem")
+	assert.NoError(t, os.WriteFile(config.Ssl.ClientCaFile, []byte("not a certificate"), 0o644))
+	_, err = NewServer(config, "127.0.0.1:0", router)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "no certificates found")
+	}
+}
+
+func TestServerOptionsAsterisk(t *testing.T) {
+	config := Configuration{Public: writeFiles(t, map[string]string{"index.html": "index"})}
+
+	w := doRequest(newTestRouter(config), "OPTIONS", "*", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS", w.Header().Get("Allow"))
+	assert.Empty(t, w.Body.String())
+
+	config.AllowUploads = true
+	w = doRequest(newTestRouter(config), "OPTIONS", "*", nil)
+	assert.Equal(t, "GET, HEAD, OPTIONS, PUT, DELETE", w.Header().Get("Allow"))
+
+	// The request has to make it past net/http to the handler
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t, config, listener.Addr().String(), newTestRouter(config))
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("OPTIONS * HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "GET, HEAD, OPTIONS, PUT, DELETE", resp.Header.Get("Allow"))
+}
+
+func TestListenAddress(t *testing.T) {
+	assert.Equal(t, ":5000", ListenAddress("5000"))
+	assert.Equal(t, "127.0.0.1:8080", ListenAddress("127.0.0.1:8080"))
+	assert.Equal(t, "localhost:8080", ListenAddress("tcp://localhost:8080"))
+	assert.Equal(t, "[::1]:8080", ListenAddress("[::1]:8080"))
+}
+
+func TestListenAll(t *testing.T) {
+	config := Configuration{Public: writeFiles(t, map[string]string{"index.html": "hello"})}
+	router := newTestRouter(config)
+	servers := []*http.Server{
+		newTestServer(t, config, "127.0.0.1:0", router),
+		newTestServer(t, config, "127.0.0.1:0", router),
+	}
+
+	listeners, err := ListenAll(servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- RunServers(ctx, servers, func(s *http.Server) error {
+			return s.Serve(listeners[s])
+		}, time.Second)
+	}()
+
+	// Every listener answers
+	for _, server := range servers {
+		resp, err := http.Get("http://" + listeners[server].Addr().String() + "/index.html")
+		if assert.NoError(t, err) {
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+	}
+	cancel()
+	assert.Nil(t, <-done)
+
+	// A taken address releases the ones bound before it
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+	first := &http.Server{Addr: "127.0.0.1:0"}
+	_, err = ListenAll([]*http.Server{first, {Addr: taken.Addr().String()}})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), taken.Addr().String())
+	}
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Time given to in-flight requests to finish once shutdown was requested
+const defaultShutdownTimeout = 30 * time.Second
+
+// ShutdownTimeout is how long a graceful shutdown waits for the requests in
+// flight, the shutdownTimeout setting or 30 seconds by default.
+func ShutdownTimeout(config Configuration) (time.Duration, error) {
+	timeout, err := parseTimeout("shutdownTimeout", config.ShutdownTimeout)
+	if err != nil || timeout != 0 {
+		return timeout, err
+	}
+
+	return defaultShutdownTimeout, nil
+}
+
+// RunServers starts every server with start and blocks until one of them
+// fails or ctx is done. All the servers are then shut down together, the
+// requests in flight get timeout to complete before their connections
+// are closed.
+func RunServers(ctx context.Context, servers []*http.Server, start func(*http.Server) error, timeout time.Duration) error {
+	failed := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) {
+			if err := start(server); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				failed <- err
+			}
+		}(server)
+	}
+
+	var result error
+	select {
+	case result = <-failed:
+	case <-ctx.Done():
+		log.Printf("Shutting down, waiting up to %s for requests in flight", timeout)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				log.Printf("Requests on %s didn't finish in time: %v", server.Addr, err)
+				server.Close()
+			}
+		}(server)
+	}
+	wg.Wait()
+
+	return result
+}
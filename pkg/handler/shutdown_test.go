@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunServersShutdown(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(" second"))
+	})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- RunServers(ctx, []*http.Server{server}, func(s *http.Server) error {
+			return s.Serve(listener)
+		}, time.Second)
+	}()
+
+	body := make(chan string)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		body <- string(data)
+	}()
+
+	<-started
+	cancel()
+
+	// The request in flight completes before the server is gone
+	assert.Equal(t, "first second", <-body)
+	assert.Nil(t, <-done)
+
+	_, err = http.Get("http://" + listener.Addr().String())
+	assert.NotNil(t, err)
+}
+
+func TestRunServersFailure(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// The address is taken, so the second server fails to start
+	servers := []*http.Server{
+		{Addr: listener.Addr().String()},
+		{Addr: "127.0.0.1:0"},
+	}
+	err = RunServers(context.Background(), servers, func(s *http.Server) error {
+		return s.ListenAndServe()
+	}, time.Second)
+	assert.NotNil(t, err)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	timeout, err := ShutdownTimeout(Configuration{})
+	assert.Nil(t, err)
+	assert.True(t, timeout == 30*time.Second)
+	timeout, err = ShutdownTimeout(Configuration{ShutdownTimeout: "5s"})
+	assert.Nil(t, err)
+	assert.True(t, timeout == 5*time.Second)
+	_, err = ShutdownTimeout(Configuration{ShutdownTimeout: "5 seconds"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/koblas/swerver/pkg/minimatch"
+	pathToRegExp "github.com/koblas/swerver/pkg/path_to_regexp"
+)
+
+// Compiled sources kept at most, sources come from the configuration so
+// the limit only matters when it is reloaded many times
+const maxCompiledSources = 10000
+
+// compiledSource holds the matchers of a source, either can be nil when it
+// doesn't compile
+type compiledSource struct {
+	// Only compiled when segments are allowed
+	segments pathToRegExp.PathMatcher
+	glob     minimatch.Minimatch
+}
+
+type sourceKey struct {
+	source        string
+	allowSegments bool
+}
+
+var (
+	compiledSourcesMu sync.RWMutex
+	compiledSources   = map[sourceKey]compiledSource{}
+)
+
+// compileSource returns the matchers of the slashed source, compiling them
+// on first use
+func compileSource(slashed string, allowSegments bool) compiledSource {
+	key := sourceKey{slashed, allowSegments}
+
+	compiledSourcesMu.RLock()
+	compiled, found := compiledSources[key]
+	compiledSourcesMu.RUnlock()
+	if found {
+		return compiled
+	}
+
+	if allowSegments {
+		normalized := strings.Replace(slashed, "*", "(.*)", -1)
+		if matcher, err := pathToRegExp.PathToRegexp(normalized, pathToRegExp.NewOptions()); err == nil {
+			compiled.segments = matcher
+		}
+	}
+	if matcher, err := minimatch.NewMinimatch(slashed, minimatch.Options{}); err == nil {
+		compiled.glob = matcher
+	}
+
+	compiledSourcesMu.Lock()
+	if len(compiledSources) < maxCompiledSources {
+		compiledSources[key] = compiled
+	}
+	compiledSourcesMu.Unlock()
+
+	return compiled
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceMatchesCached(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				ok, keys, results := sourceMatches("/blog/:slug", "/blog/hello", true)
+				assert.True(t, ok)
+				if assert.Equal(t, 1, len(keys)) {
+					assert.Equal(t, "slug", keys[0].Name)
+				}
+				assert.Equal(t, []string{"/blog/hello", "hello"}, results)
+
+				ok, _, _ = sourceMatches("/blog/:slug", "/about", true)
+				assert.False(t, ok)
+				ok, _, _ = sourceMatches("/**/*.js", "/a/b.js", false)
+				assert.True(t, ok)
+				ok, _, _ = sourceMatches("/**/*.js", "/a/b.css", false)
+				assert.False(t, ok)
+			}
+		}()
+	}
+	wg.Wait()
+
+	compiledSourcesMu.RLock()
+	_, found := compiledSources[sourceKey{"/blog/:slug", true}]
+	compiledSourcesMu.RUnlock()
+	assert.True(t, found)
+}
+
+// tenRules is a configuration where every request goes through ten
+// sources of each kind
+func tenRules(public string) Configuration {
+	config := Configuration{Public: public}
+	for i := 0; i < 10; i++ {
+		config.Redirects = append(config.Redirects, ConfigRedirect{
+			Source:      fmt.Sprintf("/old-%d/:slug", i),
+			Destination: fmt.Sprintf("/new-%d/:slug", i),
+		})
+		config.Rewrites = append(config.Rewrites, ConfigRewrite{
+			Source:      fmt.Sprintf("/app-%d/**", i),
+			Destination: "/index.html",
+		})
+		config.Unlisted = append(config.Unlisted, fmt.Sprintf("secret-%d", i))
+	}
+
+	return config
+}
+
+func BenchmarkSourceMatches(b *testing.B) {
+	public := b.TempDir()
+	handler := newTestHandler(tenRules(public))
+
+	run := func(b *testing.B, reset bool) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if reset {
+				compiledSourcesMu.Lock()
+				compiledSources = map[sourceKey]compiledSource{}
+				compiledSourcesMu.Unlock()
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", "/missing", nil))
+		}
+	}
+
+	// Compiling every source on each request, as without the cache
+	b.Run("compiling", func(b *testing.B) { run(b, true) })
+	b.Run("cached", func(b *testing.B) { run(b, false) })
+}
@@ -2,7 +2,10 @@ package handler
 
 import (
 	_ "embed"
+	"fmt"
 	"text/template"
+
+	"github.com/koblas/swerver/pkg/swhttp"
 )
 
 //go:embed error.html
@@ -11,5 +14,20 @@ var errorHtml string
 //go:embed directory.html
 var directoryHtml string
 
-var errorTemplate = template.Must(template.New("error").Parse(errorHtml))
+var errorTemplate = template.Must(template.New("error").Funcs(template.FuncMap{"escapePath": swhttp.EscapePath}).Parse(errorHtml))
 var directoryTemplate = template.Must(template.New("directory").Parse(directoryHtml))
+
+// loadDirectoryThemes parses the configured directory listing templates
+func loadDirectoryThemes(themes map[string]string) (map[string]*template.Template, error) {
+	result := map[string]*template.Template{}
+
+	for name, file := range themes {
+		tmpl, err := template.ParseFiles(file)
+		if err != nil {
+			return nil, fmt.Errorf("invalid directory theme %s: %v", name, err)
+		}
+		result[name] = tmpl
+	}
+
+	return result, nil
+}
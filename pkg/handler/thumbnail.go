@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/koblas/swerver/pkg/swhttp"
+	"github.com/koblas/swerver/pkg/trace"
+)
+
+// Prefix of the thumbnails of images when thumbnails are enabled
+const thumbnailPath = "/__thumb"
+
+// newThumbnailer checks the thumbnail configuration, nil when thumbnails
+// are disabled
+func newThumbnailer(config Configuration) (*swhttp.Thumbnailer, error) {
+	if !config.Thumbnails {
+		return nil, nil
+	}
+	if config.ThumbnailSize < 0 || config.ThumbnailSize > swhttp.MaxThumbnailSize {
+		return nil, fmt.Errorf("invalid thumbnailSize: %d, at most %d", config.ThumbnailSize, swhttp.MaxThumbnailSize)
+	}
+
+	return swhttp.NewThumbnailer(thumbnailPath, config.ThumbnailSize), nil
+}
+
+// serveThumbnail answers /__thumb/<path> with the thumbnail of the image
+// at path, anything that isn't an image gets a 404
+func (state HandlerState) serveThumbnail(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, thumbnailPath)
+
+	err := state.thumbnails.Serve(w, r, state.root(), name)
+	switch {
+	case err == nil:
+		trace.Add(r, "thumbnail %s", name)
+	case errors.Is(err, swhttp.ErrNoThumbnail) || errors.Is(err, fs.ErrNotExist):
+		state.sendError(w, r, "/", http.StatusNotFound)
+	case errors.Is(err, swhttp.ErrImageTooLarge):
+		trace.Add(r, "%v", err)
+		state.sendError(w, r, "/", http.StatusRequestEntityTooLarge)
+	default:
+		state.sendStatError(w, r, err)
+	}
+}
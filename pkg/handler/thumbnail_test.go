@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeImage(t *testing.T, width, height int, format string) string {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+
+	buf := bytes.Buffer{}
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, img, nil)
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.String()
+}
+
+func TestThumbnails(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"gallery/wide.png":  encodeImage(t, 400, 200, "png"),
+		"gallery/photo.jpg": encodeImage(t, 100, 300, "jpeg"),
+		"gallery/small.png": encodeImage(t, 20, 10, "png"),
+		"gallery/notes.txt": "notes",
+		"gallery/fake.png":  "not an image",
+	})
+	config := Configuration{Public: public, Thumbnails: true}
+
+	router := newTestRouter(config)
+	w := doRequest(router, "GET", "/gallery/", map[string]string{"Accept": "application/json"})
+	var listing struct {
+		Files []struct {
+			Name      string `json:"name"`
+			Thumbnail string `json:"thumbnail"`
+		} `json:"files"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &listing))
+	thumbnails := map[string]string{}
+	for _, file := range listing.Files {
+		thumbnails[file.Name] = file.Thumbnail
+	}
+	assert.Equal(t, "/__thumb/gallery/wide.png", thumbnails["wide.png"])
+	assert.Equal(t, "/__thumb/gallery/photo.jpg", thumbnails["photo.jpg"])
+	assert.Equal(t, "", thumbnails["notes.txt"])
+
+	w = doRequest(router, "GET", "/gallery/", nil)
+	assert.Contains(t, w.Body.String(), `src="/__thumb/gallery/wide.png"`)
+
+	for name, expected := range map[string]image.Point{
+		"wide.png":  {200, 100},
+		"photo.jpg": {66, 200},
+		"small.png": {20, 10},
+	} {
+		// The second time comes from the cache
+		for i := 0; i < 2; i++ {
+			w = doRequest(router, "GET", "/__thumb/gallery/"+name, nil)
+			assert.Equal(t, http.StatusOK, w.Code, name)
+			config, format, err := image.DecodeConfig(bytes.NewReader(w.Body.Bytes()))
+			assert.Nil(t, err, name)
+			assert.Equal(t, expected, image.Point{config.Width, config.Height}, name)
+			assert.Equal(t, "image/"+format, w.Header().Get("Content-Type"), name)
+		}
+	}
+
+	for _, target := range []string{"/__thumb/gallery/notes.txt", "/__thumb/gallery/fake.png", "/__thumb/gallery/missing.png", "/__thumb/../secret.png"} {
+		w = doRequest(router, "GET", target, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code, target)
+	}
+
+	config.ThumbnailSize = 50
+	w = doRequest(newTestRouter(config), "GET", "/__thumb/gallery/wide.png", nil)
+	img, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, image.Rect(0, 0, 50, 25), img.Bounds())
+
+	config.Thumbnails = false
+	w = doRequest(newTestRouter(config), "GET", "/__thumb/gallery/wide.png", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(newTestRouter(config), "GET", "/gallery/", map[string]string{"Accept": "application/json"})
+	assert.NotContains(t, w.Body.String(), "thumbnail")
+}
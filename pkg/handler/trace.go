@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/koblas/swerver/pkg/trace"
+)
+
+// Response header carrying the routing decisions for a traced request
+const traceHeader = "X-Swerver-Trace"
+
+// traceMiddleware attaches a trace to the request and reports it in the
+// X-Swerver-Trace response header. When a trace secret is configured only
+// requests with a matching ?__trace= parameter are traced.
+func (state HandlerState) traceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if state.TraceSecret != "" && r.URL.Query().Get("__trace") != state.TraceSecret {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		t := &trace.Trace{}
+		t.Add("request %s %s", r.Method, r.URL.Path)
+
+		hook := &hookWriter{
+			ResponseWriter: w,
+			before: func(w http.ResponseWriter, status int) {
+				t.Add("status %d", status)
+				w.Header().Set(traceHeader, t.String())
+				state.logger.Debug("Trace", fmt.Sprintf("%q", t.String()))
+			},
+		}
+
+		next.ServeHTTP(hook, r.WithContext(trace.NewContext(r.Context(), t)))
+	})
+}
+
+// tracePath is name relative to the public directory, traces never show
+// where the files live on the server
+func (state HandlerState) tracePath(name string) string {
+	rel, err := filepath.Rel(state.Public, name)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "(outside public)"
+	}
+	if rel == "." {
+		return "/"
+	}
+
+	return "/" + filepath.ToSlash(rel)
+}
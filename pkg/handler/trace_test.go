@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceRewrite(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html": "<h1>hello</h1>",
+	})
+	state := newTestHandler(Configuration{
+		Public:   public,
+		Trace:    true,
+		Rewrites: []ConfigRewrite{{Source: "/app/**", Destination: "/index.html"}},
+	})
+
+	w := doRequest(state.traceMiddleware(state), "GET", "/app/settings", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t,
+		"request GET /app/settings; rewrite /app/settings -> /index.html; related /index.html; serve /index.html; status 200",
+		w.Header().Get("X-Swerver-Trace"))
+	assert.NotContains(t, w.Header().Get("X-Swerver-Trace"), public)
+
+	router := newTestRouter(Configuration{
+		Public:   public,
+		Trace:    true,
+		Rewrites: []ConfigRewrite{{Source: "/app/**", Destination: "/index.html"}},
+	})
+	w = doRequest(router, "GET", "/app/settings", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Header().Get("X-Swerver-Trace"), public)
+}
+
+func TestTracePath(t *testing.T) {
+	public := t.TempDir()
+	state := HandlerState{Configuration: Configuration{Public: public}}
+
+	assert.Equal(t, "/", state.tracePath(public))
+	assert.Equal(t, "/docs/a.html", state.tracePath(filepath.Join(public, "docs", "a.html")))
+	assert.Equal(t, "(outside public)", state.tracePath(filepath.Join(public, "..", "secret")))
+}
+
+func TestTraceStatic(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"docs/index.html": "<h1>docs</h1>",
+	})
+
+	router := newTestRouter(Configuration{Public: public, Trace: true})
+	w := doRequest(router, "GET", "/docs/", nil)
+	assert.Equal(t, "request GET /docs/; static /*; index /docs/index.html; status 200", w.Header().Get("X-Swerver-Trace"))
+
+	router = newTestRouter(Configuration{Public: public})
+	w = doRequest(router, "GET", "/docs/", nil)
+	assert.Empty(t, w.Header().Get("X-Swerver-Trace"))
+}
+
+func TestTraceSecret(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html": "<h1>hello</h1>",
+	})
+	router := newTestRouter(Configuration{Public: public, Trace: true, TraceSecret: "s3cret"})
+
+	w := doRequest(router, "GET", "/", nil)
+	assert.Empty(t, w.Header().Get("X-Swerver-Trace"))
+
+	w = doRequest(router, "GET", "/?__trace=wrong", nil)
+	assert.Empty(t, w.Header().Get("X-Swerver-Trace"))
+
+	w = doRequest(router, "GET", "/?__trace=s3cret", nil)
+	assert.Contains(t, w.Header().Get("X-Swerver-Trace"), "request GET /")
+}
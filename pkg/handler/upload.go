@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/koblas/swerver/pkg/swhttp"
+	"github.com/koblas/swerver/pkg/trace"
+)
+
+// Upload size limit used when maxUploadSize isn't configured
+const defaultMaxUploadSize = 32 * 1024 * 1024
+
+// writeTarget resolves the file a PUT or DELETE request works on, returning
+// the error status when the request isn't allowed.
+func (state HandlerState) writeTarget(r *http.Request) (string, int) {
+	if !state.writeAuthorized(r) {
+		return "", http.StatusUnauthorized
+	}
+
+	name := r.URL.Path
+	target := filepath.Join(state.Public, filepath.FromSlash(name))
+	if strings.HasSuffix(name, "/") || target == filepath.Clean(state.Public) || !pathIsInside(target, state.Public) {
+		return "", http.StatusBadRequest
+	}
+	if !applicable(name, state.UploadPaths, false) {
+		return "", http.StatusForbidden
+	}
+
+	// Refuse to write through a symlinked directory that leads elsewhere
+	if !state.Symlinks {
+		for dir := filepath.Dir(target); pathIsInside(dir, state.Public) && dir != filepath.Clean(state.Public); dir = filepath.Dir(dir) {
+			if info, err := os.Lstat(dir); err == nil && info.Mode()&os.ModeSymlink != 0 {
+				return "", http.StatusForbidden
+			}
+		}
+	}
+
+	return target, 0
+}
+
+// writeAuthorized checks the uploadToken of a request, any request is
+// authorized when there is none
+func (state HandlerState) writeAuthorized(r *http.Request) bool {
+	if state.UploadToken == "" {
+		return true
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(state.UploadToken)) == 1
+}
+
+// writeAllowed checks the conditional headers of a PUT or DELETE against
+// the file as found by a stat returning info and err
+func (state HandlerState) writeAllowed(r *http.Request, info os.FileInfo, err error) bool {
+	exists := err == nil
+	modtime := time.Time{}
+	if exists {
+		modtime = info.ModTime()
+	}
+
+	if !swhttp.CheckWritePreconditions(r, exists, modtime) {
+		trace.Add(r, "precondition failed")
+		return false
+	}
+
+	return true
+}
+
+// uploadFile stores the request body below public, the file is written to a
+// temporary name first so readers never see a partial upload.
+func (state HandlerState) uploadFile(w http.ResponseWriter, r *http.Request) {
+	target, status := state.writeTarget(r)
+	if status != 0 {
+		trace.Add(r, "upload rejected %d", status)
+		if status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		}
+		state.sendError(w, r, "/", status)
+		return
+	}
+
+	limit := state.MaxUploadSize
+	if limit <= 0 {
+		limit = defaultMaxUploadSize
+	}
+	if r.ContentLength > limit {
+		state.sendError(w, r, "/", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	info, err := os.Stat(target)
+	if err == nil && info.IsDir() {
+		state.sendError(w, r, "/", http.StatusConflict)
+		return
+	}
+	existed := err == nil
+	if !state.writeAllowed(r, info, err) {
+		state.sendError(w, r, "/", http.StatusPreconditionFailed)
+		return
+	}
+
+	dir := filepath.Dir(target)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("Unable to create %s: %v", dir, err)
+		state.sendError(w, r, "/", http.StatusInternalServerError)
+		return
+	}
+
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		log.Printf("Unable to upload %s: %v", r.URL.Path, err)
+		state.sendError(w, r, "/", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, io.LimitReader(r.Body, limit+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Printf("Unable to upload %s: %v", r.URL.Path, err)
+		state.sendError(w, r, "/", http.StatusInternalServerError)
+		return
+	}
+	if size > limit {
+		state.sendError(w, r, "/", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if err := os.Chmod(tmp.Name(), 0o644); err == nil {
+		err = os.Rename(tmp.Name(), target)
+	}
+	if err != nil {
+		log.Printf("Unable to upload %s: %v", r.URL.Path, err)
+		state.sendError(w, r, "/", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Uploaded %s (%d bytes)", r.URL.Path, size)
+	trace.Add(r, "upload %s", r.URL.Path)
+
+	if existed {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// deleteFile removes a single file below public, directories are refused
+func (state HandlerState) deleteFile(w http.ResponseWriter, r *http.Request) {
+	target, status := state.writeTarget(r)
+	if status != 0 {
+		trace.Add(r, "delete rejected %d", status)
+		if status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		}
+		state.sendError(w, r, "/", status)
+		return
+	}
+
+	info, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		state.sendError(w, r, "/", http.StatusNotFound)
+		return
+	}
+	if err == nil && info.IsDir() {
+		state.sendError(w, r, "/", http.StatusConflict)
+		return
+	}
+	if !state.writeAllowed(r, info, err) {
+		state.sendError(w, r, "/", http.StatusPreconditionFailed)
+		return
+	}
+	if err == nil {
+		err = os.Remove(target)
+	}
+	if err != nil {
+		log.Printf("Unable to delete %s: %v", r.URL.Path, err)
+		state.sendError(w, r, "/", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Deleted %s", r.URL.Path)
+	trace.Add(r, "delete %s", r.URL.Path)
+
+	w.WriteHeader(http.StatusNoContent)
+}
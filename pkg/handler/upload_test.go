@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func doUpload(handler http.Handler, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("PUT", target, strings.NewReader(body))
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestUpload(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html": "index",
+	})
+	router := newTestRouter(Configuration{Public: public, AllowUploads: true})
+
+	w := doUpload(router, "/drop/notes.txt", "first", nil)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	data, err := os.ReadFile(filepath.Join(public, "drop", "notes.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "first", string(data))
+
+	w = doUpload(router, "/drop/notes.txt", "second", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = doRequest(router, "GET", "/drop/notes.txt", nil)
+	assert.Equal(t, "second", w.Body.String())
+
+	entries, _ := os.ReadDir(filepath.Join(public, "drop"))
+	assert.Equal(t, 1, len(entries))
+
+	w = doUpload(router, "/drop", "dir", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestUploadRejected(t *testing.T) {
+	parent := t.TempDir()
+	public := filepath.Join(parent, "public")
+	if err := os.Mkdir(public, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	w := doUpload(newTestRouter(Configuration{Public: public}), "/notes.txt", "data", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	router := newTestRouter(Configuration{
+		Public:        public,
+		AllowUploads:  true,
+		UploadPaths:   []string{"/uploads/**"},
+		MaxUploadSize: 8,
+		UploadToken:   "s3cret",
+	})
+	auth := map[string]string{"Authorization": "Bearer s3cret"}
+
+	w = doUpload(router, "/uploads/a.txt", "data", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = doUpload(router, "/uploads/a.txt", "data", map[string]string{"Authorization": "Bearer wrong"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = doUpload(router, "/uploads/../../escape.txt", "data", auth)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	_, err := os.Stat(filepath.Join(parent, "escape.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	w = doUpload(router, "/other/a.txt", "data", auth)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doUpload(router, "/uploads/big.txt", "123456789", auth)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	_, err = os.Stat(filepath.Join(public, "uploads", "big.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Without a Content-Length the limit applies while reading
+	req := httptest.NewRequest("PUT", "/uploads/big.txt", strings.NewReader("123456789"))
+	req.ContentLength = -1
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	entries, _ := os.ReadDir(filepath.Join(public, "uploads"))
+	assert.Equal(t, 0, len(entries))
+
+	w = doUpload(router, "/uploads/a.txt", "data", auth)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = doUpload(newTestRouter(Configuration{Public: public, AllowUploads: true, SafeMode: true}), "/notes.txt", "data", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestDelete(t *testing.T) {
+	parent := t.TempDir()
+	public := filepath.Join(parent, "public")
+	if err := os.MkdirAll(filepath.Join(public, "uploads", "dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"uploads/a.txt", "index.html"} {
+		if err := os.WriteFile(filepath.Join(public, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(parent, "outside.txt"), []byte("outside"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := doRequest(newTestRouter(Configuration{Public: public}), "DELETE", "/uploads/a.txt", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	router := newTestRouter(Configuration{
+		Public:       public,
+		AllowUploads: true,
+		UploadPaths:  []string{"/uploads/**"},
+		UploadToken:  "s3cret",
+	})
+	auth := map[string]string{"Authorization": "Bearer s3cret"}
+
+	w = doRequest(router, "DELETE", "/uploads/a.txt", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = doRequest(router, "DELETE", "/uploads/a.txt", auth)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	_, err := os.Stat(filepath.Join(public, "uploads", "a.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	w = doRequest(router, "DELETE", "/uploads/a.txt", auth)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doRequest(router, "DELETE", "/uploads/dir", auth)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = doRequest(router, "DELETE", "/index.html", auth)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doRequest(router, "DELETE", "/uploads/../../outside.txt", auth)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	_, err = os.Stat(filepath.Join(parent, "outside.txt"))
+	assert.Nil(t, err)
+}
+
+func TestConditionalUpload(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"notes.txt": "first",
+	})
+	modified := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(public, "notes.txt"), modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	router := newTestRouter(Configuration{Public: public, AllowUploads: true})
+
+	stale := map[string]string{"If-Unmodified-Since": modified.Add(-time.Hour).Format(http.TimeFormat)}
+	w := doUpload(router, "/notes.txt", "second", stale)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = doRequest(router, "DELETE", "/notes.txt", stale)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	data, _ := os.ReadFile(filepath.Join(public, "notes.txt"))
+	assert.Equal(t, "first", string(data))
+
+	current := map[string]string{"If-Unmodified-Since": modified.Format(http.TimeFormat)}
+	w = doUpload(router, "/notes.txt", "second", current)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	data, _ = os.ReadFile(filepath.Join(public, "notes.txt"))
+	assert.Equal(t, "second", string(data))
+
+	// Create only when the file doesn't exist yet
+	w = doUpload(router, "/notes.txt", "third", map[string]string{"If-None-Match": "*"})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = doUpload(router, "/other.txt", "other", map[string]string{"If-None-Match": "*"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// Replace only an existing file
+	w = doUpload(router, "/missing.txt", "data", map[string]string{"If-Match": "*"})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = doRequest(router, "DELETE", "/notes.txt", map[string]string{"If-Match": "*"})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+// watchedBody records whether the client sent the request body
+type watchedBody struct {
+	io.Reader
+	read bool
+}
+
+func (b *watchedBody) Read(p []byte) (int, error) {
+	b.read = true
+	return b.Reader.Read(p)
+}
+
+// expectContinue sends a PUT with Expect: 100-continue from a client that
+// waits for the 100 Continue before sending the body
+func expectContinue(t *testing.T, url, body string, headers map[string]string) (*http.Response, bool) {
+	watched := &watchedBody{Reader: strings.NewReader(body)}
+	req, err := http.NewRequest("PUT", url, watched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Expect", "100-continue")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	client := &http.Client{Transport: &http.Transport{ExpectContinueTimeout: time.Minute}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	return resp, watched.read
+}
+
+func TestUploadExpectContinue(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"index.html": "index",
+	})
+	server := httptest.NewServer(newTestRouter(Configuration{Public: public, AllowUploads: true, UploadToken: "secret"}))
+	defer server.Close()
+
+	resp, sent := expectContinue(t, server.URL+"/drop/notes.txt", "notes", map[string]string{"Authorization": "Bearer secret"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.True(t, sent)
+	data, err := os.ReadFile(filepath.Join(public, "drop", "notes.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "notes", string(data))
+
+	// A refused upload is answered before the body is sent
+	resp, sent = expectContinue(t, server.URL+"/drop/other.txt", "other", nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.False(t, sent)
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// Depth used by walkTree when no maxWalkDepth is configured
+const defaultWalkDepth = 32
+
+// walkTree calls fn for every entry below root with its slash separated
+// path relative to root. Entries nested deeper than maxWalkDepth are not
+// visited and truncated is reported. WalkDir never follows symbolic links,
+// so a link pointing back up the tree can't cause a runaway traversal.
+func (state HandlerState) walkTree(root string, fn func(relative string, d fs.DirEntry) error) (truncated bool, err error) {
+	maxDepth := state.MaxWalkDepth
+	if maxDepth <= 0 {
+		maxDepth = defaultWalkDepth
+	}
+
+	err = filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		if relative == "." {
+			return nil
+		}
+		relative = filepath.ToSlash(relative)
+
+		if strings.Count(relative, "/")+1 > maxDepth {
+			truncated = true
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		return fn(relative, d)
+	})
+
+	return truncated, err
+}
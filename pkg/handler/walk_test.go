@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWalkTreeDepth(t *testing.T) {
+	public := writeFiles(t, map[string]string{
+		"top.txt":            "top",
+		"a/one.txt":          "one",
+		"a/b/two.txt":        "two",
+		"a/b/c/three.txt":    "three",
+		"a/b/c/d/four.txt":   "four",
+		"a/b/c/d/e/five.txt": "five",
+	})
+
+	visit := func(state HandlerState) ([]string, bool) {
+		seen := []string{}
+		truncated, err := state.walkTree(public, func(relative string, d fs.DirEntry) error {
+			seen = append(seen, relative)
+			return nil
+		})
+		assert.Nil(t, err)
+
+		return seen, truncated
+	}
+
+	seen, truncated := visit(newTestHandler(Configuration{Public: public, MaxWalkDepth: 2}))
+	assert.True(t, truncated)
+	assert.Equal(t, []string{"a", "a/b", "a/one.txt", "top.txt"}, seen)
+
+	seen, truncated = visit(newTestHandler(Configuration{Public: public}))
+	assert.False(t, truncated)
+	assert.Contains(t, seen, "a/b/c/d/e/five.txt")
+}
@@ -2,6 +2,7 @@ package minimatch
 
 import (
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
@@ -146,6 +147,14 @@ func Match(list []string, pattern string, options Options) []string {
 	return result
 }
 
+// partGuard is what a path part has to satisfy besides its regexp
+type partGuard struct {
+	// the part may only start with a dot as allowed by the Dot option
+	dot bool
+	// the part can't be empty
+	nonEmpty bool
+}
+
 type matcher struct {
 	/*
 		set A 2-dimensional array of regexp or string expressions. Each row in the array corresponds to a brace-expanded pattern. Each item in the row corresponds to a single path-part. For example, the pattern {a,b/c}/d would expand to a set of patterns like:
@@ -187,6 +196,10 @@ type matcher struct {
 	// the set of regexps to use
 	set [][]*regexp.Regexp
 
+	// checks made on the path parts matched by the regexps of the set,
+	// for the lookaheads Go's regexp doesn't support
+	guards map[*regexp.Regexp]partGuard
+
 	log *log.Logger
 }
 
@@ -198,7 +211,7 @@ func NewMinimatch(pattern string, options Options) (Minimatch, error) {
 		pattern = strings.Join(strings.Split(pattern, string(os.PathSeparator)), "/")
 	}
 
-	m := &matcher{pattern: pattern, options: options}
+	m := &matcher{pattern: pattern, options: options, guards: map[*regexp.Regexp]partGuard{}}
 
 	if options.Debug {
 		m.log = log.New(os.Stderr, "minimatch:", 0)
@@ -220,19 +233,28 @@ func (m *matcher) MakeRe() (*regexp.Regexp, error) {
 	return m.regexp, nil
 }
 
-func (m *matcher) make() error {
+func (m *matcher) make() (err error) {
 	if m.regexp != nil {
 		return nil
 	}
 
+	// A malformed pattern can trip up the parser, report it instead of
+	// taking the caller down
+	defer func() {
+		if r := recover(); r != nil {
+			m.set = nil
+			err = fmt.Errorf("invalid pattern %q: %v", m.pattern, r)
+		}
+	}()
+
 	// empty patterns and comments match nothing.
-	if !m.options.NoComment && m.pattern[0] == '#' {
-		m.Comment = true
+	if len(m.pattern) == 0 {
+		m.Empty = true
 		m.regexp = emptyRegexp
 		return nil
 	}
-	if len(m.pattern) == 0 {
-		m.Empty = true
+	if !m.options.NoComment && m.pattern[0] == '#' {
+		m.Comment = true
 		m.regexp = emptyRegexp
 		return nil
 	}
@@ -356,17 +378,10 @@ func (m *matcher) parse(pattern string, isSub bool) (*regexp.Regexp, string, boo
 	classStart := -1
 
 	// . and .. never match anything that doesn't start with .,
-	// even when options.dot is set.
-	patternStart := ""
-	if pattern[0] == '.' {
-		patternStart = ""
-		//
-		// FIXME PCRE expressions
-		//	} else if m.options.Dot {
-		//		patternStart = "(?!(?:^|\\/)\\.{1,2}(?:$|\\/))"
-		// } else {
-		//    patternStart = "(?!\\.)"
-	}
+	// even when options.dot is set. minimatch prefixes the regexp with a
+	// negative lookahead which Go doesn't support, the parts matched are
+	// checked by dotAllowed instead.
+	patternStart := pattern[0] != '.'
 
 	clearStateChar := func() {
 		// we had some state-tracking character
@@ -469,7 +484,7 @@ func (m *matcher) parse(pattern string, isSub bool) (*regexp.Regexp, string, boo
 			continue
 
 		case ')':
-			if inClass || len(patternListStack) != 0 {
+			if inClass || len(patternListStack) == 0 {
 				re += "\\)"
 				continue
 			}
@@ -481,14 +496,14 @@ func (m *matcher) parse(pattern string, isSub bool) (*regexp.Regexp, string, boo
 			// negation is (?:(?!js)[^/]*)
 			// The others are (?:<pattern>)<type>
 			re += pl.close
+			pl.reEnd = len(re)
 			if pl.kind == "!" {
 				negativeLists = append(negativeLists, pl)
 			}
-			pl.reEnd = len(re)
 			continue
 
 		case '|':
-			if inClass || len(patternListStack) != 0 || escaping {
+			if inClass || len(patternListStack) == 0 || escaping {
 				re += "\\|"
 				escaping = false
 				continue
@@ -684,14 +699,10 @@ func (m *matcher) parse(pattern string, isSub bool) (*regexp.Regexp, string, boo
 	// if the re is not "" at this point, then we need to make sure
 	// it doesn't match against an empty path part.
 	// Otherwise a/* will match a/, which it should not.
-	//
-	// FIXME PCRE Syntax not supported by golang
-	// if re != "" && hasMagic {
-	//	re = "(?=.)" + re
-	// }
-
-	if addPatternStart {
-		re = patternStart + re
+	// minimatch uses a (?=.) lookahead, the guard checks the part instead.
+	guard := partGuard{
+		dot:      addPatternStart && patternStart,
+		nonEmpty: re != "" && hasMagic,
 	}
 
 	// parsing just a piece of a larger pattern.
@@ -724,6 +735,9 @@ func (m *matcher) parse(pattern string, isSub bool) (*regexp.Regexp, string, boo
 		// mode, but it's not a /m regex.
 		regExp = regexp.MustCompile("$.")
 	}
+	if guard.dot || guard.nonEmpty {
+		m.guards[regExp] = guard
+	}
 
 	//regExp._glob = pattern
 	//regExp._src = re
@@ -790,6 +804,30 @@ func (m *matcher) Match(f string, partial bool) bool {
 	return m.negate
 }
 
+// guarded tells if the path part f satisfies the guard of p
+func (m *matcher) guarded(p *regexp.Regexp, f string) bool {
+	guard := m.guards[p]
+	if guard.nonEmpty && f == "" {
+		return false
+	}
+
+	return !guard.dot || m.dotAllowed(f)
+}
+
+// dotAllowed tells if a path part starting with a dot can be matched by a
+// pattern that doesn't start with one, "." and ".." never are and other
+// dot names only with the Dot option.
+func (m *matcher) dotAllowed(part string) bool {
+	if !strings.HasPrefix(part, ".") {
+		return true
+	}
+	if part == "." || part == ".." {
+		return false
+	}
+
+	return m.options.Dot
+}
+
 func (m *matcher) matchOne(file []string, pattern []*regexp.Regexp, partial bool) bool {
 	m.log.Println("matchOne", file, pattern)
 
@@ -864,7 +902,7 @@ func (m *matcher) matchOne(file []string, pattern []*regexp.Regexp, partial bool
 				} else {
 					// can't swallow "." or ".." ever.
 					// can only swallow ".foo" when explicitly asked.
-					if swallowee == "." || swallowee == ".." || (!m.options.Dot && swallowee[0] == '.') {
+					if swallowee == "." || swallowee == ".." || (!m.options.Dot && len(swallowee) != 0 && swallowee[0] == '.') {
 						m.log.Println("dot detected!", file, fr, pattern, pr)
 						break
 					}
@@ -892,7 +930,7 @@ func (m *matcher) matchOne(file []string, pattern []*regexp.Regexp, partial bool
 		// something other than **
 		// non-magic patterns just have to match exactly
 		// patterns with magic have been turned into regexps.
-		hit := p.MatchString(f)
+		hit := p.MatchString(f) && m.guarded(p, f)
 		m.log.Println("pattern match", p, f, hit)
 		if !hit {
 			return false
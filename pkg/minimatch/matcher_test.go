@@ -14,6 +14,8 @@ var files = []string{
 	"bdir/", "bdir/cfile",
 }
 
+var dotFiles = []string{"a/./b", "a/../b", "a/c/b", "a/.d/b"}
+
 type testStruct struct {
 	pattern string
 	expect  []string
@@ -167,28 +169,65 @@ var testItems = []testStruct{
 	// ['{/?,*}', ['/a', 'bb'], {null: true},
 	//   ['/a', '/b/b', '/a/b/c', 'bb']],
 
-	// 'dots should not match unless requested',
-	// ['**', ['a/b'], {}, ['a/b', 'a/.d', '.a/.d']],
+	// dots should not match unless requested
+	{
+		pattern: "**",
+		expect:  []string{"a/b"},
+		files:   []string{"a/b", "a/.d", ".a/.d"},
+	},
 
-	// // .. and . can only match patterns starting with .,
-	// // even when options.dot is set.
-	// function () {
-	//   files = ['a/./b', 'a/../b', 'a/c/b', 'a/.d/b']
-	// },
-	// ['a/*/b', ['a/c/b', 'a/.d/b'], {dot: true}],
-	// ['a/.*/b', ['a/./b', 'a/../b', 'a/.d/b'], {dot: true}],
-	// ['a/*/b', ['a/c/b'], {dot: false}],
-	// ['a/.*/b', ['a/./b', 'a/../b', 'a/.d/b'], {dot: false}],
-
-	// // this also tests that changing the options needs
-	// // to change the cache key, even if the pattern is
-	// // the same!
-	// [
-	//   '**',
-	//   ['a/b', 'a/.d', '.a/.d'],
-	//   { dot: true },
-	//   [ '.a/.d', 'a/.d', 'a/b']
-	// ],
+	// .. and . can only match patterns starting with .,
+	// even when options.dot is set.
+	{
+		pattern: "a/*/b",
+		expect:  []string{"a/c/b", "a/.d/b"},
+		options: minimatch.Options{Dot: true},
+		files:   dotFiles,
+	},
+	{
+		pattern: "a/.*/b",
+		expect:  []string{"a/./b", "a/../b", "a/.d/b"},
+		options: minimatch.Options{Dot: true},
+		files:   dotFiles,
+	},
+	{
+		pattern: "a/*/b",
+		expect:  []string{"a/c/b"},
+		files:   dotFiles,
+	},
+	{
+		pattern: "a/.*/b",
+		expect:  []string{"a/./b", "a/../b", "a/.d/b"},
+		files:   dotFiles,
+	},
+	{
+		pattern: "a/**/b",
+		expect:  []string{"a/c/b", "a/.d/b"},
+		options: minimatch.Options{Dot: true},
+		files:   dotFiles,
+	},
+	{
+		pattern: "a/**/b",
+		expect:  []string{"a/c/b"},
+		files:   dotFiles,
+	},
+	{
+		pattern: "a/?d/b",
+		expect:  []string{"a/.d/b"},
+		options: minimatch.Options{Dot: true},
+		files:   dotFiles,
+	},
+	{
+		pattern: "a/?d/b",
+		expect:  []string{},
+		files:   dotFiles,
+	},
+	{
+		pattern: "**",
+		expect:  []string{"a/b", "a/.d", ".a/.d"},
+		options: minimatch.Options{Dot: true},
+		files:   []string{".a/.d", "a/.d", "a/b"},
+	},
 
 	// 'paren sets cannot contain slashes',
 	// ['*(a/b)', ['*(a/b)'], {nonull: true}, ['a/b']],
@@ -284,20 +323,46 @@ var testItems = []testStruct{
 	// // copy bash 4.3 behavior on this.
 	// ['*.!(js)', ['foo.bar', 'foo.', 'boo.js.boo', 'foo.js.js'] ],
 
-	// 'https://github.com/isaacs/minimatch/issues/5',
-	// function () {
-	//   files = [
-	//     'a/b/.x/c', 'a/b/.x/c/d', 'a/b/.x/c/d/e', 'a/b/.x', 'a/b/.x/',
-	//     'a/.x/b', '.x', '.x/', '.x/a', '.x/a/b', 'a/.x/b/.x/c', '.x/.x'
-	//   ]
-	// },
-	// [
-	//   '**/.x/**',
-	//   [
-	//     '.x/', '.x/a', '.x/a/b', 'a/.x/b', 'a/b/.x/', 'a/b/.x/c',
-	//     'a/b/.x/c/d', 'a/b/.x/c/d/e'
-	//   ]
-	// ],
+	// a pattern with magic never matches an empty path part, a/* doesn't
+	// match a/ but does match a/b/
+	{
+		pattern: "a/*",
+		expect:  []string{"a/b", "a/b/"},
+		files:   []string{"a/", "a/b", "a/b/", "a/b/c"},
+	},
+	{
+		pattern: "a/?*",
+		expect:  []string{"a/b"},
+		files:   []string{"a/", "a/b"},
+	},
+	{
+		pattern: "a/[bc]",
+		expect:  []string{"a/b"},
+		files:   []string{"a/", "a/b"},
+	},
+	{
+		pattern: "*/",
+		expect:  []string{"a/"},
+		files:   []string{"/", "a/", "a"},
+	},
+	{
+		pattern: "a/",
+		expect:  []string{"a/"},
+		files:   []string{"a/", "a/b"},
+	},
+
+	// https://github.com/isaacs/minimatch/issues/5
+	{
+		pattern: "**/.x/**",
+		expect: []string{
+			".x/", ".x/a", ".x/a/b", "a/.x/b", "a/b/.x/", "a/b/.x/c",
+			"a/b/.x/c/d", "a/b/.x/c/d/e",
+		},
+		files: []string{
+			"a/b/.x/c", "a/b/.x/c/d", "a/b/.x/c/d/e", "a/b/.x", "a/b/.x/",
+			"a/.x/b", ".x", ".x/", ".x/a", ".x/a/b", "a/.x/b/.x/c", ".x/.x",
+		},
+	},
 
 	// 'https://github.com/isaacs/minimatch/issues/59',
 	// ['[z-a]', []],
@@ -317,3 +382,30 @@ func TestMatchBasic(t *testing.T) {
 		assert.ElementsMatch(t, matches, item.expect, item.pattern)
 	}
 }
+
+func TestMatchGlobstarEmptyPart(t *testing.T) {
+	// The empty parts of "/" used to crash the globstar swallowing
+	matches := minimatch.Match([]string{"/", "/app.js", "/a/b.js", "/a/"}, "/**/*.js", minimatch.Options{})
+
+	assert.ElementsMatch(t, []string{"/app.js", "/a/b.js"}, matches)
+}
+
+func TestMalformedPatterns(t *testing.T) {
+	// A parenthesis outside of a pattern list is an ordinary character
+	matches := minimatch.Match([]string{"a", "a)", "b|c"}, "a)", minimatch.Options{})
+	assert.ElementsMatch(t, []string{"a)"}, matches)
+	matches = minimatch.Match([]string{"a", "a)", "b|c"}, "b|c", minimatch.Options{})
+	assert.ElementsMatch(t, []string{"b|c"}, matches)
+
+	matches = minimatch.Match([]string{"a", "b", "c"}, "+(a|b)", minimatch.Options{})
+	assert.ElementsMatch(t, []string{"a", "b"}, matches)
+
+	// Patterns the parser can't handle are errors rather than panics
+	for _, pattern := range []string{"/${!(!(]", ",^?!)()"} {
+		assert.NotPanics(t, func() {
+			minimatch.MatchString("a", pattern, minimatch.Options{})
+		}, pattern)
+	}
+	_, err := minimatch.NewMinimatch("/${!(!(]", minimatch.Options{})
+	assert.Error(t, err)
+}
@@ -1,20 +1,51 @@
 package path_to_regexp
 
 import (
-	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestSmokeTest(t *testing.T) {
-	keys := []Token{}
-	r, err := PathToRegexp("/:foo/:bar", &keys, NewOptions())
-
-	fmt.Printf("%#v\n", keys)
+	r, err := PathToRegexp("/:foo/:bar", NewOptions())
 
 	assert.Nil(t, err, "Error is non-nil")
-	assert.Equal(t, 2, len(keys))
 
-	assert.True(t, r.MatchString("/test/path"))
+	matched, result := r.MatchString("/test/path")
+	assert.True(t, matched)
+	assert.Equal(t, 2, len(result.Keys()))
+	assert.Equal(t, []string{"/test/path", "test", "path"}, result.Results)
+
+	params := map[string]string{}
+	for idx, key := range result.Keys() {
+		params[key.Name] = result.Results[idx+1]
+	}
+	assert.Equal(t, map[string]string{"foo": "test", "bar": "path"}, params)
+
+	matched, result = r.MatchString("/test")
+	assert.False(t, matched)
+	assert.Empty(t, result.Results)
+
+	matched, _ = r.MatchString("/test/path/more")
+	assert.False(t, matched)
+}
+
+func TestCompile(t *testing.T) {
+	assert.Equal(t, "/users/42", Compile("/users/:id")(map[string]string{"id": "42"}))
+	assert.Equal(t, "/users/a%20b%2Fc", Compile("/users/:id")(map[string]string{"id": "a b/c"}))
+	assert.Equal(t, "/posts/hello.html", Compile("/posts/:slug.html")(map[string]string{"slug": "hello"}))
+	assert.Equal(t, "/static", Compile("/static")(map[string]string{"id": "42"}))
+
+	// Optional tokens are left out with their prefix when missing
+	optional := Compile("/users/:id/:tab?")
+	assert.Equal(t, "/users/42/posts", optional(map[string]string{"id": "42", "tab": "posts"}))
+	assert.Equal(t, "/users/42", optional(map[string]string{"id": "42"}))
+
+	// Missing required tokens are left empty
+	assert.Equal(t, "/users/", Compile("/users/:id")(map[string]string{}))
+
+	// Repeated tokens keep their delimiters
+	repeat := Compile("/files/:path+")
+	assert.Equal(t, "/files/a/b%20c/d", repeat(map[string]string{"path": "a/b c/d"}))
+	assert.Equal(t, "/files", Compile("/files/:path*")(map[string]string{}))
 }
@@ -1,6 +1,7 @@
 package path_to_regexp
 
 import (
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
@@ -74,6 +75,11 @@ type Result struct {
 	Results []string
 }
 
+// Keys lists the tokens captured by the match, in the order of Results[1:]
+func (result Result) Keys() []Token {
+	return result.keys
+}
+
 type PathMatcher interface {
 	MatchString(string) (bool, Result)
 }
@@ -88,9 +94,14 @@ func PathToRegexp(path string, options Options) (PathMatcher, error) {
 }
 
 func (matcher *matcherParser) MatchString(path string) (bool, Result) {
+	results := matcher.regexp.FindStringSubmatch(path)
+	if results == nil {
+		return false, Result{keys: matcher.keys, Results: []string{}}
+	}
+
 	return true, Result{
 		keys:    matcher.keys,
-		Results: []string{},
+		Results: results,
 	}
 }
 
@@ -200,8 +211,11 @@ func parse(str string, options Options) []Token {
 	}
 
 	// Push any remaining characters.
-	if len(path) != 0 && index < len(str) {
-		tokens = append(tokens, Token{path: str[index:]})
+	if index < len(str) {
+		path += str[index:]
+	}
+	if len(path) != 0 {
+		tokens = append(tokens, Token{path: path})
 	}
 
 	return tokens
@@ -304,11 +318,44 @@ func escapeGroup(str string) string {
 	return escapeGroupRE.ReplaceAllString(str, `\$1`)
 }
 
-// TODO: This needs to work
+// Compile returns a function that builds a path from the template in path,
+// the named tokens are replaced with the escaped values from params. An
+// optional token missing from params is left out along with its prefix, a
+// missing required one is left empty. The value of a repeated token holds
+// its segments joined by the token delimiter, each segment is escaped.
 func Compile(path string) func(map[string]string) string {
+	tokens := parse(path, NewOptions())
+
 	toPath := func(params map[string]string) string {
-		return path
+		result := ""
+		for _, token := range tokens {
+			if token.path != "" {
+				result += token.path
+				continue
+			}
+
+			value, found := params[token.Name]
+			if (!found || value == "") && token.Optional {
+				continue
+			}
+			if !token.Repeat {
+				result += token.Prefix + encodeURIComponent(value)
+				continue
+			}
+
+			segments := []string{}
+			for _, segment := range strings.Split(value, token.Delimiter) {
+				segments = append(segments, encodeURIComponent(segment))
+			}
+			result += token.Prefix + strings.Join(segments, token.Delimiter)
+		}
+		return result
 	}
 
 	return toPath
 }
+
+// encodeURIComponent escapes a value the way the JavaScript function does
+func encodeURIComponent(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
@@ -0,0 +1,143 @@
+package swhttp
+
+import (
+	"container/list"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Cache is a size bounded in-memory store of file contents, entries are
+// keyed by the cleaned request name and are only valid while the size and
+// modification time of the file on disk are unchanged. When the cache is
+// full the least recently used entries make room for new ones.
+type Cache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	entries  map[string]*list.Element
+	// Entries from most to least recently used
+	lru *list.List
+}
+
+type cacheEntry struct {
+	name    string
+	data    []byte
+	modTime time.Time
+	// When the entry was read from disk
+	cached time.Time
+}
+
+var errCacheFull = errors.New("cache size limit reached")
+
+// NewCache creates a cache that will hold at most maxBytes of file content
+func NewCache(maxBytes int64) *Cache {
+	return &Cache{
+		maxBytes: maxBytes,
+		entries:  map[string]*list.Element{},
+		lru:      list.New(),
+	}
+}
+
+// get returns the cached entry for name if it still matches d, a stale
+// entry is dropped
+func (c *Cache) get(name string, d fs.FileInfo) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, found := c.entries[name]
+	if !found {
+		return cacheEntry{}, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !entry.modTime.Equal(d.ModTime()) || int64(len(entry.data)) != d.Size() {
+		c.remove(elem)
+		return cacheEntry{}, false
+	}
+	c.lru.MoveToFront(elem)
+
+	return *entry, true
+}
+
+// fill reads the file into the cache, evicting the least recently used
+// entries to make room. A file larger than the whole cache isn't read and
+// errCacheFull is returned.
+func (c *Cache) fill(name string, d fs.FileInfo, f io.Reader) ([]byte, error) {
+	if d.IsDir() || d.Size() > c.maxBytes {
+		return nil, errCacheFull
+	}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if prior, found := c.entries[name]; found {
+		c.remove(prior)
+	}
+	if int64(len(data)) > c.maxBytes {
+		// The file grew since it was stat'ed
+		return data, errCacheFull
+	}
+	for c.size+int64(len(data)) > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+	c.entries[name] = c.lru.PushFront(&cacheEntry{name: name, data: data, modTime: d.ModTime(), cached: time.Now()})
+	c.size += int64(len(data))
+
+	return data, nil
+}
+
+// remove drops the entry held by elem, the lock must be held
+func (c *Cache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.name)
+	c.size -= int64(len(entry.data))
+}
+
+// Load reads name from root into the cache, used to pre-warm the cache
+// at startup for a known set of hot files.
+func (c *Cache) Load(root http.FileSystem, name string) error {
+	name = path.Clean("/" + name)
+
+	f, err := root.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	d, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if d.IsDir() {
+		return errors.Errorf("%s is a directory", name)
+	}
+
+	_, err = c.fill(name, d, f)
+
+	return err
+}
+
+// setAge sends the Date of the response along with the Age of a cached
+// copy made at cached, as downstream caches expect.
+func setAge(w http.ResponseWriter, cached time.Time) {
+	now := time.Now()
+
+	age := int64(now.Sub(cached) / time.Second)
+	if age < 0 {
+		age = 0
+	}
+
+	w.Header().Set("Date", now.UTC().Format(http.TimeFormat))
+	w.Header().Set("Age", strconv.FormatInt(age, 10))
+}
@@ -0,0 +1,157 @@
+package swhttp
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/koblas/swerver/pkg/trace"
+)
+
+// CompressionCache keeps gzip compressed copies of served files in a
+// directory, a copy is made on the first request and served from disk for
+// every following one until the file changes.
+type CompressionCache struct {
+	dir string
+}
+
+// Content types worth compressing beyond text/*
+var compressibleTypes = map[string]bool{
+	"application/javascript": true,
+	"application/json":       true,
+	"application/xml":        true,
+	"application/wasm":       true,
+	"image/svg+xml":          true,
+}
+
+// NewCompressionCache stores the compressed copies in dir, creating it
+func NewCompressionCache(dir string) (*CompressionCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &CompressionCache{dir: dir}, nil
+}
+
+func compressible(name string) bool {
+	mediaType, _, _ := mime.ParseMediaType(mime.TypeByExtension(path.Ext(name)))
+
+	return strings.HasPrefix(mediaType, "text/") || compressibleTypes[mediaType]
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range parseQualityList(r.Header.Get("Accept-Encoding")) {
+		if strings.EqualFold(encoding, "gzip") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// entry names the compressed copy of name, the prefix is shared by every
+// version of the file so stale copies can be found.
+func (c *CompressionCache) entry(name string, d fs.FileInfo) (string, string) {
+	sum := sha256.Sum256([]byte(name))
+	prefix := filepath.Join(c.dir, hex.EncodeToString(sum[:16]))
+
+	return prefix, fmt.Sprintf("%s-%x-%x.gz", prefix, d.ModTime().UnixNano(), d.Size())
+}
+
+// open returns the compressed copy for name, compressing f when there is
+// no copy for the current version of the file yet.
+func (c *CompressionCache) open(name string, d fs.FileInfo, f io.Reader) (*os.File, bool, error) {
+	prefix, entry := c.entry(name, d)
+
+	if file, err := os.Open(entry); err == nil {
+		return file, true, nil
+	}
+
+	// The file changed, drop the copies of earlier versions
+	if stale, err := filepath.Glob(prefix + "-*.gz"); err == nil {
+		for _, name := range stale {
+			os.Remove(name)
+		}
+	}
+
+	tmp, err := os.CreateTemp(c.dir, ".compress-*")
+	if err != nil {
+		return nil, false, err
+	}
+	defer os.Remove(tmp.Name())
+
+	gz := gzip.NewWriter(tmp)
+	_, err = io.Copy(gz, f)
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), entry)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	file, err := os.Open(entry)
+	return file, false, err
+}
+
+// serveCompressed answers with the cached gzip copy of the file, reporting
+// false when the request or the file doesn't qualify.
+func (fh *fileHandler) serveCompressed(w http.ResponseWriter, r *http.Request, name string, d fs.FileInfo, f io.ReadSeeker) bool {
+	cache := fh.options.CompressionCache
+	if cache == nil || !compressible(d.Name()) {
+		return false
+	}
+	AddVary(w, r, "Accept-Encoding")
+	if !acceptsGzip(r) || r.Header.Get("Range") != "" {
+		return false
+	}
+
+	file, hit, err := cache.open(name, d, f)
+	if err != nil {
+		logf(r, "swhttp: unable to compress %s: %v", name, err)
+		// Rewind the file for serving it uncompressed
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+			return true
+		}
+		return false
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	if hit {
+		trace.Add(r, "compression cache hit %s", name)
+		w.Header().Set("X-Compression-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Compression-Cache", "MISS")
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	if tag := w.Header().Get("Etag"); tag != "" {
+		w.Header().Set("Etag", encodedETag(tag, "gzip"))
+	}
+	// The compressed copy was cached when it was written
+	setAge(w, info.ModTime())
+
+	sizeFunc := func() (int64, error) { return info.Size(), nil }
+	serveContent(w, r, d.Name(), d.ModTime(), sizeFunc, file, fh.options.MaxRanges)
+
+	return true
+}
@@ -0,0 +1,44 @@
+package swhttp
+
+import (
+	"net/http"
+	"time"
+)
+
+// headerWriter exposes response headers to the condition checks without
+// a response being written
+type headerWriter struct {
+	header http.Header
+}
+
+func (w headerWriter) Header() http.Header         { return w.header }
+func (w headerWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w headerWriter) WriteHeader(int)             {}
+
+// CheckWritePreconditions evaluates If-Match, If-Unmodified-Since and
+// If-None-Match for a request replacing or removing a file, exists and
+// modtime describe the file as it is now. It reports false when the
+// request has to be refused with 412 Precondition Failed.
+func CheckWritePreconditions(r *http.Request, exists bool, modtime time.Time) bool {
+	w := headerWriter{http.Header{}}
+
+	// This follows RFC 7232 section 6 for a state changing method
+	ch := condNone
+	if r.Header.Get("If-Match") != "" {
+		if !exists {
+			return false
+		}
+		ch = checkIfMatch(w, r)
+	} else if exists {
+		ch = checkIfUnmodifiedSince(r, modtime)
+	}
+	if ch == condFalse {
+		return false
+	}
+
+	if exists && checkIfNoneMatch(w, r) == condFalse {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,98 @@
+package swhttp
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/andybalholm/brotli/matchfinder"
+)
+
+// Largest dictionary accepted, matches are only looked for this far back
+const maxDictionarySize = 1 << 20
+
+// Header of a dictionary compressed Brotli stream, followed by the SHA-256
+// of the dictionary
+var dcbMagic = []byte{0xff, 0x44, 0x43, 0x42}
+
+// BrotliDictionary compresses responses against a shared dictionary using
+// the "dcb" content encoding of compression dictionary transport. Clients
+// announce the dictionary they hold with the Available-Dictionary header.
+type BrotliDictionary struct {
+	data []byte
+	hash [sha256.Size]byte
+	// Available-Dictionary value of the clients holding the dictionary
+	available string
+}
+
+// NewBrotliDictionary reads the dictionary from filename
+func NewBrotliDictionary(filename string) (*BrotliDictionary, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxDictionarySize {
+		return nil, fmt.Errorf("brotli dictionary %s is larger than %d bytes", filename, maxDictionarySize)
+	}
+
+	hash := sha256.Sum256(data)
+
+	return &BrotliDictionary{
+		data:      data,
+		hash:      hash,
+		available: ":" + base64.StdEncoding.EncodeToString(hash[:]) + ":",
+	}, nil
+}
+
+// Accepted tells if the client holds the dictionary and accepts the dcb
+// encoding
+func (d *BrotliDictionary) Accepted(r *http.Request) bool {
+	if strings.TrimSpace(r.Header.Get("Available-Dictionary")) != d.available {
+		return false
+	}
+
+	for _, encoding := range parseQualityList(r.Header.Get("Accept-Encoding")) {
+		if strings.EqualFold(encoding, "dcb") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Encode writes data to w in the dcb encoding. The match finder is primed
+// with the dictionary so matches can reach back into it, as the client
+// decodes with the dictionary as a prefix of the stream.
+func (d *BrotliDictionary) Encode(w io.Writer, data []byte) error {
+	finder := &matchfinder.M4{
+		MaxDistance:     maxDictionarySize,
+		ChainLength:     16,
+		HashLen:         5,
+		DistanceBitCost: 57,
+	}
+	finder.FindMatches(nil, d.data)
+
+	if _, err := w.Write(dcbMagic); err != nil {
+		return err
+	}
+	if _, err := w.Write(d.hash[:]); err != nil {
+		return err
+	}
+
+	bw := &matchfinder.Writer{
+		Dest:        w,
+		MatchFinder: finder,
+		Encoder:     &brotli.Encoder{},
+		BlockSize:   1 << 16,
+	}
+	if _, err := bw.Write(data); err != nil {
+		return err
+	}
+
+	return bw.Close()
+}
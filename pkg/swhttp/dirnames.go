@@ -0,0 +1,65 @@
+package swhttp
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DirNames caches the entry names of directories for the strict case
+// check, a directory is read again once its modification time changes.
+type DirNames struct {
+	mu      sync.Mutex
+	entries map[string]dirNamesEntry
+}
+
+type dirNamesEntry struct {
+	modTime time.Time
+	names   map[string]bool
+}
+
+// NewDirNames creates an empty directory name cache
+func NewDirNames() *DirNames {
+	return &DirNames{entries: map[string]dirNamesEntry{}}
+}
+
+// Contains reports if the directory dir of fsys has an entry spelled
+// exactly name. A nil cache reads the directory every time.
+func (c *DirNames) Contains(fsys http.FileSystem, dir, name string) bool {
+	f, err := fsys.Open(dir)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	d, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	if c != nil {
+		c.mu.Lock()
+		entry, ok := c.entries[dir]
+		c.mu.Unlock()
+		if ok && entry.modTime.Equal(d.ModTime()) {
+			return entry.names[name]
+		}
+	}
+
+	infos, err := f.Readdir(-1)
+	if err != nil {
+		return false
+	}
+	names := make(map[string]bool, len(infos))
+	for _, info := range infos {
+		names[info.Name()] = true
+	}
+
+	if c != nil {
+		c.mu.Lock()
+		c.entries[dir] = dirNamesEntry{modTime: d.ModTime(), names: names}
+		c.mu.Unlock()
+	}
+
+	return names[name]
+}
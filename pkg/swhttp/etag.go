@@ -0,0 +1,134 @@
+package swhttp
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ETag algorithms, ETagModTimeSize is cheap while ETagSHA256 hashes the
+// content so every replica serving the same file sends the same tag.
+const (
+	ETagModTimeSize = "mtime-size"
+	ETagSHA256      = "sha256"
+)
+
+// Content hashes remembered by an ETagger
+const etagCacheEntries = 4096
+
+// ETagger computes the entity tags of served files, content hashes are
+// kept in a small LRU cache until the file changes.
+type ETagger struct {
+	algorithm string
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type etagEntry struct {
+	name    string
+	modTime time.Time
+	size    int64
+	tag     string
+}
+
+// NewETagger creates an ETagger for algorithm, an empty name uses
+// ETagModTimeSize
+func NewETagger(algorithm string) (*ETagger, error) {
+	switch algorithm {
+	case "":
+		algorithm = ETagModTimeSize
+	case ETagModTimeSize, ETagSHA256:
+	default:
+		return nil, errors.Errorf("unknown etag algorithm %q", algorithm)
+	}
+
+	return &ETagger{
+		algorithm: algorithm,
+		order:     list.New(),
+		entries:   map[string]*list.Element{},
+	}, nil
+}
+
+// Tag returns the entity tag for the file name, f is left at its start
+func (e *ETagger) Tag(name string, d fs.FileInfo, f io.ReadSeeker) (string, error) {
+	return e.tag(name, d, f)
+}
+
+// tag returns the entity tag for the file name, f is left at its start
+func (e *ETagger) tag(name string, d fs.FileInfo, f io.ReadSeeker) (string, error) {
+	if e.algorithm == ETagModTimeSize {
+		return fmt.Sprintf(`W/"%x-%x"`, d.ModTime().UnixNano(), d.Size()), nil
+	}
+
+	if tag, found := e.get(name, d); found {
+		return tag, nil
+	}
+
+	hash := sha256.New()
+	_, err := io.Copy(hash, f)
+	if _, serr := f.Seek(0, io.SeekStart); err == nil {
+		err = serr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	tag := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+	e.put(etagEntry{name: name, modTime: d.ModTime(), size: d.Size(), tag: tag})
+
+	return tag, nil
+}
+
+func (e *ETagger) get(name string, d fs.FileInfo) (string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	elem, found := e.entries[name]
+	if !found {
+		return "", false
+	}
+	entry := elem.Value.(etagEntry)
+	if !entry.modTime.Equal(d.ModTime()) || entry.size != d.Size() {
+		return "", false
+	}
+	e.order.MoveToFront(elem)
+
+	return entry.tag, true
+}
+
+func (e *ETagger) put(entry etagEntry) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if elem, found := e.entries[entry.name]; found {
+		elem.Value = entry
+		e.order.MoveToFront(elem)
+		return
+	}
+
+	e.entries[entry.name] = e.order.PushFront(entry)
+	if e.order.Len() > etagCacheEntries {
+		oldest := e.order.Back()
+		e.order.Remove(oldest)
+		delete(e.entries, oldest.Value.(etagEntry).name)
+	}
+}
+
+// encodedETag derives the tag of an encoded representation from the tag
+// of the file, so the two are never confused by a cache
+func encodedETag(tag, encoding string) string {
+	if tag == "" || tag[len(tag)-1] != '"' {
+		return tag
+	}
+
+	return tag[:len(tag)-1] + "-" + encoding + `"`
+}
@@ -0,0 +1,32 @@
+package swhttp
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// FindFallback looks for a file called fallback next to the missing name
+// and then in each parent directory up to the root, returning the path of
+// the closest one or an empty string when there is none.
+func FindFallback(fsys http.FileSystem, name string, fallback string) string {
+	if fallback == "" || strings.ContainsAny(fallback, "/\\") {
+		return ""
+	}
+
+	dir := path.Dir(path.Join("/", strings.TrimSuffix(name, "/")))
+	for {
+		candidate := path.Join(dir, fallback)
+		if f, err := fsys.Open(candidate); err == nil {
+			d, err := f.Stat()
+			f.Close()
+			if err == nil && !d.IsDir() {
+				return candidate
+			}
+		}
+		if dir == "/" {
+			return ""
+		}
+		dir = path.Dir(dir)
+	}
+}
@@ -0,0 +1,45 @@
+package swhttp
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/koblas/swerver/pkg/minimatch"
+)
+
+// Longest ?filter= glob accepted on a listing
+const maxFilterLength = 256
+
+// ListingFilter reads the ?filter= glob of a listing request, matched
+// case insensitively against the names of the entries. The matcher is nil
+// when the request has no filter.
+func ListingFilter(r *http.Request) (minimatch.Minimatch, string, error) {
+	value := strings.TrimSpace(r.URL.Query().Get("filter"))
+	if value == "" {
+		return nil, "", nil
+	}
+	if len(value) > maxFilterLength || strings.Contains(value, "/") {
+		return nil, value, fmt.Errorf("invalid filter %q", value)
+	}
+
+	matcher, err := minimatch.NewMinimatch(value, minimatch.Options{NoCase: true, NoComment: true})
+	if err != nil {
+		return nil, value, err
+	}
+
+	return matcher, value, nil
+}
+
+type listingFilter struct {
+	matcher minimatch.Minimatch
+	raw     string
+}
+
+func (f *listingFilter) value() string {
+	if f == nil {
+		return ""
+	}
+
+	return f.raw
+}
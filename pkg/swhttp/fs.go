@@ -7,6 +7,7 @@
 package swhttp
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -22,8 +23,10 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
+	"github.com/koblas/swerver/pkg/trace"
 	"github.com/pkg/errors"
 )
 
@@ -58,34 +61,63 @@ type anyDirs interface {
 	len() int
 	name(i int) string
 	isDir(i int) bool
+	info(i int) (fs.FileInfo, error)
 }
 
 type fileInfoDirs []fs.FileInfo
 
-func (d fileInfoDirs) len() int          { return len(d) }
-func (d fileInfoDirs) isDir(i int) bool  { return d[i].IsDir() }
-func (d fileInfoDirs) name(i int) string { return d[i].Name() }
+func (d fileInfoDirs) len() int                        { return len(d) }
+func (d fileInfoDirs) isDir(i int) bool                { return d[i].IsDir() }
+func (d fileInfoDirs) name(i int) string               { return d[i].Name() }
+func (d fileInfoDirs) info(i int) (fs.FileInfo, error) { return d[i], nil }
 
 type dirEntryDirs []fs.DirEntry
 
-func (d dirEntryDirs) len() int          { return len(d) }
-func (d dirEntryDirs) isDir(i int) bool  { return d[i].IsDir() }
-func (d dirEntryDirs) name(i int) string { return d[i].Name() }
+func (d dirEntryDirs) len() int                        { return len(d) }
+func (d dirEntryDirs) isDir(i int) bool                { return d[i].IsDir() }
+func (d dirEntryDirs) name(i int) string               { return d[i].Name() }
+func (d dirEntryDirs) info(i int) (fs.FileInfo, error) { return d[i].Info() }
 
 type fileDetails struct {
-	Title    string
-	Base     string
-	Name     string
-	Ext      string
-	Dir      string
-	Size     int
-	Relative string
-	IsDir    bool
+	Title    string `json:"-"`
+	Base     string `json:"name"`
+	Name     string `json:"-"`
+	Ext      string `json:"-"`
+	Dir      string `json:"-"`
+	Size     *int64 `json:"size,omitempty"`
+	Relative string `json:"url"`
+	IsDir    bool   `json:"isDir"`
+	// Downloads counted by the hit counter
+	Hits int64 `json:"hits,omitempty"`
+	// Reduced copy of an image, when thumbnails are enabled
+	Thumbnail string `json:"thumbnail,omitempty"`
+	// Modification time, empty when unknown
+	Modified *time.Time `json:"modified,omitempty"`
+	// Size and modification time formatted for display, directories
+	// have no size
+	SizeText     string `json:"-"`
+	ModifiedText string `json:"-"`
+	// Base shortened to the configured maximum length for display
+	Display string `json:"-"`
+}
+
+// TruncateName shortens name to at most max characters, ending it with an
+// ellipsis, a max of zero or less keeps the name as is.
+func TruncateName(name string, max int) string {
+	runes := []rune(name)
+	if max <= 0 || len(runes) <= max {
+		return name
+	}
+	if max == 1 {
+		return "…"
+	}
+
+	return string(runes[:max-1]) + "…"
 }
 
 type breadcrumbsType struct {
-	Url  string
-	Name string
+	Url  string `json:"url"`
+	Name string `json:"name"`
 }
 
 type renderDirResult struct {
@@ -95,7 +127,7 @@ type renderDirResult struct {
 	outputData interface{}
 }
 
-func dirList(r *http.Request, f http.File, pathname string) (renderDirResult, error) {
+func dirList(r *http.Request, f http.File, pathname string, hits *HitCounter, maxNameLength int, basePath string, filter *listingFilter, thumbnails *Thumbnailer) (renderDirResult, error) {
 	// Prefer to use ReadDir instead of Readdir,
 	// because the former doesn't require calling
 	// Stat on every entry of a directory on Unix.
@@ -125,6 +157,9 @@ func dirList(r *http.Request, f http.File, pathname string) (renderDirResult, er
 	for i, n := 0, dirs.len(); i < n; i++ {
 		name := dirs.name(i)
 		isDir := dirs.isDir(i)
+		if filter != nil && filter.matcher != nil && !filter.matcher.Match(name, false) {
+			continue
+		}
 		if isDir {
 			name += "/"
 		}
@@ -141,22 +176,58 @@ func dirList(r *http.Request, f http.File, pathname string) (renderDirResult, er
 			IsDir:    isDir,
 			Relative: url.String(),
 		}
+		details.Display = TruncateName(details.Base, maxNameLength)
+		if info, err := dirs.info(i); err == nil {
+			modified := info.ModTime()
+			details.Modified = &modified
+			details.ModifiedText = FormatModified(modified)
+			if !isDir {
+				size := info.Size()
+				details.Size = &size
+				details.SizeText = FormatSize(info.Size())
+			}
+		}
+		if hits != nil && !isDir {
+			details.Hits = hits.Get(path.Join(pathname, name))
+		}
+		if thumbnails != nil && !isDir {
+			if thumb := thumbnails.URL(path.Join(pathname, name)); thumb != "" {
+				details.Thumbnail = basePath + thumb
+			}
+		}
 
 		fileResult = append(fileResult, details)
 	}
 
+	// Link to the parent directory first, unless this is the root. The
+	// listing is always served with a trailing slash so a relative link
+	// works.
+	if pathname != "/" && pathname != "" {
+		fileResult = append([]fileDetails{{
+			Base:     "..",
+			Name:     "..",
+			Title:    "..",
+			Display:  "..",
+			IsDir:    true,
+			Relative: "../",
+		}}, fileResult...)
+	}
+
 	// todo calculate breadcrums
 	type returnType struct {
-		Directory string
-		Index     []breadcrumbsType
-		Files     []fileDetails
+		Directory string            `json:"directory"`
+		Index     []breadcrumbsType `json:"breadcrumbs"`
+		Files     []fileDetails     `json:"files"`
+		// Filtering is enabled, with the active glob
+		Filterable bool   `json:"-"`
+		Filter     string `json:"filter,omitempty"`
 	}
 
 	breadcrumbs := []breadcrumbsType{
-		{Url: "/", Name: "root "},
+		{Url: basePath + "/", Name: "root "},
 	}
 	directory := pathname
-	crumbase := "/"
+	crumbase := basePath + "/"
 
 	for _, part := range strings.Split(pathname, "/")[1:] {
 		if part == "" {
@@ -174,9 +245,11 @@ func dirList(r *http.Request, f http.File, pathname string) (renderDirResult, er
 
 	return renderDirResult{
 		outputData: returnType{
-			Index:     breadcrumbs,
-			Files:     fileResult,
-			Directory: directory,
+			Index:      breadcrumbs,
+			Files:      fileResult,
+			Directory:  directory,
+			Filterable: filter != nil,
+			Filter:     filter.value(),
 		},
 	}, nil
 }
@@ -218,7 +291,7 @@ func ServeContent(w http.ResponseWriter, req *http.Request, name string, modtime
 		}
 		return size, nil
 	}
-	serveContent(w, req, name, modtime, sizeFunc, content)
+	serveContent(w, req, name, modtime, sizeFunc, content, 0)
 }
 
 // errSeeker is returned by ServeContent's sizeFunc when the content
@@ -235,7 +308,9 @@ var errNoOverlap = errors.New("invalid range: failed to overlap")
 // if modtime.IsZero(), modtime is unknown.
 // content must be seeked to the beginning of the file.
 // The sizeFunc is called at most once. Its error, if any, is sent in the HTTP response.
-func serveContent(w http.ResponseWriter, r *http.Request, name string, modtime time.Time, sizeFunc func() (int64, error), content io.ReadSeeker) {
+// A request for more than maxRanges ranges is answered with the whole content,
+// zero allows any number of ranges.
+func serveContent(w http.ResponseWriter, r *http.Request, name string, modtime time.Time, sizeFunc func() (int64, error), content io.ReadSeeker, maxRanges int) {
 	setLastModified(w, modtime)
 	done, rangeReq := checkPreconditions(w, r, modtime)
 	if done {
@@ -291,6 +366,12 @@ func serveContent(w http.ResponseWriter, r *http.Request, name string, modtime t
 			// dumb client. Ignore the range request.
 			ranges = nil
 		}
+		if maxRanges > 0 && len(ranges) > maxRanges {
+			// Every range costs a part of the multipart response,
+			// too many of them are ignored the same way.
+			trace.Add(r, "ignoring %d ranges", len(ranges))
+			ranges = nil
+		}
 		switch {
 		case len(ranges) == 1:
 			// RFC 7233, Section 4.1:
@@ -342,7 +423,9 @@ func serveContent(w http.ResponseWriter, r *http.Request, name string, modtime t
 			}()
 		}
 
-		w.Header().Set("Accept-Ranges", "bytes")
+		if _, set := w.Header()["Accept-Ranges"]; !set {
+			w.Header().Set("Accept-Ranges", "bytes")
+		}
 		if w.Header().Get("Content-Encoding") == "" {
 			w.Header().Set("Content-Length", strconv.FormatInt(sendSize, 10))
 		}
@@ -606,14 +689,32 @@ func (fh *fileHandler) serveFile(w http.ResponseWriter, r *http.Request, fs http
 	// redirect .../index.html to .../
 	// can't use Redirect() because that would make the path absolute,
 	// which would be a problem running under StripPrefix
-	if strings.HasSuffix(r.URL.Path, indexPage) {
-		localRedirect(w, r, "./")
+	// (unless listings take precedence, where the index is only served
+	// when requested directly)
+	listFirst := fh.options.DirectoryListing && fh.options.DirectoryPrecedence == ListFirst
+	if strings.HasSuffix(r.URL.Path, indexPage) && !listFirst {
+		fh.localRedirect(w, r, "./")
 		return
 	}
 
+	if fh.options.LanguageNegotiation {
+		name = fh.negotiateLanguage(w, r, fs, name)
+	}
+
 	f, err := fs.Open(name)
+	if err != nil && path.Ext(name) == "" && fh.cleanUrl(name) {
+		// clean urls - serve /about from /about.html
+		if ff, cerr := fs.Open(name + ".html"); cerr == nil {
+			f, err, name = ff, nil, name+".html"
+			trace.Add(r, "clean url %s", name)
+		}
+	}
+	if err != nil && fh.options.DecompressGzip && fh.serveGunzipped(w, r, fs, name, err) {
+		return
+	}
 	if err != nil {
-		if fh.singlePage && name != "/" {
+		if fh.options.SinglePage && name != "/" && !IsTransient(err) {
+			trace.Add(r, "single page fallback")
 			fh.serveFile(w, r, fs, "/", false)
 			return
 		}
@@ -630,18 +731,24 @@ func (fh *fileHandler) serveFile(w http.ResponseWriter, r *http.Request, fs http
 		return
 	}
 
-	if redirect {
+	if fh.options.StrictCase && !exactCase(fs, name, fh.options.DirNames) {
+		trace.Add(r, "case mismatch %s", name)
+		fh.sendError(w, r, fs, name, http.StatusNotFound)
+		return
+	}
+
+	if redirect && !fh.options.SlashRedirects {
 		// redirect to canonical path: / at end of directory url
 		// r.URL.Path always begins with /
 		url := r.URL.Path
 		if d.IsDir() {
 			if url[len(url)-1] != '/' {
-				localRedirect(w, r, path.Base(url)+"/")
+				fh.localRedirect(w, r, path.Base(url)+"/")
 				return
 			}
 		} else {
 			if url[len(url)-1] == '/' {
-				localRedirect(w, r, "../"+path.Base(url))
+				fh.localRedirect(w, r, "../"+path.Base(url))
 				return
 			}
 		}
@@ -650,29 +757,44 @@ func (fh *fileHandler) serveFile(w http.ResponseWriter, r *http.Request, fs http
 	if d.IsDir() {
 		url := r.URL.Path
 		// redirect if the directory name doesn't end in a slash
-		if url == "" || url[len(url)-1] != '/' {
-			localRedirect(w, r, path.Base(url)+"/")
+		if (url == "" || url[len(url)-1] != '/') && !fh.options.SlashRedirects {
+			fh.localRedirect(w, r, path.Base(url)+"/")
 			return
 		}
 
+		// clients asking for JSON get the listing, browsers the index
+		if fh.options.DirectoryListing && fh.options.DirectoryPrecedence == Negotiate {
+			AddVary(w, r, "Accept")
+			listFirst = AcceptJSON(r)
+		}
+
 		// use contents of index.html for directory, if present
-		index := strings.TrimSuffix(name, "/") + indexPage
-		ff, err := fs.Open(index)
-		if err == nil {
-			defer ff.Close()
-			dd, err := ff.Stat()
-			if err == nil {
+		if !listFirst {
+			if ff, dd, index, found := fh.findIndex(w, r, fs, name); found {
+				defer ff.Close()
 				name = index
 				d = dd
 				f = ff
+				trace.Add(r, "index %s", index)
 			}
 		}
 	}
 
 	// Still a directory? (we didn't find an index.html file)
 	if d.IsDir() {
-		if !fh.allowDirectoryListing {
-			fh.sendError(w, r, fs, name, http.StatusNotFound)
+		if !fh.options.DirectoryListing {
+			status := http.StatusNotFound
+			if r.Method == http.MethodHead && fh.options.DirectoryHeadStatus != 0 {
+				status = fh.options.DirectoryHeadStatus
+			}
+			if status == http.StatusOK {
+				// The directory exists, there just is nothing to list
+				trace.Add(r, "directory head %s", name)
+				setLastModified(w, d.ModTime())
+				w.WriteHeader(status)
+				return
+			}
+			fh.sendError(w, r, fs, name, status)
 			return
 		}
 
@@ -682,14 +804,40 @@ func (fh *fileHandler) serveFile(w http.ResponseWriter, r *http.Request, fs http
 		}
 		setLastModified(w, d.ModTime())
 
-		dirData, err := dirList(r, f, name)
+		if limiter := fh.options.ListingLimiter; limiter != nil {
+			if !limiter.acquire(r) {
+				trace.Add(r, "directory listing limit reached")
+				fh.sendError(w, r, fs, name, http.StatusServiceUnavailable)
+				return
+			}
+			defer limiter.release()
+		}
+
+		var filter *listingFilter
+		if fh.options.DirectoryFilter {
+			matcher, value, err := ListingFilter(r)
+			if err != nil {
+				trace.Add(r, "%v", err)
+				fh.sendError(w, r, fs, name, http.StatusBadRequest)
+				return
+			}
+			filter = &listingFilter{matcher, value}
+		}
+
+		trace.Add(r, "directory listing %s", name)
+		dirData, err := dirList(r, f, name, fh.options.Hits, fh.options.MaxNameLength, fh.options.BasePath, filter, fh.options.Thumbnails)
 		if err != nil {
 			// TODO - ERROR
 			return
 		}
-		if dirData.outputData != nil {
+		if dirData.outputData != nil && AcceptJSON(r) {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			if err := json.NewEncoder(w).Encode(dirData.outputData); err != nil {
+				log.Fatal(err)
+			}
+		} else if dirData.outputData != nil {
 			w.Header().Set("Content-Type", "text/html; charset=utf-8")
-			if err := directoryTemplate.Execute(w, dirData.outputData); err != nil {
+			if err := fh.listingTemplate(r).Execute(w, dirData.outputData); err != nil {
 				log.Fatal(err)
 			}
 		}
@@ -697,9 +845,127 @@ func (fh *fileHandler) serveFile(w http.ResponseWriter, r *http.Request, fs http
 		return
 	}
 
+	if fh.options.NoCache != nil && fh.options.NoCache(name) {
+		// Always send the file, whatever the client has cached
+		trace.Add(r, "no cache %s", name)
+		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		for _, header := range []string{"If-None-Match", "If-Modified-Since", "If-Range"} {
+			r.Header.Del(header)
+		}
+	}
+	if fh.options.NoRange != nil && fh.options.NoRange(name) {
+		// Always send the whole file
+		trace.Add(r, "no range %s", name)
+		w.Header().Set("Accept-Ranges", "none")
+		r.Header.Del("Range")
+		r.Header.Del("If-Range")
+	}
+	if fh.options.IgnoreEmptyRanges && d.Size() == 0 && r.Header.Get("Range") != "" {
+		// Answer with the (empty) file instead of a 416
+		trace.Add(r, "range ignored on empty file")
+		r.Header.Del("Range")
+	}
+	if fh.options.OnServe != nil {
+		fh.options.OnServe(w, r, name, d)
+	}
+	if fh.options.DefaultContentType != "" && path.Ext(name) == "" && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", fh.options.DefaultContentType)
+	}
+
+	if etags := fh.options.ETags; etags != nil {
+		tag, err := etags.tag(name, d, f)
+		if err != nil {
+			msg, code := toHTTPError(err)
+			fh.sendError(w, r, fs, msg, code)
+			return
+		}
+		w.Header().Set("Etag", tag)
+	}
+
+	w, counted := fh.countHit(w, r, name)
+	defer counted()
+
+	if fh.options.Precompressed && fh.servePrecompressed(w, r, fs, name, d, f) {
+		return
+	}
+	if fh.serveCompressed(w, r, name, d, f) {
+		return
+	}
+
 	// serveContent will check modification time
 	sizeFunc := func() (int64, error) { return d.Size(), nil }
-	serveContent(w, r, d.Name(), d.ModTime(), sizeFunc, f)
+
+	if cache := fh.options.Cache; cache != nil {
+		if entry, found := cache.get(name, d); found {
+			trace.Add(r, "cache hit %s", name)
+			w.Header().Set("X-Cache", "HIT")
+			setAge(w, entry.cached)
+			serveContent(w, r, d.Name(), d.ModTime(), sizeFunc, bytes.NewReader(entry.data), fh.options.MaxRanges)
+			return
+		}
+		w.Header().Set("X-Cache", "MISS")
+		if data, err := cache.fill(name, d, f); data != nil {
+			if err == nil {
+				setAge(w, time.Now())
+			}
+			serveContent(w, r, d.Name(), d.ModTime(), sizeFunc, bytes.NewReader(data), fh.options.MaxRanges)
+			return
+		} else if err != errCacheFull {
+			msg, code := toHTTPError(err)
+			fh.sendError(w, r, fs, msg, code)
+			return
+		}
+	}
+
+	serveContent(w, r, d.Name(), d.ModTime(), sizeFunc, f, fh.options.MaxRanges)
+}
+
+// exactCase reports if every element of name matches the casing of the
+// directory entry it resolved to
+func exactCase(fs http.FileSystem, name string, names *DirNames) bool {
+	dir := "/"
+	for _, part := range strings.Split(strings.Trim(name, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		if !names.Contains(fs, dir, part) {
+			return false
+		}
+		dir = path.Join(dir, part)
+	}
+
+	return true
+}
+
+// findIndex opens the index document of the directory name
+func (fh *fileHandler) findIndex(w http.ResponseWriter, r *http.Request, fs http.FileSystem, name string) (http.File, fs.FileInfo, string, bool) {
+	documents := []string{"index.html"}
+	if fh.options.DirectoryIndex != nil {
+		if document := fh.options.DirectoryIndex(name); document != "" {
+			documents = append([]string{document}, documents...)
+		}
+	}
+
+	for _, document := range documents {
+		index := strings.TrimSuffix(name, "/") + "/" + document
+		if fh.options.LanguageNegotiation {
+			index = fh.negotiateLanguage(w, r, fs, index)
+		}
+
+		f, err := fs.Open(index)
+		if err != nil {
+			continue
+		}
+		d, err := f.Stat()
+		if err != nil || d.IsDir() {
+			f.Close()
+			continue
+		}
+
+		return f, d, index, true
+	}
+
+	return nil, nil, "", false
 }
 
 // toHTTPError returns a non-specific HTTP error message and status code
@@ -714,24 +980,126 @@ func toHTTPError(err error) (msg string, httpStatus int) {
 	if errors.Is(err, fs.ErrPermission) {
 		return "403 Forbidden", http.StatusForbidden
 	}
+	if IsTransient(err) {
+		return "503 Service Unavailable", http.StatusServiceUnavailable
+	}
 	// Default:
 	return "500 Internal Server Error", http.StatusInternalServerError
 }
 
 // localRedirect gives a Moved Permanently response.
 // It does not convert relative paths to absolute paths like Redirect does.
-func localRedirect(w http.ResponseWriter, r *http.Request, newPath string) {
-	if q := r.URL.RawQuery; q != "" {
+func (fh *fileHandler) localRedirect(w http.ResponseWriter, r *http.Request, newPath string) {
+	if q := r.URL.RawQuery; q != "" && !fh.options.DropQuery {
 		newPath += "?" + q
 	}
 	w.Header().Set("Location", newPath)
 	w.WriteHeader(http.StatusMovedPermanently)
 }
 
+// Directory precedence, when a directory has an index document and listings
+// are enabled IndexFirst serves the index while ListFirst renders the listing
+// and serves the index only when it's requested directly. Negotiate renders
+// the listing for clients accepting JSON and serves the index to the others.
+const (
+	IndexFirst = "indexFirst"
+	ListFirst  = "listFirst"
+	Negotiate  = "negotiate"
+)
+
+// Options controls the behaviours layered on top of the standard FileServer
+type Options struct {
+	// Serve the root index.html for any path that doesn't exist
+	SinglePage bool
+	// Render a listing for directories without an index.html
+	DirectoryListing bool
+	// Reports if the entry at name may be revealed, as in a listing of its
+	// directory, nil reveals every entry that isn't hidden
+	Listed func(name string) bool
+	// In-memory cache of file contents, nil disables caching
+	Cache *Cache
+	// Name of the default directory listing theme
+	DirectoryTheme string
+	// Additional directory listing themes, keyed by name
+	DirectoryThemes map[string]*template.Template
+	// Serve extensionless paths from the matching .html file when this
+	// reports true for the request path, nil disables clean urls
+	CleanUrls func(name string) bool
+	// Trailing slashes are redirected by the caller, directories and files
+	// are served without redirecting to their canonical path
+	SlashRedirects bool
+	// Serve about.fr.html for /about based on Accept-Language
+	LanguageNegotiation bool
+	// IndexFirst (the default), ListFirst or Negotiate
+	DirectoryPrecedence string
+	// Reject requests whose casing doesn't match the name on disk, for
+	// case-insensitive filesystems
+	StrictCase bool
+	// Directory entries the strict case check compares against, read on
+	// every request when nil
+	DirNames *DirNames
+	// Content-Type for files without an extension, instead of sniffing
+	DefaultContentType string
+	// Called with the resolved name just before a file is served, allowing
+	// response headers to be added
+	OnServe func(w http.ResponseWriter, r *http.Request, name string, d fs.FileInfo)
+	// Cache-Control value for an error response, nothing is set when it
+	// returns an empty string
+	ErrorCacheControl func(status int) string
+	// Serve gzip compressed copies kept on disk to clients accepting them
+	CompressionCache *CompressionCache
+	// Count the downloads of every file, nil disables counting
+	Hits *HitCounter
+	// Link the thumbnails of images in listings, nil links none
+	Thumbnails *Thumbnailer
+	// Shorten the names displayed in listings to this many characters,
+	// zero keeps them whole
+	MaxNameLength int
+	// Status answering a HEAD request for a directory without an index when
+	// listings are disabled, zero answers like a GET would
+	DirectoryHeadStatus int
+	// Bounds the directory listings rendered at once, nil doesn't
+	ListingLimiter *Limiter
+	// Serve empty files in full to range requests, which can't be
+	// satisfied and get a 416 otherwise
+	IgnoreEmptyRanges bool
+	// Path the site is mounted under, prefixed to the breadcrumb links of
+	// listings, without a trailing slash
+	BasePath string
+	// Serve a missing file from its .gz sibling, decompressed
+	DecompressGzip bool
+	// Serve the .br or .gz sibling of a file to clients accepting it
+	Precompressed bool
+	// List the names close to a missing one on 404 pages
+	SuggestNotFound bool
+	// Leave the query string out of redirects
+	DropQuery bool
+	// Filter listings with a ?filter= glob
+	DirectoryFilter bool
+	// Seconds sent in Retry-After when the filesystem is temporarily
+	// unavailable, zero uses the default
+	RetryAfter int
+	// Most ranges served for a single request, a request asking for more
+	// gets the whole file. Zero allows any number.
+	MaxRanges int
+	// Index document for a directory tried before index.html, an empty
+	// name only tries index.html
+	DirectoryIndex func(dir string) string
+	// Entity tags sent with files, nil sends none
+	ETags *ETagger
+	// Files reporting true are sent with Cache-Control: no-store and never
+	// answered with a 304
+	NoCache func(name string) bool
+	// Files reporting true are always sent in full with Accept-Ranges: none
+	NoRange func(name string) bool
+	// File served with a 404 for a missing path, the closest one from the
+	// directory of the path up to the root is used
+	DirectoryFallback string
+}
+
 type fileHandler struct {
-	root                  http.FileSystem
-	singlePage            bool
-	allowDirectoryListing bool
+	root    http.FileSystem
+	options Options
 }
 
 type ioFS struct {
@@ -828,8 +1196,13 @@ func FS(fsys fs.FS) http.FileSystem {
 //
 //	http.Handle("/", http.FileServer(http.FS(fsys)))
 //
-func FileServer(root http.FileSystem, singlePage bool, allowDirectoryListing bool) http.Handler {
-	return &fileHandler{root, singlePage, allowDirectoryListing}
+func FileServer(root http.FileSystem, options Options) http.Handler {
+	return &fileHandler{root, options}
+}
+
+// cleanUrl reports if name may be served from a matching .html file
+func (fh *fileHandler) cleanUrl(name string) bool {
+	return fh.options.CleanUrls != nil && fh.options.CleanUrls(name)
 }
 
 func (f *fileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -838,6 +1211,11 @@ func (f *fileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		upath = "/" + upath
 		r.URL.Path = upath
 	}
+	if name, ok := rewritten(r); ok {
+		// The request path is kept for redirects and listings
+		f.serveFile(w, r, f.root, path.Clean("/"+name), false)
+		return
+	}
 	f.serveFile(w, r, f.root, path.Clean(upath), true)
 }
 
@@ -893,6 +1271,12 @@ func parseRange(s string, size int64) ([]httpRange, error) {
 			if i < 0 || err != nil {
 				return nil, errors.New("invalid range")
 			}
+			if i == 0 || size == 0 {
+				// A suffix of nothing, or of an empty file,
+				// selects no bytes
+				noOverlap = true
+				continue
+			}
 			if i > size {
 				i = size
 			}
@@ -964,6 +1348,24 @@ func sumRangesSize(ranges []httpRange) (size int64) {
 
 // Generate an error page
 func (fh *fileHandler) sendError(w http.ResponseWriter, r *http.Request, fs http.FileSystem, path string, statusCode int) {
+	if fh.options.ErrorCacheControl != nil {
+		if value := fh.options.ErrorCacheControl(statusCode); value != "" {
+			w.Header().Set("Cache-Control", value)
+		}
+	}
+	if statusCode == http.StatusServiceUnavailable {
+		SetRetryAfter(w, fh.options.RetryAfter)
+	}
+
+	if statusCode == http.StatusNotFound && fh.options.DirectoryFallback != "" {
+		if fallback := FindFallback(fs, r.URL.Path, fh.options.DirectoryFallback); fallback != "" {
+			trace.Add(r, "fallback %s", fallback)
+			w.WriteHeader(statusCode)
+			fh.serveFile(w, r, fs, fallback, false)
+			return
+		}
+	}
+
 	errorPage := fmt.Sprintf("%d.html", statusCode)
 	f, err := fs.Open(errorPage)
 	if err == nil {
@@ -980,12 +1382,16 @@ func (fh *fileHandler) sendError(w http.ResponseWriter, r *http.Request, fs http
 		StatusCode int    `json:"-"`
 		Code       string `json:"code"`
 		Message    string `json:"message"`
+		Method     string `json:"-"`
+		Path       string `json:"-"`
+		// Existing paths close to a missing one
+		Suggestions []string `json:"suggestions,omitempty"`
 	}
 	type errorInfo = struct {
 		Error errorBodyType `json:"error"`
 	}
 
-	errorBody := errorBodyType{StatusCode: statusCode}
+	errorBody := errorBodyType{StatusCode: statusCode, Method: r.Method, Path: r.URL.Path}
 	switch statusCode {
 	case http.StatusBadRequest:
 		errorBody.Code = "bad_request"
@@ -993,14 +1399,20 @@ func (fh *fileHandler) sendError(w http.ResponseWriter, r *http.Request, fs http
 	case http.StatusNotFound:
 		errorBody.Code = "not_found"
 		errorBody.Message = "The requested path could not be found"
+		if fh.options.SuggestNotFound {
+			errorBody.Suggestions = Suggestions(fs, r.URL.Path, MaxSuggestions, fh.options.Listed)
+		}
 	case http.StatusInternalServerError:
 		errorBody.Code = "internal_server_error"
 		errorBody.Message = "A server error has occurred"
+	default:
+		errorBody.Code = strings.ReplaceAll(strings.ToLower(http.StatusText(statusCode)), " ", "_")
+		errorBody.Message = http.StatusText(statusCode)
 	}
 
-	w.WriteHeader(statusCode)
-	if acceptJSON(r) {
+	if AcceptJSON(r) {
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(statusCode)
 
 		if err := json.NewEncoder(w).Encode(errorInfo{errorBody}); err != nil {
 			log.Fatal(err)
@@ -1010,22 +1422,10 @@ func (fh *fileHandler) sendError(w http.ResponseWriter, r *http.Request, fs http
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(statusCode)
 	err = errorTemplate.Execute(w, errorBody)
 
 	if err != nil {
 		log.Fatal(err)
 	}
 }
-
-// Check to see if we have an Accept: application/json in the request -- then send data
-func acceptJSON(r *http.Request) bool {
-	accept := r.Header[http.CanonicalHeaderKey("accept")]
-
-	for _, value := range accept {
-		if strings.Contains(strings.ToLower(value), "application/json") {
-			return true
-		}
-	}
-
-	return false
-}
@@ -0,0 +1,57 @@
+package swhttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/koblas/swerver/pkg/trace"
+)
+
+// serveGunzipped answers a request for a missing file with the
+// decompressed content of its .gz sibling, /data.json is served from
+// /data.json.gz. openErr is the error opening name, only a missing file
+// falls back. It reports false when there is no such sibling.
+func (fh *fileHandler) serveGunzipped(w http.ResponseWriter, r *http.Request, fsys http.FileSystem, name string, openErr error) bool {
+	if !os.IsNotExist(openErr) || strings.HasSuffix(name, "/") || path.Ext(name) == ".gz" {
+		return false
+	}
+
+	f, err := fsys.Open(name + ".gz")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	d, err := f.Stat()
+	if err != nil || d.IsDir() {
+		return false
+	}
+
+	reader, err := gzip.NewReader(f)
+	if err != nil {
+		trace.Add(r, "invalid gzip %s.gz", name)
+		fh.sendError(w, r, fsys, name, http.StatusInternalServerError)
+		return true
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		trace.Add(r, "invalid gzip %s.gz", name)
+		fh.sendError(w, r, fsys, name, http.StatusInternalServerError)
+		return true
+	}
+
+	trace.Add(r, "decompressed %s.gz", name)
+	if fh.options.OnServe != nil {
+		fh.options.OnServe(w, r, name, d)
+	}
+
+	sizeFunc := func() (int64, error) { return int64(len(data)), nil }
+	serveContent(w, r, path.Base(name), d.ModTime(), sizeFunc, bytes.NewReader(data), fh.options.MaxRanges)
+
+	return true
+}
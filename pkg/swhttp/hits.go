@@ -0,0 +1,142 @@
+package swhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// HitCounter counts the successful downloads of every file, keyed by the
+// cleaned request name. With a file the counts survive a restart.
+type HitCounter struct {
+	mu     sync.Mutex
+	file   string
+	counts map[string]int64
+}
+
+// NewHitCounter creates a counter, loading the counts saved in file when
+// it exists. An empty file keeps the counts in memory only.
+func NewHitCounter(file string) (*HitCounter, error) {
+	c := &HitCounter{
+		file:   file,
+		counts: map[string]int64{},
+	}
+	if file == "" {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c.counts); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Add counts a download of name, saving the counts when persisted
+func (c *HitCounter) Add(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts[name]++
+
+	return c.save()
+}
+
+// Get returns the number of downloads of name
+func (c *HitCounter) Get(name string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.counts[name]
+}
+
+// Counts returns a copy of every count
+func (c *HitCounter) Counts() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make(map[string]int64, len(c.counts))
+	for name, count := range c.counts {
+		result[name] = count
+	}
+
+	return result
+}
+
+// save writes the counts through a temporary file, the lock has to be held
+func (c *HitCounter) save() error {
+	if c.file == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(c.counts)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.file), ".hits-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.file)
+}
+
+// statusRecorder remembers the status of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// countHit wraps w to count a download of name once the response turned
+// out successful, the returned function has to run after serving.
+func (fh *fileHandler) countHit(w http.ResponseWriter, r *http.Request, name string) (http.ResponseWriter, func()) {
+	hits := fh.options.Hits
+	if hits == nil || r.Method != http.MethodGet {
+		return w, func() {}
+	}
+
+	recorder := &statusRecorder{ResponseWriter: w}
+
+	return recorder, func() {
+		if recorder.status != http.StatusOK && recorder.status != http.StatusPartialContent {
+			return
+		}
+		if err := hits.Add(name); err != nil {
+			logf(r, "swhttp: unable to save hit counts: %v", err)
+		}
+	}
+}
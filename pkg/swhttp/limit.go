@@ -0,0 +1,52 @@
+package swhttp
+
+import (
+	"net/http"
+	"time"
+)
+
+// Limiter bounds the number of directory listings rendered at once, the
+// requests beyond the limit wait for a free slot.
+type Limiter struct {
+	slots chan struct{}
+	wait  time.Duration
+}
+
+// NewLimiter allows max concurrent renders, a request waits at most wait
+// for a slot or as long as the client does when wait is zero.
+func NewLimiter(max int, wait time.Duration) *Limiter {
+	return &Limiter{
+		slots: make(chan struct{}, max),
+		wait:  wait,
+	}
+}
+
+// acquire takes a slot for r, false when none became free in time
+func (l *Limiter) acquire(r *http.Request) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	var timeout <-chan time.Time
+	if l.wait > 0 {
+		timer := time.NewTimer(l.wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timeout:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// release frees the slot taken by acquire
+func (l *Limiter) release() {
+	<-l.slots
+}
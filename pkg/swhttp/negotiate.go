@@ -0,0 +1,138 @@
+package swhttp
+
+import (
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/koblas/swerver/pkg/trace"
+)
+
+type qualityEntry struct {
+	value   string
+	quality float64
+}
+
+// parseQualityList parses a header of the form "a;q=0.5, b, c;q=0" into its
+// values ordered by preference, values with a quality of zero are dropped.
+func parseQualityList(header string) []string {
+	result := []string{}
+	for _, item := range parseQualityEntries(header) {
+		result = append(result, item.value)
+	}
+
+	return result
+}
+
+// parseQualityEntries is parseQualityList keeping the quality of each value
+func parseQualityEntries(header string) []qualityEntry {
+	entries := []qualityEntry{}
+
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		value := strings.TrimSpace(params[0])
+		if value == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range params[1:] {
+			key, val, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found || strings.ToLower(strings.TrimSpace(key)) != "q" {
+				continue
+			}
+			if q, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+				quality = q
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+		entries = append(entries, qualityEntry{value, quality})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].quality > entries[j].quality })
+
+	return entries
+}
+
+// AcceptJSON tells if application/json is the type the client prefers, it
+// has to be listed explicitly and come first among the types with the
+// highest quality. Wildcards never select JSON but a wildcard with a higher
+// quality means the client prefers something else.
+func AcceptJSON(r *http.Request) bool {
+	entries := parseQualityEntries(strings.Join(r.Header.Values("Accept"), ","))
+
+	for _, item := range entries {
+		if item.quality < entries[0].quality {
+			return false
+		}
+		if strings.Contains(item.value, "*") {
+			continue
+		}
+		return strings.EqualFold(item.value, "application/json")
+	}
+
+	return false
+}
+
+// acceptedLanguages returns the language tags the client accepts in order
+// of preference, a regional tag (fr-CA) is followed by its primary tag (fr).
+func acceptedLanguages(r *http.Request) []string {
+	seen := map[string]bool{}
+	result := []string{}
+
+	add := func(tag string) {
+		if !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+
+	for _, tag := range parseQualityList(r.Header.Get("Accept-Language")) {
+		tag = strings.ToLower(tag)
+		if tag == "*" || strings.ContainsAny(tag, "/\\.") {
+			continue
+		}
+		add(tag)
+		if primary, _, found := strings.Cut(tag, "-"); found {
+			add(primary)
+		}
+	}
+
+	return result
+}
+
+// negotiateLanguage looks for a language specific sibling of an HTML
+// document, a request for /about (or /about.html) is answered with
+// /about.fr.html for a client preferring French.
+func (fh *fileHandler) negotiateLanguage(w http.ResponseWriter, r *http.Request, fs http.FileSystem, name string) string {
+	base := name
+	switch path.Ext(name) {
+	case ".html":
+		base = strings.TrimSuffix(name, ".html")
+	case "":
+		if !fh.cleanUrl(name) || strings.HasSuffix(name, "/") {
+			return name
+		}
+	default:
+		return name
+	}
+
+	AddVary(w, r, "Accept-Language")
+
+	for _, lang := range acceptedLanguages(r) {
+		candidate := base + "." + lang + ".html"
+		if f, err := fs.Open(candidate); err == nil {
+			d, err := f.Stat()
+			f.Close()
+			if err == nil && !d.IsDir() {
+				trace.Add(r, "language %s", lang)
+				return candidate
+			}
+		}
+	}
+
+	return name
+}
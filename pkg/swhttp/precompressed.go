@@ -0,0 +1,100 @@
+package swhttp
+
+import (
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/koblas/swerver/pkg/trace"
+)
+
+// Encodings of the compressed siblings looked for, in order of preference
+var precompressedEncodings = []struct {
+	encoding  string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// acceptedEncodings returns the content codings accepted by the client, a
+// wildcard accepting all of them
+func acceptedEncodings(r *http.Request) map[string]bool {
+	accepted := map[string]bool{}
+	for _, encoding := range parseQualityList(r.Header.Get("Accept-Encoding")) {
+		accepted[strings.ToLower(encoding)] = true
+	}
+	if accepted["*"] {
+		for _, item := range precompressedEncodings {
+			accepted[item.encoding] = true
+		}
+	}
+
+	return accepted
+}
+
+// servePrecompressed answers with the .br or .gz sibling of a file shipped
+// along with it, /app.js is sent from /app.js.br to a client accepting
+// brotli. A sibling older than the file is considered stale and ignored.
+// It reports false when the request or the file doesn't qualify.
+func (fh *fileHandler) servePrecompressed(w http.ResponseWriter, r *http.Request, fsys http.FileSystem, name string, d fs.FileInfo, f io.ReadSeeker) bool {
+	ext := path.Ext(name)
+	if ext == ".br" || ext == ".gz" {
+		return false
+	}
+
+	var accepted map[string]bool
+	for _, item := range precompressedEncodings {
+		file, err := fsys.Open(name + item.extension)
+		if err != nil {
+			continue
+		}
+		info, err := file.Stat()
+		if err != nil || info.IsDir() || info.ModTime().Before(d.ModTime()) {
+			file.Close()
+			continue
+		}
+
+		if accepted == nil {
+			AddVary(w, r, "Accept-Encoding")
+			if r.Header.Get("Range") != "" {
+				file.Close()
+				return false
+			}
+			accepted = acceptedEncodings(r)
+		}
+		if !accepted[item.encoding] {
+			file.Close()
+			continue
+		}
+		defer file.Close()
+
+		// The type is the one of the original file, never of the
+		// compressed bytes
+		if w.Header().Get("Content-Type") == "" {
+			ctype := mime.TypeByExtension(ext)
+			if ctype == "" {
+				var buf [sniffLen]byte
+				n, _ := io.ReadFull(f, buf[:])
+				ctype = http.DetectContentType(buf[:n])
+			}
+			w.Header().Set("Content-Type", ctype)
+		}
+
+		trace.Add(r, "precompressed %s%s", name, item.extension)
+		w.Header().Set("Content-Encoding", item.encoding)
+		if tag := w.Header().Get("Etag"); tag != "" {
+			w.Header().Set("Etag", encodedETag(tag, item.encoding))
+		}
+
+		sizeFunc := func() (int64, error) { return info.Size(), nil }
+		serveContent(w, r, d.Name(), d.ModTime(), sizeFunc, file, fh.options.MaxRanges)
+
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,20 @@
+package swhttp
+
+import (
+	"context"
+	"net/http"
+)
+
+type rewriteKey struct{}
+
+// WithRewrite returns a request for which the file server serves name
+// instead of the file at the request path
+func WithRewrite(r *http.Request, name string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), rewriteKey{}, name))
+}
+
+// rewritten is the name set by WithRewrite for r
+func rewritten(r *http.Request) (string, bool) {
+	name, ok := r.Context().Value(rewriteKey{}).(string)
+	return name, ok
+}
@@ -0,0 +1,36 @@
+package swhttp
+
+import (
+	"fmt"
+	"time"
+)
+
+// Layout of the modification times shown in directory listings
+const ModifiedLayout = "2006-01-02 15:04"
+
+// FormatSize renders a number of bytes for people, 1536 is "1.5 KB"
+func FormatSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	value := float64(size) / 1024
+	for _, unit := range []string{"KB", "MB", "GB", "TB"} {
+		if value < 1024 || unit == "TB" {
+			return fmt.Sprintf("%.1f %s", value, unit)
+		}
+		value /= 1024
+	}
+
+	return ""
+}
+
+// FormatModified renders a modification time for a listing, empty for the
+// zero time
+func FormatModified(modified time.Time) string {
+	if modified.IsZero() {
+		return ""
+	}
+
+	return modified.Format(ModifiedLayout)
+}
@@ -0,0 +1,120 @@
+package swhttp
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Suggestions offered on a 404 at most
+const MaxSuggestions = 3
+
+// Directory entries looked at for suggestions, larger directories only
+// have their first entries compared
+const maxSuggestScan = 1000
+
+// Suggestions lists up to limit entries of the directory of name whose
+// names are close to the missing one, nearest first. Hidden entries are
+// never suggested, nor the ones listed reports false for when it isn't nil.
+func Suggestions(fsys http.FileSystem, name string, limit int, listed func(name string) bool) []string {
+	dir, base := path.Split(name)
+	if base == "" || dir == "" {
+		return nil
+	}
+	base = strings.ToLower(base)
+
+	f, err := fsys.Open(dir)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	entries, _ := f.Readdir(maxSuggestScan)
+
+	type candidate struct {
+		path     string
+		distance int
+	}
+	candidates := []candidate{}
+	allowed := len([]rune(base))/3 + 1
+
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if strings.HasPrefix(entryName, ".") {
+			continue
+		}
+		lower := strings.ToLower(entryName)
+		distance := editDistance(base, lower)
+		// /about is close to about.html
+		if ext := path.Ext(lower); ext != "" {
+			if d := editDistance(base, strings.TrimSuffix(lower, ext)); d < distance {
+				distance = d
+			}
+		}
+		if distance > allowed {
+			continue
+		}
+		target := dir + entryName
+		if listed != nil && !listed(target) {
+			continue
+		}
+		if entry.IsDir() {
+			target += "/"
+		}
+		candidates = append(candidates, candidate{target, distance})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].path < candidates[j].path
+	})
+
+	result := []string{}
+	for _, item := range candidates {
+		if len(result) == limit {
+			break
+		}
+		result = append(result, item.path)
+	}
+
+	return result
+}
+
+// EscapePath escapes name for use as the path of a link
+func EscapePath(name string) string {
+	u := url.URL{Path: name}
+	return u.String()
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(rb)]
+}
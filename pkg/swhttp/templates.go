@@ -2,6 +2,7 @@ package swhttp
 
 import (
 	_ "embed"
+	"net/http"
 	"text/template"
 )
 
@@ -11,5 +12,32 @@ var errorHtml string
 //go:embed directory.html
 var directoryHtml string
 
-var errorTemplate = template.Must(template.New("error").Parse(errorHtml))
+//go:embed directory_grid.html
+var directoryGridHtml string
+
+var errorTemplate = template.Must(template.New("error").Funcs(template.FuncMap{"escapePath": EscapePath}).Parse(errorHtml))
 var directoryTemplate = template.Must(template.New("directory").Parse(directoryHtml))
+
+// Built in directory listing themes, "list" is the default
+var directoryThemes = map[string]*template.Template{
+	"list": directoryTemplate,
+	"grid": template.Must(template.New("grid").Parse(directoryGridHtml)),
+}
+
+// listingTemplate picks the directory listing theme, a ?view= query parameter
+// takes precedence over the configured theme.
+func (fh *fileHandler) listingTemplate(r *http.Request) *template.Template {
+	for _, name := range []string{r.URL.Query().Get("view"), fh.options.DirectoryTheme} {
+		if name == "" {
+			continue
+		}
+		if tmpl, found := fh.options.DirectoryThemes[name]; found {
+			return tmpl
+		}
+		if tmpl, found := directoryThemes[name]; found {
+			return tmpl
+		}
+	}
+
+	return directoryTemplate
+}
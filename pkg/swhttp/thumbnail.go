@@ -0,0 +1,226 @@
+package swhttp
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Thumbnail edge used when none is configured
+const DefaultThumbnailSize = 200
+
+// Largest thumbnail edge accepted
+const MaxThumbnailSize = 1024
+
+// Images with more pixels are not thumbnailed, decoding them would take
+// too much memory
+const maxThumbnailPixels = 50 * 1000 * 1000
+
+// Thumbnails kept in memory at most
+const maxThumbnails = 1000
+
+// ErrNoThumbnail is returned for a file that isn't an image that can be
+// thumbnailed
+var ErrNoThumbnail = errors.New("no thumbnail")
+
+// ErrImageTooLarge is returned for an image too large to be decoded
+var ErrImageTooLarge = errors.New("image too large")
+
+// Thumbnailer makes reduced copies of images, fitting in a square of a
+// fixed size, and keeps them in memory while the source is unchanged.
+type Thumbnailer struct {
+	mu      sync.Mutex
+	prefix  string
+	size    int
+	entries map[string]thumbnail
+}
+
+type thumbnail struct {
+	data    []byte
+	ctype   string
+	modTime time.Time
+	size    int64
+}
+
+// NewThumbnailer creates a thumbnailer whose thumbnails are served below
+// the prefix path, with size as their longest edge
+func NewThumbnailer(prefix string, size int) *Thumbnailer {
+	if size <= 0 {
+		size = DefaultThumbnailSize
+	}
+
+	return &Thumbnailer{
+		prefix:  prefix,
+		size:    size,
+		entries: map[string]thumbnail{},
+	}
+}
+
+// IsImage tells if name has the extension of an image a thumbnail can be
+// made of
+func IsImage(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return true
+	}
+
+	return false
+}
+
+// URL is the path of the thumbnail of name, empty when name isn't an image
+func (t *Thumbnailer) URL(name string) string {
+	if !IsImage(name) {
+		return ""
+	}
+	u := url.URL{Path: t.prefix + path.Clean("/"+name)}
+
+	return u.String()
+}
+
+// Serve sends the thumbnail of name, ErrNoThumbnail and ErrImageTooLarge
+// report images that can't be thumbnailed, other errors come from the
+// file system. Nothing is written when an error is returned.
+func (t *Thumbnailer) Serve(w http.ResponseWriter, r *http.Request, fsys http.FileSystem, name string) error {
+	name = path.Clean("/" + name)
+	if !IsImage(name) {
+		return ErrNoThumbnail
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	d, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if d.IsDir() {
+		return ErrNoThumbnail
+	}
+
+	t.mu.Lock()
+	entry, found := t.entries[name]
+	t.mu.Unlock()
+	if !found || !entry.modTime.Equal(d.ModTime()) || entry.size != d.Size() {
+		entry, err = t.make(f)
+		if err != nil {
+			return err
+		}
+		entry.modTime = d.ModTime()
+		entry.size = d.Size()
+		t.store(name, entry)
+	}
+
+	w.Header().Set("Content-Type", entry.ctype)
+	ServeContent(w, r, "", entry.modTime, bytes.NewReader(entry.data))
+
+	return nil
+}
+
+// make decodes the image of f and encodes its thumbnail, JPEG images stay
+// JPEG, others are turned into PNG
+func (t *Thumbnailer) make(f io.ReadSeeker) (thumbnail, error) {
+	config, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return thumbnail{}, ErrNoThumbnail
+	}
+	if config.Width*config.Height > maxThumbnailPixels {
+		return thumbnail{}, ErrImageTooLarge
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return thumbnail{}, err
+	}
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return thumbnail{}, ErrNoThumbnail
+	}
+
+	dst := scaleDown(src, t.size)
+	buf := bytes.Buffer{}
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80})
+		return thumbnail{data: buf.Bytes(), ctype: "image/jpeg"}, err
+	}
+	err = png.Encode(&buf, dst)
+
+	return thumbnail{data: buf.Bytes(), ctype: "image/png"}, err
+}
+
+func (t *Thumbnailer) store(name string, entry thumbnail) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, found := t.entries[name]; !found && len(t.entries) >= maxThumbnails {
+		// Make room by dropping any of the others
+		for key := range t.entries {
+			delete(t.entries, key)
+			break
+		}
+	}
+	t.entries[name] = entry
+}
+
+// scaleDown fits src in a square of size pixels keeping its proportions,
+// every pixel of the result is the average of the source pixels it covers.
+// Smaller images are returned as is.
+func scaleDown(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return src
+	}
+
+	dstWidth, dstHeight := size, size
+	if width > height {
+		dstHeight = height * size / width
+	} else {
+		dstWidth = width * size / height
+	}
+	if dstWidth < 1 {
+		dstWidth = 1
+	}
+	if dstHeight < 1 {
+		dstHeight = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0 := bounds.Min.Y + y*height/dstHeight
+		y1 := bounds.Min.Y + (y+1)*height/dstHeight
+		for x := 0; x < dstWidth; x++ {
+			x0 := bounds.Min.X + x*width/dstWidth
+			x1 := bounds.Min.X + (x+1)*width/dstWidth
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+
+	return dst
+}
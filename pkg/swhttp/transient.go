@@ -0,0 +1,44 @@
+package swhttp
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"syscall"
+)
+
+// Seconds a client is asked to wait when the filesystem is unavailable
+const defaultRetryAfter = 10
+
+// Errors of a filesystem that is expected to come back, like a network
+// mount that went away for a moment
+var transientErrors = []error{
+	syscall.EAGAIN,
+	syscall.EBUSY,
+	syscall.EINTR,
+	syscall.ESTALE,
+	syscall.ETIMEDOUT,
+	syscall.ENOTCONN,
+	syscall.EHOSTDOWN,
+}
+
+// IsTransient reports if err is a temporary filesystem failure that is
+// worth retrying, rather than a missing or broken file.
+func IsTransient(err error) bool {
+	for _, transient := range transientErrors {
+		if errors.Is(err, transient) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetRetryAfter asks the client to retry in seconds, or after the default
+// delay when seconds isn't positive
+func SetRetryAfter(w http.ResponseWriter, seconds int) {
+	if seconds <= 0 {
+		seconds = defaultRetryAfter
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
@@ -0,0 +1,74 @@
+package swhttp
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// varySet collects the request headers a response was negotiated on, so
+// that a single consolidated Vary header can be written even when other
+// layers (e.g. compression) overwrite the header.
+type varySet struct {
+	mu    sync.Mutex
+	names []string
+}
+
+type varyKey struct{}
+
+// WithVary returns a request that collects the headers passed to AddVary
+func WithVary(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), varyKey{}, &varySet{}))
+}
+
+// AddVary records that the response to r depends on the named request headers
+func AddVary(w http.ResponseWriter, r *http.Request, names ...string) {
+	if set, ok := r.Context().Value(varyKey{}).(*varySet); ok {
+		set.mu.Lock()
+		set.names = append(set.names, names...)
+		set.mu.Unlock()
+	}
+	MergeVary(w.Header(), names...)
+}
+
+// FinalizeVary folds the headers collected for r into a single Vary header
+func FinalizeVary(h http.Header, r *http.Request) {
+	set, ok := r.Context().Value(varyKey{}).(*varySet)
+	if !ok {
+		MergeVary(h)
+		return
+	}
+
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	MergeVary(h, set.names...)
+}
+
+// MergeVary adds names to the Vary header, the result is a single header
+// line without duplicates.
+func MergeVary(h http.Header, names ...string) {
+	seen := map[string]bool{}
+	result := []string{}
+
+	for _, value := range append(h.Values("Vary"), names...) {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			key := strings.ToLower(name)
+			if name == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			result = append(result, http.CanonicalHeaderKey(name))
+		}
+	}
+
+	if len(result) == 0 {
+		return
+	}
+	if seen["*"] {
+		h.Set("Vary", "*")
+		return
+	}
+	h.Set("Vary", strings.Join(result, ", "))
+}
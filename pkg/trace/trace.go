@@ -0,0 +1,60 @@
+// Package trace records the routing decisions made while serving a single
+// request, so that a configuration can be debugged from the response.
+package trace
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Trace accumulates the steps taken for a request
+type Trace struct {
+	mu    sync.Mutex
+	steps []string
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying t
+func NewContext(ctx context.Context, t *Trace) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// FromRequest returns the trace attached to the request, or nil when
+// tracing isn't enabled for it
+func FromRequest(r *http.Request) *Trace {
+	t, _ := r.Context().Value(contextKey{}).(*Trace)
+
+	return t
+}
+
+// Add records a step on the request's trace, if there is one
+func Add(r *http.Request, format string, args ...any) {
+	if t := FromRequest(r); t != nil {
+		t.Add(format, args...)
+	}
+}
+
+// Add records a step
+func (t *Trace) Add(format string, args ...any) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.steps = append(t.steps, fmt.Sprintf(format, args...))
+}
+
+// Steps returns a copy of the recorded steps
+func (t *Trace) Steps() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]string{}, t.steps...)
+}
+
+// String formats the steps for use as a header value
+func (t *Trace) String() string {
+	return strings.Join(t.Steps(), "; ")
+}
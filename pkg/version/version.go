@@ -0,0 +1,60 @@
+// Package version describes the running build of swerver, the values are
+// injected at link time:
+//
+//	go build -ldflags "-X github.com/koblas/swerver/pkg/version.Version=1.2.0 \
+//	  -X github.com/koblas/swerver/pkg/version.Commit=$(git rev-parse --short HEAD) \
+//	  -X github.com/koblas/swerver/pkg/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+var (
+	// Version of the release
+	Version = "0.1.0"
+	// Commit the binary was built from, empty when unknown
+	Commit = ""
+	// Date the binary was built, empty when unknown
+	Date = ""
+)
+
+// Time the process started, for the uptime
+var started = time.Now()
+
+// Info is the build information reported by the /__info endpoint
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"goVersion"`
+	// Seconds since the process started
+	Uptime int64 `json:"uptime"`
+}
+
+// Get returns the build information of the running binary
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+		Uptime:    int64(time.Since(started).Seconds()),
+	}
+}
+
+// String is the version line printed by --version
+func String() string {
+	result := Version
+	if Commit != "" {
+		result += " (" + Commit
+		if Date != "" {
+			result += ", built " + Date
+		}
+		result += ")"
+	}
+
+	return fmt.Sprintf("%s %s", result, runtime.Version())
+}